@@ -0,0 +1,44 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+func writeFourCC(w io.Writer, value string) error {
+	if len(value) != 4 {
+		return errors.New("the four-cc must be 4 characters")
+	}
+	_, err := io.WriteString(w, value)
+	return err
+}
+
+func writeChunkHeader(w io.Writer, id string, size int32) error {
+	err := writeFourCC(w, id)
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, size)
+}
+
+// Writes the string truncated or zero-padded to the length.
+func writeFixedLengthString(w io.Writer, value string, length int32) error {
+	data := make([]byte, length)
+	copy(data, value)
+	_, err := w.Write(data)
+	return err
+}
+
+// Writes the string as a zero-terminated chunk padded to an even size.
+func writeStringChunk(w io.Writer, id string, value string) error {
+	length := int32(len(value)) + 1
+	if length%2 != 0 {
+		length++
+	}
+	err := writeChunkHeader(w, id, length)
+	if err != nil {
+		return err
+	}
+	return writeFixedLengthString(w, value, length)
+}
@@ -74,8 +74,15 @@ func (bf *biQuadFilter) process(block []float32) {
 			block[t] = output
 		}
 	} else {
-		bf.x2 = block[blockLength-2]
-		bf.x1 = block[blockLength-1]
+		// The block can be shorter than two samples if it is split at a scheduled message.
+		switch {
+		case blockLength >= 2:
+			bf.x2 = block[blockLength-2]
+			bf.x1 = block[blockLength-1]
+		case blockLength == 1:
+			bf.x2 = bf.x1
+			bf.x1 = block[0]
+		}
 		bf.y2 = bf.x2
 		bf.y1 = bf.x1
 	}
@@ -12,16 +12,51 @@ type channel struct {
 	pan        int16
 	expression int16
 	holdPedal  bool
+	sostenuto  bool
+	softPedal  bool
 
 	reverbSend byte
 	chorusSend byte
 
 	rpn            int16
 	pitchBendRange int16
-	coarseTune     int16
-	fineTune       int16
+
+	nrpn         int16
+	nrpnSelected bool // Whether the data entry is applied to the NRPN rather than the RPN.
+	nrpnValues   [nrpn_ParameterCount]byte
+	drumPitch    [128]byte
+	drumLevel    [128]byte
+	drumPan      [128]byte
+
+	coarseTune int16
+	fineTune   int16
+
+	tuning         *Tuning // nil means the equal temperament.
+	tuningBank     int32
+	tuningProgram  int32
+	tuningSelected bool // Whether the tuning program has been selected by the RPN.
+	scaleTuning    [12]float32
+
+	portamentoTime    int16
+	portamento        bool
+	portamentoControl int32 // The key given by the portamento control, which is applied to the next note only.
+	lastKey           int32 // The key of the last note-on, which the portamento starts from.
+	monoMode          bool
+	heldKeys          []int32 // The keys held in the mono mode, in the order of the note-on.
 
 	pitchBend float32
+
+	mpeMaster int32 // The master channel of the MPE zone if the channel is a member of it, or -1.
+
+	channelPressure byte
+	polyPressure    [128]byte // The pressure of each key.
+
+	// The raw values of the controllers, which are used as the modulator sources.
+	controllerValues [128]byte
+
+	// Incremented when any of the modulator sources changes,
+	// so the voices can skip the evaluation of the modulators otherwise.
+	modulatorSerial uint32
 }
 
 func newChannel(s *Synthesizer, isPercussionChannel bool) *channel {
@@ -49,26 +84,104 @@ func (ch *channel) reset() {
 	ch.pan = 64 << 7
 	ch.expression = 127 << 7
 	ch.holdPedal = false
+	ch.sostenuto = false
+	ch.softPedal = false
 
 	ch.reverbSend = 40
 	ch.chorusSend = 0
 
 	ch.rpn = -1
 	ch.pitchBendRange = 2 << 7
+
+	ch.resetNrpn()
 	ch.coarseTune = 0
 	ch.fineTune = 8192
 
+	ch.tuning = nil
+	ch.tuningBank = 0
+	ch.tuningProgram = 0
+	ch.tuningSelected = false
+	for i := 0; i < len(ch.scaleTuning); i++ {
+		ch.scaleTuning[i] = 0
+	}
+
 	ch.pitchBend = 0
+
+	ch.mpeMaster = -1
+
+	ch.resetPressure()
+
+	ch.portamentoTime = 0
+	ch.portamento = false
+	ch.portamentoControl = -1
+	ch.lastKey = -1
+	ch.monoMode = false
+	ch.clearHeldKeys()
+
+	for i := 0; i < len(ch.controllerValues); i++ {
+		ch.controllerValues[i] = 0
+	}
+	ch.controllerValues[0x07] = 100
+	ch.controllerValues[0x0A] = 64
+	ch.controllerValues[0x0B] = 127
+	ch.controllerValues[0x5B] = 40
+
+	ch.modulatorSerial++
 }
 
 func (ch *channel) resetAllControllers() {
 	ch.modulation = 0
 	ch.expression = 127 << 7
 	ch.holdPedal = false
+	ch.sostenuto = false
+	ch.softPedal = false
 
 	ch.rpn = -1
+	ch.nrpn = -1
+	ch.nrpnSelected = false
 
 	ch.pitchBend = 0
+
+	ch.resetPressure()
+
+	ch.portamento = false
+	ch.portamentoControl = -1
+
+	ch.controllerValues[0x01] = 0
+	ch.controllerValues[0x0B] = 127
+	ch.controllerValues[0x40] = 0
+	ch.controllerValues[0x41] = 0
+	ch.controllerValues[0x42] = 0
+	ch.controllerValues[0x43] = 0
+
+	ch.modulatorSerial++
+}
+
+func (ch *channel) resetPressure() {
+	ch.channelPressure = 0
+	for i := 0; i < len(ch.polyPressure); i++ {
+		ch.polyPressure[i] = 0
+	}
+	ch.modulatorSerial++
+}
+
+func (ch *channel) setChannelPressure(value int32) {
+	ch.channelPressure = byte(value)
+	ch.modulatorSerial++
+}
+
+func (ch *channel) setPolyPressure(key int32, value int32) {
+	if 0 <= key && int(key) < len(ch.polyPressure) {
+		ch.polyPressure[key] = byte(value)
+		ch.modulatorSerial++
+	}
+}
+
+func (ch *channel) setControllerValue(number int32, value int32) {
+	if 0 <= number && int(number) < len(ch.controllerValues) {
+		ch.controllerValues[number] = byte(value)
+		ch.modulatorSerial++
+	}
 }
 
 func (ch *channel) setBank(value int32) {
@@ -79,6 +192,16 @@ func (ch *channel) setBank(value int32) {
 	}
 }
 
+// Switches the channel to a drum channel or a normal one, which selects the standard set or the piano.
+func (ch *channel) setPercussionChannel(value bool) {
+	ch.isPercussionChannel = value
+	if value {
+		ch.bankNumber = 128
+	} else {
+		ch.bankNumber = 0
+	}
+}
+
 func (ch *channel) setPatch(value int32) {
 	ch.patchNumber = value
 }
@@ -119,6 +242,10 @@ func (ch *channel) setHoldPedal(value int32) {
 	ch.holdPedal = value >= 64
 }
 
+func (ch *channel) setSoftPedal(value int32) {
+	ch.softPedal = value >= 64
+}
+
 func (ch *channel) setReverbSend(value int32) {
 	ch.reverbSend = byte(value)
 }
@@ -129,27 +256,48 @@ func (ch *channel) setChorusSend(value int32) {
 
 func (ch *channel) setRpnCoarse(value int32) {
 	ch.rpn = int16((int32(ch.rpn) & 0x7F) | (value << 7))
+	ch.nrpnSelected = false
 }
 
 func (ch *channel) setRpnFine(value int32) {
 	ch.rpn = int16((int32(ch.rpn) & 0xFF80) | value)
+	ch.nrpnSelected = false
 }
 
 func (ch *channel) dataEntryCoarse(value int32) {
+	if ch.nrpnSelected {
+		target := ch.getNrpnTarget()
+		if target != nil {
+			*target = byte(value)
+		}
+		return
+	}
+
 	switch ch.rpn {
 	case 0:
 		ch.pitchBendRange = int16((int32(ch.pitchBendRange) & 0x7F) | (value << 7))
+		ch.modulatorSerial++
 	case 1:
 		ch.fineTune = int16((int32(ch.fineTune) & 0x7F) | (value << 7))
 	case 2:
 		ch.coarseTune = int16(value - 64)
+	case 3:
+		ch.setTuningProgram(value)
+	case 4:
+		ch.setTuningBank(value)
 	}
 }
 
 func (ch *channel) dataEntryFine(value int32) {
+	// The NRPN parameters of GS/XG only use the coarse value.
+	if ch.nrpnSelected {
+		return
+	}
+
 	switch ch.rpn {
 	case 0:
 		ch.pitchBendRange = int16((int32(ch.pitchBendRange) & 0xFF80) | value)
+		ch.modulatorSerial++
 	case 1:
 		ch.fineTune = int16((int32(ch.fineTune) & 0xFF80) | value)
 	}
@@ -157,6 +305,7 @@ func (ch *channel) dataEntryFine(value int32) {
 
 func (ch *channel) setPitchBend(value1 int32, value2 int32) {
 	ch.pitchBend = (float32(1) / float32(8192)) * float32((value1|(value2<<7))-8192)
+	ch.modulatorSerial++
 }
 
 func (ch *channel) getModulation() float32 {
@@ -0,0 +1,29 @@
+package meltysynth
+
+// Queues the MIDI message to be processed at the beginning of the next Render call.
+// Unlike the other methods, this method can be called from any goroutine while rendering.
+// It never blocks, and returns false if the queue is full.
+func (s *Synthesizer) EnqueueMidiMessage(channel int32, command int32, data1 int32, data2 int32) bool {
+	return s.EnqueueMidiMessageAt(0, channel, command, data1, data2)
+}
+
+// Queues the MIDI message to be processed at the given sample offset from the beginning of the next Render call.
+// See ProcessMidiMessageAt for the details of the offset.
+func (s *Synthesizer) EnqueueMidiMessageAt(offset int32, channel int32, command int32, data1 int32, data2 int32) bool {
+	select {
+	case s.commands <- scheduledMessage{offset: offset, channel: channel, command: command, data1: data1, data2: data2}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Moves the queued messages to the scheduled ones without blocking.
+// Only the messages queued before the call are processed, so that the producers cannot stall the rendering.
+func (s *Synthesizer) processCommands() {
+	count := len(s.commands)
+	for i := 0; i < count; i++ {
+		msg := <-s.commands
+		s.ProcessMidiMessageAt(msg.offset, msg.channel, msg.command, msg.data1, msg.data2)
+	}
+}
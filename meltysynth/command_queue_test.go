@@ -0,0 +1,70 @@
+package meltysynth
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSynthesizer_EnqueueMidiMessage(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.MaximumPolyphony = 256
+	}, 0)
+
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+
+	// The producers run while the audio goroutine is rendering.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(channel int32) {
+			defer wg.Done()
+			for key := int32(0); key < 16; key++ {
+				for !synthesizer.EnqueueMidiMessage(channel, 0x90, 40+key, 100) {
+				}
+			}
+		}(int32(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for rendering := true; rendering; {
+		select {
+		case <-done:
+			rendering = false
+		default:
+		}
+		synthesizer.Render(left, right)
+	}
+
+	if synthesizer.voices.activeVoiceCount != 64 {
+		t.Errorf("expected 64 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+}
+
+func TestSynthesizer_EnqueueMidiMessage_Full(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.CommandQueueSize = 16
+	}, 0)
+
+	for i := int32(0); i < 16; i++ {
+		if !synthesizer.EnqueueMidiMessage(0, 0x90, 40+i, 100) {
+			t.Fatal("the message should be queued")
+		}
+	}
+	if synthesizer.EnqueueMidiMessage(0, 0x90, 60, 100) {
+		t.Error("the full queue should reject the message")
+	}
+
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+	synthesizer.Render(left, right)
+	if synthesizer.voices.activeVoiceCount != 16 {
+		t.Errorf("expected 16 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+	if !synthesizer.EnqueueMidiMessage(0, 0x90, 60, 100) {
+		t.Error("the queue should be available after rendering")
+	}
+}
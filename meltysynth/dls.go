@@ -0,0 +1,370 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The sample information of the wsmp chunk.
+type dlsSampleInfo struct {
+	unityNote   uint16
+	fineTune    int16
+	attenuation int32
+	looped      bool
+	loopType    uint32
+	loopStart   uint32
+	loopLength  uint32
+}
+
+type dlsWave struct {
+	offset int // The position in the wave pool, which is referred by the pool table.
+	sample *SampleHeader
+	info   *dlsSampleInfo
+}
+
+// Reads the DLS Level 1 or 2 collection and converts it to a SoundFont.
+// Each DLS instrument becomes a preset with an instrument of the same name.
+// Only the first channel of the multi-channel waves is used.
+func NewSoundFontFromDLS(r io.Reader) (*SoundFont, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].id != "RIFF" {
+		return nil, errors.New("the riff chunk was not found")
+	}
+	if chunks[0].listType != "DLS " {
+		return nil, fmt.Errorf(`the type of the riff chunk must be "DLS ", but was %q`, chunks[0].listType)
+	}
+
+	chunks, err = readRiffChunks(chunks[0].data)
+	if err != nil {
+		return nil, err
+	}
+
+	info := findRiffList(chunks, "INFO")
+	builder := NewSoundFontBuilder(readRiffInfoString(info, "INAM"))
+	builder.Info().Copyright = readRiffInfoString(info, "ICOP")
+	builder.Info().Comments = readRiffInfoString(info, "ICMT")
+	builder.Info().CreationDate = readRiffInfoString(info, "ICRD")
+	builder.Info().Auther = readRiffInfoString(info, "IENG")
+	builder.Info().Tools = readRiffInfoString(info, "ISFT")
+
+	waves, err := readDlsWavePool(builder, chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	ptbl := findRiffChunk(chunks, "ptbl")
+	if ptbl == nil || len(ptbl.data) < 8 {
+		return nil, errors.New("the ptbl chunk was not found")
+	}
+	cueOffset := int(binary.LittleEndian.Uint32(ptbl.data[0:]))
+	cueCount := int(binary.LittleEndian.Uint32(ptbl.data[4:]))
+	if cueOffset < 8 || cueOffset > len(ptbl.data) || cueCount > (len(ptbl.data)-cueOffset)/4 {
+		return nil, errors.New("the pool table is invalid")
+	}
+	cues := make([]*dlsWave, cueCount)
+	for i := 0; i < cueCount; i++ {
+		offset := int(binary.LittleEndian.Uint32(ptbl.data[cueOffset+4*i:]))
+		for _, wave := range waves {
+			if wave.offset == offset {
+				cues[i] = wave
+				break
+			}
+		}
+	}
+
+	lins := findRiffList(chunks, "lins")
+	if lins == nil {
+		return nil, errors.New("the instrument list was not found")
+	}
+	instrumentChunks, err := readRiffChunks(lins.data)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range instrumentChunks {
+		if chunk.id == "LIST" && chunk.listType == "ins " {
+			err = readDlsInstrument(builder, chunk.data, cues)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return builder.Build()
+}
+
+func readDlsWavePool(builder *SoundFontBuilder, chunks []riffChunk) ([]*dlsWave, error) {
+	wvpl := findRiffList(chunks, "wvpl")
+	if wvpl == nil {
+		return nil, errors.New("the wave pool was not found")
+	}
+	waveChunks, err := readRiffChunks(wvpl.data)
+	if err != nil {
+		return nil, err
+	}
+
+	var waves []*dlsWave
+	for _, chunk := range waveChunks {
+		if chunk.listType != "wave" {
+			continue
+		}
+
+		subChunks, err := readRiffChunks(chunk.data)
+		if err != nil {
+			return nil, err
+		}
+
+		name := readRiffInfoString(findRiffList(subChunks, "INFO"), "INAM")
+		samples, sampleRate, err := readWaveSamples(subChunks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the wave %q: %v", name, err)
+		}
+
+		wave := new(dlsWave)
+		// The offsets in the pool table are relative to the data after the list type of the wave pool.
+		wave.offset = chunk.offset
+
+		wave.info = readDlsSampleInfo(findRiffChunk(subChunks, "wsmp"))
+		if wave.info == nil {
+			wave.info = &dlsSampleInfo{unityNote: 60}
+		}
+
+		wave.sample = builder.AddSample(name, samples, sampleRate, uint8(wave.info.unityNote&0x7F))
+		wave.sample.PitchCorrection = int8(calcClamp(float32(wave.info.fineTune), -99, 99))
+		if wave.info.looped {
+			// The invalid loop is ignored and the whole sample is looped.
+			builder.SetSampleLoop(wave.sample, int32(wave.info.loopStart), int32(wave.info.loopStart+wave.info.loopLength))
+		}
+
+		waves = append(waves, wave)
+	}
+
+	return waves, nil
+}
+
+// Reads the PCM samples from the chunks of the fmt and data.
+// Only the first channel is used, and the samples are converted to 16 bits.
+func readWaveSamples(chunks []riffChunk) ([]int16, int32, error) {
+	format := findRiffChunk(chunks, "fmt ")
+	if format == nil || len(format.data) < 16 {
+		return nil, 0, errors.New("the fmt chunk was not found")
+	}
+	data := findRiffChunk(chunks, "data")
+	if data == nil {
+		return nil, 0, errors.New("the data chunk was not found")
+	}
+
+	formatTag := binary.LittleEndian.Uint16(format.data[0:])
+	channelCount := int(binary.LittleEndian.Uint16(format.data[2:]))
+	sampleRate := int32(binary.LittleEndian.Uint32(format.data[4:]))
+	blockAlign := int(binary.LittleEndian.Uint16(format.data[12:]))
+	bitsPerSample := int(binary.LittleEndian.Uint16(format.data[14:]))
+
+	// The extensible format is regarded as PCM.
+	if formatTag != 1 && formatTag != 0xFFFE {
+		return nil, 0, fmt.Errorf("the format %d is not supported", formatTag)
+	}
+	if channelCount < 1 {
+		return nil, 0, errors.New("the number of channels must be greater than zero")
+	}
+
+	// The samples may be stored in the larger containers, such as the 24-bit samples in 32 bits,
+	// so the size is taken from the block alignment if it is consistent.
+	bytesPerSample := blockAlign / channelCount
+	if bytesPerSample*channelCount != blockAlign {
+		bytesPerSample = (bitsPerSample + 7) / 8
+	}
+	if bytesPerSample < 1 || bytesPerSample > 4 {
+		return nil, 0, fmt.Errorf("%d bits per sample is not supported", bitsPerSample)
+	}
+
+	frameSize := bytesPerSample * channelCount
+	samples := make([]int16, len(data.data)/frameSize)
+	for i := 0; i < len(samples); i++ {
+		frame := data.data[frameSize*i:]
+		switch bytesPerSample {
+		case 1:
+			// The 8-bit samples are unsigned.
+			samples[i] = int16(int32(frame[0])-128) << 8
+		default:
+			// The most significant 16 bits are used.
+			samples[i] = int16(binary.LittleEndian.Uint16(frame[bytesPerSample-2:]))
+		}
+	}
+
+	return samples, sampleRate, nil
+}
+
+func readDlsSampleInfo(chunk *riffChunk) *dlsSampleInfo {
+	if chunk == nil || len(chunk.data) < 20 {
+		return nil
+	}
+
+	data := chunk.data
+	info := new(dlsSampleInfo)
+	size := int(binary.LittleEndian.Uint32(data[0:]))
+	info.unityNote = binary.LittleEndian.Uint16(data[4:])
+	info.fineTune = int16(binary.LittleEndian.Uint16(data[6:]))
+	info.attenuation = int32(binary.LittleEndian.Uint32(data[8:]))
+	loopCount := binary.LittleEndian.Uint32(data[16:])
+
+	// Only the first loop is used.
+	if loopCount > 0 && size >= 20 && size+16 <= len(data) {
+		loop := data[size:]
+		info.looped = true
+		info.loopType = binary.LittleEndian.Uint32(loop[4:])
+		info.loopStart = binary.LittleEndian.Uint32(loop[8:])
+		info.loopLength = binary.LittleEndian.Uint32(loop[12:])
+	}
+
+	return info
+}
+
+func readDlsInstrument(builder *SoundFontBuilder, data []byte, cues []*dlsWave) error {
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return err
+	}
+
+	name := readRiffInfoString(findRiffList(chunks, "INFO"), "INAM")
+
+	insh := findRiffChunk(chunks, "insh")
+	if insh == nil || len(insh.data) < 12 {
+		return fmt.Errorf("the instrument %q has no header", name)
+	}
+	bank := binary.LittleEndian.Uint32(insh.data[4:])
+	patch := binary.LittleEndian.Uint32(insh.data[8:])
+
+	// The drum instruments are mapped to the bank 128, as is the case with GM SoundFonts.
+	bankNumber := int32((bank >> 8) & 0x7F)
+	if bank&0x80000000 != 0 {
+		bankNumber = 128
+	}
+
+	instrument := builder.AddInstrument(name)
+	preset := builder.AddPreset(name, int32(patch&0x7F), bankNumber)
+	preset.AddRegion(instrument)
+
+	// The articulation of the region replaces the one of the instrument.
+	globalConnections := readDlsArticulation(chunks)
+
+	lrgn := findRiffList(chunks, "lrgn")
+	if lrgn == nil {
+		return nil
+	}
+	regionChunks, err := readRiffChunks(lrgn.data)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range regionChunks {
+		if chunk.id != "LIST" || (chunk.listType != "rgn " && chunk.listType != "rgn2") {
+			continue
+		}
+		err = readDlsRegion(instrument, chunk.data, cues, globalConnections)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readDlsArticulation(chunks []riffChunk) []dlsConnection {
+	var connections []dlsConnection
+	for _, listType := range []string{"lart", "lar2"} {
+		list := findRiffList(chunks, listType)
+		if list == nil {
+			continue
+		}
+		artChunks, err := readRiffChunks(list.data)
+		if err != nil {
+			continue
+		}
+		for _, chunk := range artChunks {
+			if chunk.id == "art1" || chunk.id == "art2" {
+				connections = append(connections, readDlsConnections(chunk.data)...)
+			}
+		}
+	}
+	return connections
+}
+
+func readDlsRegion(instrument *Instrument, data []byte, cues []*dlsWave, globalConnections []dlsConnection) error {
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return err
+	}
+
+	rgnh := findRiffChunk(chunks, "rgnh")
+	wlnk := findRiffChunk(chunks, "wlnk")
+	if rgnh == nil || len(rgnh.data) < 12 || wlnk == nil || len(wlnk.data) < 12 {
+		return fmt.Errorf("the instrument %q contains an invalid region", instrument.Name)
+	}
+
+	index := int(binary.LittleEndian.Uint32(wlnk.data[8:]))
+	if index >= len(cues) || cues[index] == nil {
+		return fmt.Errorf("the instrument %q refers to a wave not in the collection", instrument.Name)
+	}
+	wave := cues[index]
+
+	region := instrument.AddRegion(wave.sample)
+	region.SetKeyRange(int32(binary.LittleEndian.Uint16(rgnh.data[0:])), int32(binary.LittleEndian.Uint16(rgnh.data[2:])))
+	region.SetVelocityRange(int32(binary.LittleEndian.Uint16(rgnh.data[4:])), int32(binary.LittleEndian.Uint16(rgnh.data[6:])))
+	region.gs[gen_ExclusiveClass] = int16(binary.LittleEndian.Uint16(rgnh.data[10:]))
+
+	// DLS Level 1 does not support the velocity range, and some files leave it zero.
+	if region.gs[gen_VelocityRange] == 0 {
+		region.SetVelocityRange(0, 127)
+	}
+
+	connections := readDlsArticulation(chunks)
+	if connections == nil {
+		connections = globalConnections
+	}
+	applyDlsConnections(region, connections)
+
+	// The sample information of the region overrides the one of the wave.
+	info := readDlsSampleInfo(findRiffChunk(chunks, "wsmp"))
+	if info == nil {
+		info = wave.info
+	} else {
+		if int32(info.unityNote) != int32(wave.info.unityNote) {
+			region.gs[gen_OverridingRootKey] = int16(info.unityNote & 0x7F)
+		}
+		region.gs[gen_FineTune] += info.fineTune - int16(wave.sample.PitchCorrection)
+	}
+	region.gs[gen_InitialAttenuation] -= int16(info.attenuation / 65536)
+
+	if info.looped {
+		region.gs[gen_SampleModes] = int16(loop_Continuous)
+		if info.loopType == 1 {
+			// The loop and release.
+			region.gs[gen_SampleModes] = int16(loop_LoopUntilNoteOff)
+		}
+
+		sample := wave.sample
+		startLoop := sample.Start + int32(info.loopStart)
+		endLoop := startLoop + int32(info.loopLength)
+		if sample.Start <= startLoop && startLoop < endLoop && endLoop <= sample.End {
+			setAddressOffset(region, gen_StartLoopAddressOffset, gen_StartLoopAddressCoarseOffset, startLoop-sample.StartLoop)
+			setAddressOffset(region, gen_EndLoopAddressOffset, gen_EndLoopAddressCoarseOffset, endLoop-sample.EndLoop)
+		}
+	}
+
+	return nil
+}
+
+// Splits the offset into the fine and coarse generators, where the coarse one is in 32768 samples.
+func setAddressOffset(region *InstrumentRegion, fine uint16, coarse uint16, offset int32) {
+	region.gs[fine] = int16(offset % 32768)
+	region.gs[coarse] = int16(offset / 32768)
+}
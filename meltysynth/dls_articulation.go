@@ -0,0 +1,224 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	connSrc_None          uint16 = 0x0000
+	connSrc_Lfo           uint16 = 0x0001
+	connSrc_KeyOnVelocity uint16 = 0x0002
+	connSrc_KeyNumber     uint16 = 0x0003
+	connSrc_Eg1           uint16 = 0x0004
+	connSrc_Eg2           uint16 = 0x0005
+	connSrc_PitchWheel    uint16 = 0x0006
+	connSrc_Vibrato       uint16 = 0x0009
+)
+
+const (
+	connDst_None            uint16 = 0x0000
+	connDst_Gain            uint16 = 0x0001
+	connDst_Pitch           uint16 = 0x0003
+	connDst_Pan             uint16 = 0x0004
+	connDst_Chorus          uint16 = 0x0080
+	connDst_Reverb          uint16 = 0x0081
+	connDst_LfoFrequency    uint16 = 0x0104
+	connDst_LfoStartDelay   uint16 = 0x0105
+	connDst_VibFrequency    uint16 = 0x0114
+	connDst_VibStartDelay   uint16 = 0x0115
+	connDst_Eg1AttackTime   uint16 = 0x0206
+	connDst_Eg1DecayTime    uint16 = 0x0207
+	connDst_Eg1ReleaseTime  uint16 = 0x0209
+	connDst_Eg1SustainLevel uint16 = 0x020A
+	connDst_Eg1DelayTime    uint16 = 0x020B
+	connDst_Eg1HoldTime     uint16 = 0x020C
+	connDst_Eg2AttackTime   uint16 = 0x030A
+	connDst_Eg2DecayTime    uint16 = 0x030B
+	connDst_Eg2ReleaseTime  uint16 = 0x030D
+	connDst_Eg2SustainLevel uint16 = 0x030E
+	connDst_Eg2DelayTime    uint16 = 0x030F
+	connDst_Eg2HoldTime     uint16 = 0x0310
+	connDst_FilterCutoff    uint16 = 0x0500
+	connDst_FilterQ         uint16 = 0x0501
+)
+
+// The connection block of the art1 and art2 chunks.
+type dlsConnection struct {
+	source      uint16
+	control     uint16
+	destination uint16
+	transform   uint16
+	scale       int32
+}
+
+func readDlsConnections(data []byte) []dlsConnection {
+	if len(data) < 8 {
+		return nil
+	}
+
+	// The connection blocks follow the header, whose size is given by the first field.
+	headerSize := int(binary.LittleEndian.Uint32(data[0:]))
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	if headerSize < 8 || headerSize > len(data) || count > (len(data)-headerSize)/12 {
+		return nil
+	}
+
+	connections := make([]dlsConnection, count)
+	for i := 0; i < count; i++ {
+		block := data[headerSize+12*i:]
+		connections[i] = dlsConnection{
+			source:      binary.LittleEndian.Uint16(block[0:]),
+			control:     binary.LittleEndian.Uint16(block[2:]),
+			destination: binary.LittleEndian.Uint16(block[4:]),
+			transform:   binary.LittleEndian.Uint16(block[6:]),
+			scale:       int32(binary.LittleEndian.Uint32(block[8:])),
+		}
+	}
+
+	return connections
+}
+
+// Maps the connections to the generators of the region.
+// The connections which have no corresponding generator, such as the ones controlled by MIDI controllers,
+// are ignored, since the default modulators of SoundFont cover the typical ones.
+func applyDlsConnections(region *InstrumentRegion, connections []dlsConnection) {
+	// The time changed by the key number at the key 60, which is added after the constants are set.
+	keyNumberOffsets := make(map[uint16]float64)
+
+	for _, connection := range connections {
+		if connection.control != connSrc_None {
+			continue
+		}
+
+		// The values are stored as 16.16 fixed-point numbers.
+		value := float64(connection.scale) / 65536
+
+		switch connection.source {
+		case connSrc_None:
+			applyDlsConstant(region, connection.destination, value)
+		case connSrc_Lfo:
+			switch connection.destination {
+			case connDst_Pitch:
+				setDlsGenerator(region, gen_ModulationLfoToPitch, value)
+			case connDst_Gain:
+				setDlsGenerator(region, gen_ModulationLfoToVolume, value)
+			case connDst_FilterCutoff:
+				setDlsGenerator(region, gen_ModulationLfoToFilterCutoffFrequency, value)
+			}
+		case connSrc_Vibrato:
+			if connection.destination == connDst_Pitch {
+				setDlsGenerator(region, gen_VibratoLfoToPitch, value)
+			}
+		case connSrc_Eg2:
+			switch connection.destination {
+			case connDst_Pitch:
+				setDlsGenerator(region, gen_ModulationEnvelopeToPitch, value)
+			case connDst_FilterCutoff:
+				setDlsGenerator(region, gen_ModulationEnvelopeToFilterCutoffFrequency, value)
+			}
+		case connSrc_KeyNumber:
+			// The key number is normalized to 0-1 in DLS, while SoundFont uses the offset from the key 60.
+			// For the envelope times, the key 60 is subtracted first, and the rest goes to the base time.
+			switch connection.destination {
+			case connDst_Pitch:
+				setDlsGenerator(region, gen_ScaleTuning, value/128)
+			case connDst_Eg1HoldTime:
+				setDlsGenerator(region, gen_KeyNumberToVolumeEnvelopeHold, -value/128)
+				keyNumberOffsets[gen_HoldVolumeEnvelope] += value * 60 / 128
+			case connDst_Eg1DecayTime:
+				setDlsGenerator(region, gen_KeyNumberToVolumeEnvelopeDecay, -value/128)
+				keyNumberOffsets[gen_DecayVolumeEnvelope] += value * 60 / 128
+			case connDst_Eg2HoldTime:
+				setDlsGenerator(region, gen_KeyNumberToModulationEnvelopeHold, -value/128)
+				keyNumberOffsets[gen_HoldModulationEnvelope] += value * 60 / 128
+			case connDst_Eg2DecayTime:
+				setDlsGenerator(region, gen_KeyNumberToModulationEnvelopeDecay, -value/128)
+				keyNumberOffsets[gen_DecayModulationEnvelope] += value * 60 / 128
+			}
+		}
+	}
+
+	for generatorType, offset := range keyNumberOffsets {
+		setDlsGenerator(region, generatorType, float64(region.gs[generatorType])+offset)
+	}
+}
+
+func applyDlsConstant(region *InstrumentRegion, destination uint16, value float64) {
+	switch destination {
+	case connDst_Gain:
+		setDlsGenerator(region, gen_InitialAttenuation, -value)
+	case connDst_Pitch:
+		cents := int32(math.Round(value))
+		setDlsGenerator(region, gen_CoarseTune, float64(cents/100))
+		setDlsGenerator(region, gen_FineTune, float64(cents%100))
+	case connDst_Pan:
+		setDlsGenerator(region, gen_Pan, value)
+	case connDst_Chorus:
+		setDlsGenerator(region, gen_ChorusEffectsSend, value)
+	case connDst_Reverb:
+		setDlsGenerator(region, gen_ReverbEffectsSend, value)
+	case connDst_LfoFrequency:
+		setDlsGenerator(region, gen_FrequencyModulationLfo, value)
+	case connDst_LfoStartDelay:
+		setDlsGenerator(region, gen_DelayModulationLfo, value)
+	case connDst_VibFrequency:
+		setDlsGenerator(region, gen_FrequencyVibratoLfo, value)
+	case connDst_VibStartDelay:
+		setDlsGenerator(region, gen_DelayVibratoLfo, value)
+	case connDst_Eg1DelayTime:
+		setDlsGenerator(region, gen_DelayVolumeEnvelope, value)
+	case connDst_Eg1AttackTime:
+		setDlsGenerator(region, gen_AttackVolumeEnvelope, value)
+	case connDst_Eg1HoldTime:
+		setDlsGenerator(region, gen_HoldVolumeEnvelope, value)
+	case connDst_Eg1DecayTime:
+		setDlsGenerator(region, gen_DecayVolumeEnvelope, value)
+	case connDst_Eg1SustainLevel:
+		// DLS uses the level in 0.1%, while SoundFont uses the attenuation in centibels.
+		level := value / 1000
+		if level > 0 {
+			setDlsGenerator(region, gen_SustainVolumeEnvelope, -200*math.Log10(level))
+		} else {
+			setDlsGenerator(region, gen_SustainVolumeEnvelope, 1440)
+		}
+	case connDst_Eg1ReleaseTime:
+		setDlsGenerator(region, gen_ReleaseVolumeEnvelope, value)
+	case connDst_Eg2DelayTime:
+		setDlsGenerator(region, gen_DelayModulationEnvelope, value)
+	case connDst_Eg2AttackTime:
+		setDlsGenerator(region, gen_AttackModulationEnvelope, value)
+	case connDst_Eg2HoldTime:
+		setDlsGenerator(region, gen_HoldModulationEnvelope, value)
+	case connDst_Eg2DecayTime:
+		setDlsGenerator(region, gen_DecayModulationEnvelope, value)
+	case connDst_Eg2SustainLevel:
+		// SoundFont uses the decrease from the peak in 0.1%.
+		setDlsGenerator(region, gen_SustainModulationEnvelope, 1000-value)
+	case connDst_Eg2ReleaseTime:
+		setDlsGenerator(region, gen_ReleaseModulationEnvelope, value)
+	case connDst_FilterCutoff:
+		setDlsGenerator(region, gen_InitialFilterCutoffFrequency, value)
+	case connDst_FilterQ:
+		setDlsGenerator(region, gen_InitialFilterQ, value)
+	}
+}
+
+// The time of 0x80000000 means zero seconds in DLS, which is rounded down to the minimum of SoundFont.
+func setDlsGenerator(region *InstrumentRegion, generatorType uint16, value float64) {
+	if value < -12000 && isDlsTimeGenerator(generatorType) {
+		value = -12000
+	}
+	setClampedGenerator(region, generatorType, value)
+}
+
+func isDlsTimeGenerator(generatorType uint16) bool {
+	switch generatorType {
+	case gen_DelayModulationLfo, gen_DelayVibratoLfo,
+		gen_DelayVolumeEnvelope, gen_AttackVolumeEnvelope, gen_HoldVolumeEnvelope, gen_DecayVolumeEnvelope, gen_ReleaseVolumeEnvelope,
+		gen_DelayModulationEnvelope, gen_AttackModulationEnvelope, gen_HoldModulationEnvelope, gen_DecayModulationEnvelope, gen_ReleaseModulationEnvelope:
+		return true
+	default:
+		return false
+	}
+}
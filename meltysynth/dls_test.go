@@ -0,0 +1,200 @@
+package meltysynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func createRiffChunk(id string, data ...[]byte) []byte {
+	var body bytes.Buffer
+	for _, d := range data {
+		body.Write(d)
+	}
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	binary.Write(&chunk, binary.LittleEndian, uint32(body.Len()))
+	chunk.Write(body.Bytes())
+	if body.Len()%2 != 0 {
+		chunk.WriteByte(0)
+	}
+	return chunk.Bytes()
+}
+
+func createRiffList(id string, listType string, data ...[]byte) []byte {
+	return createRiffChunk(id, append([][]byte{[]byte(listType)}, data...)...)
+}
+
+func littleEndianBytes(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, value := range values {
+		binary.Write(&buf, binary.LittleEndian, value)
+	}
+	return buf.Bytes()
+}
+
+func createDlsInfo(name string) []byte {
+	return createRiffList("LIST", "INFO", createRiffChunk("INAM", []byte(name+"\x00")))
+}
+
+func createTestDls() []byte {
+	samples := make([]int16, 1000)
+	for i := 0; i < len(samples); i++ {
+		samples[i] = int16(10000 * (i%100 - 50) / 50)
+	}
+
+	// The wave with a loop, and a wave with 8-bit samples.
+	wave1 := createRiffList("LIST", "wave",
+		createRiffChunk("fmt ", littleEndianBytes(uint16(1), uint16(1), uint32(22050), uint32(44100), uint16(2), uint16(16))),
+		createRiffChunk("wsmp", littleEndianBytes(uint32(20), uint16(69), int16(-10), int32(0), uint32(0), uint32(1), uint32(16), uint32(0), uint32(100), uint32(800))),
+		createRiffChunk("data", littleEndianBytes(samples)),
+		createDlsInfo("saw"))
+	wave2 := createRiffList("LIST", "wave",
+		createRiffChunk("fmt ", littleEndianBytes(uint16(1), uint16(1), uint32(44100), uint32(44100), uint16(1), uint16(8))),
+		createRiffChunk("data", []byte{128, 255, 0, 128}),
+		createDlsInfo("click"))
+
+	art := createRiffList("LIST", "lart",
+		createRiffChunk("art1", littleEndianBytes(uint32(8), uint32(2),
+			uint16(connSrc_None), uint16(connSrc_None), uint16(connDst_Eg1AttackTime), uint16(0), int32(-1200*65536),
+			uint16(connSrc_None), uint16(connSrc_None), uint16(connDst_Eg1SustainLevel), uint16(0), int32(500*65536))))
+
+	// The melodic instrument in the bank 1, whose second region overrides the loop.
+	ins1 := createRiffList("LIST", "ins ",
+		createRiffChunk("insh", littleEndianBytes(uint32(2), uint32(1<<8), uint32(5))),
+		createRiffList("LIST", "lrgn",
+			createRiffList("LIST", "rgn ",
+				createRiffChunk("rgnh", littleEndianBytes(uint16(0), uint16(59), uint16(0), uint16(127), uint16(0), uint16(0))),
+				createRiffChunk("wlnk", littleEndianBytes(uint16(0), uint16(0), uint32(1), uint32(0)))),
+			createRiffList("LIST", "rgn ",
+				createRiffChunk("rgnh", littleEndianBytes(uint16(60), uint16(127), uint16(0), uint16(0), uint16(0), uint16(0))),
+				createRiffChunk("wsmp", littleEndianBytes(uint32(20), uint16(60), int16(0), int32(-100*65536), uint32(0), uint32(1), uint32(16), uint32(1), uint32(200), uint32(400))),
+				createRiffChunk("wlnk", littleEndianBytes(uint16(0), uint16(0), uint32(1), uint32(0))))),
+		art,
+		createDlsInfo("lead"))
+
+	// The drum instrument.
+	ins2 := createRiffList("LIST", "ins ",
+		createRiffChunk("insh", littleEndianBytes(uint32(1), uint32(0x80000000), uint32(0))),
+		createRiffList("LIST", "lrgn",
+			createRiffList("LIST", "rgn ",
+				createRiffChunk("rgnh", littleEndianBytes(uint16(36), uint16(36), uint16(0), uint16(127), uint16(0), uint16(1))),
+				createRiffChunk("wlnk", littleEndianBytes(uint16(0), uint16(0), uint32(1), uint32(1))))),
+		createDlsInfo("drums"))
+
+	return createRiffList("RIFF", "DLS ",
+		createRiffChunk("colh", littleEndianBytes(uint32(2))),
+		createRiffList("LIST", "lins", ins1, ins2),
+		createRiffChunk("ptbl", littleEndianBytes(uint32(8), uint32(2), uint32(0), uint32(len(wave1)))),
+		createRiffList("LIST", "wvpl", wave1, wave2),
+		createDlsInfo("test collection"))
+}
+
+func TestSoundFontFromDLS(t *testing.T) {
+	soundFont, err := NewSoundFontFromDLS(bytes.NewReader(createTestDls()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if soundFont.Info.BankName != "test collection" {
+		t.Errorf("unexpected bank name %q", soundFont.Info.BankName)
+	}
+	if len(soundFont.Presets) != 2 || len(soundFont.Instruments) != 2 || len(soundFont.SampleHeaders) != 2 {
+		t.Fatalf("unexpected number of presets, instruments or samples")
+	}
+
+	lead := soundFont.Presets[0]
+	if lead.Name != "lead" || lead.BankNumber != 1 || lead.PatchNumber != 5 {
+		t.Errorf("unexpected preset %q %d:%d", lead.Name, lead.BankNumber, lead.PatchNumber)
+	}
+	drums := soundFont.Presets[1]
+	if drums.BankNumber != 128 || drums.PatchNumber != 0 {
+		t.Errorf("unexpected drum preset %d:%d", drums.BankNumber, drums.PatchNumber)
+	}
+
+	saw := soundFont.SampleHeaders[0]
+	if saw.SampleRate != 22050 || saw.OriginalPitch != 69 || saw.PitchCorrection != -10 {
+		t.Errorf("unexpected sample header %+v", *saw)
+	}
+	if saw.StartLoop-saw.Start != 100 || saw.EndLoop-saw.Start != 900 {
+		t.Errorf("unexpected loop %d-%d", saw.StartLoop-saw.Start, saw.EndLoop-saw.Start)
+	}
+	click := soundFont.SampleHeaders[1]
+	if click.End-click.Start != 4 || soundFont.WaveData[click.Start+1] != 127<<8 || soundFont.WaveData[click.Start+2] != -128<<8 {
+		t.Errorf("the 8-bit samples were not converted")
+	}
+
+	regions := soundFont.Instruments[0].Regions
+	if len(regions) != 2 {
+		t.Fatalf("expected 2 regions, but got %d", len(regions))
+	}
+	if regions[0].GetKeyRangeEnd() != 59 || regions[0].GetSampleModes() != loop_Continuous {
+		t.Errorf("unexpected first region")
+	}
+	if regions[0].GetAttackVolumeEnvelope() != 0.5 {
+		t.Errorf("the attack time was not converted: %f", regions[0].GetAttackVolumeEnvelope())
+	}
+	if regions[0].gs[gen_SustainVolumeEnvelope] != 60 {
+		t.Errorf("the sustain level was not converted: %d", regions[0].gs[gen_SustainVolumeEnvelope])
+	}
+	if regions[1].GetSampleModes() != loop_LoopUntilNoteOff || regions[1].GetRootKey() != 60 || regions[1].gs[gen_FineTune] != 10 {
+		t.Errorf("the sample information of the region was not applied")
+	}
+	if regions[1].GetSampleStartLoop()-saw.Start != 200 || regions[1].GetSampleEndLoop()-saw.Start != 600 {
+		t.Errorf("unexpected region loop %d-%d", regions[1].GetSampleStartLoop()-saw.Start, regions[1].GetSampleEndLoop()-saw.Start)
+	}
+	if regions[1].gs[gen_InitialAttenuation] != 100 {
+		t.Errorf("the attenuation was not applied: %d", regions[1].gs[gen_InitialAttenuation])
+	}
+	if soundFont.Instruments[1].Regions[0].GetExclusiveClass() != 1 {
+		t.Errorf("the key group was not converted")
+	}
+
+	x := renderTestNotes(t, soundFont)
+	silent := true
+	for _, value := range x {
+		if value != 0 {
+			silent = false
+		}
+	}
+	if silent {
+		t.Error("the converted SoundFont did not make any sound")
+	}
+}
+
+func TestReadWaveSamples_Container(t *testing.T) {
+	// The 24-bit stereo samples stored in 32 bits.
+	data := littleEndianBytes(int32(0x12345600), int32(-1), int32(-0x7FFFFF00), int32(0))
+	chunks := []riffChunk{
+		{id: "fmt ", data: littleEndianBytes(uint16(0xFFFE), uint16(2), uint32(44100), uint32(352800), uint16(8), uint16(24))},
+		{id: "data", data: data},
+	}
+
+	samples, sampleRate, err := readWaveSamples(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("unexpected sample rate %d", sampleRate)
+	}
+	if len(samples) != 2 || samples[0] != 0x1234 || samples[1] != -0x8000 {
+		t.Errorf("the samples in the 32-bit containers were not converted: %v", samples)
+	}
+}
+
+func TestApplyDlsConnections_KeyNumber(t *testing.T) {
+	region := NewInstrumentRegion(nil)
+
+	// The hold time is 1 second at the key 0, and 10 timecents longer for each key.
+	applyDlsConnections(region, []dlsConnection{
+		{source: connSrc_KeyNumber, destination: connDst_Eg1HoldTime, scale: 1280 * 65536},
+		{source: connSrc_None, destination: connDst_Eg1HoldTime, scale: 0},
+	})
+
+	if region.gs[gen_KeyNumberToVolumeEnvelopeHold] != -10 {
+		t.Errorf("unexpected key number scaling %d", region.gs[gen_KeyNumberToVolumeEnvelopeHold])
+	}
+	if region.gs[gen_HoldVolumeEnvelope] != 600 {
+		t.Errorf("the hold time at the key 60 should be 600, but was %d", region.gs[gen_HoldVolumeEnvelope])
+	}
+}
@@ -63,3 +63,135 @@ const (
 	gen_Unused5                                   uint16 = 59
 	gen_UnusedEnd                                 uint16 = 60
 )
+
+// Specifies the generator of the instrument and preset regions, as defined in the SoundFont spec.
+// The unused and reserved generators are not listed.
+type GeneratorType uint16
+
+const (
+	GeneratorStartAddressOffset                        GeneratorType = GeneratorType(gen_StartAddressOffset)
+	GeneratorEndAddressOffset                          GeneratorType = GeneratorType(gen_EndAddressOffset)
+	GeneratorStartLoopAddressOffset                    GeneratorType = GeneratorType(gen_StartLoopAddressOffset)
+	GeneratorEndLoopAddressOffset                      GeneratorType = GeneratorType(gen_EndLoopAddressOffset)
+	GeneratorStartAddressCoarseOffset                  GeneratorType = GeneratorType(gen_StartAddressCoarseOffset)
+	GeneratorModulationLfoToPitch                      GeneratorType = GeneratorType(gen_ModulationLfoToPitch)
+	GeneratorVibratoLfoToPitch                         GeneratorType = GeneratorType(gen_VibratoLfoToPitch)
+	GeneratorModulationEnvelopeToPitch                 GeneratorType = GeneratorType(gen_ModulationEnvelopeToPitch)
+	GeneratorInitialFilterCutoffFrequency              GeneratorType = GeneratorType(gen_InitialFilterCutoffFrequency)
+	GeneratorInitialFilterQ                            GeneratorType = GeneratorType(gen_InitialFilterQ)
+	GeneratorModulationLfoToFilterCutoffFrequency      GeneratorType = GeneratorType(gen_ModulationLfoToFilterCutoffFrequency)
+	GeneratorModulationEnvelopeToFilterCutoffFrequency GeneratorType = GeneratorType(gen_ModulationEnvelopeToFilterCutoffFrequency)
+	GeneratorEndAddressCoarseOffset                    GeneratorType = GeneratorType(gen_EndAddressCoarseOffset)
+	GeneratorModulationLfoToVolume                     GeneratorType = GeneratorType(gen_ModulationLfoToVolume)
+	GeneratorChorusEffectsSend                         GeneratorType = GeneratorType(gen_ChorusEffectsSend)
+	GeneratorReverbEffectsSend                         GeneratorType = GeneratorType(gen_ReverbEffectsSend)
+	GeneratorPan                                       GeneratorType = GeneratorType(gen_Pan)
+	GeneratorDelayModulationLfo                        GeneratorType = GeneratorType(gen_DelayModulationLfo)
+	GeneratorFrequencyModulationLfo                    GeneratorType = GeneratorType(gen_FrequencyModulationLfo)
+	GeneratorDelayVibratoLfo                           GeneratorType = GeneratorType(gen_DelayVibratoLfo)
+	GeneratorFrequencyVibratoLfo                       GeneratorType = GeneratorType(gen_FrequencyVibratoLfo)
+	GeneratorDelayModulationEnvelope                   GeneratorType = GeneratorType(gen_DelayModulationEnvelope)
+	GeneratorAttackModulationEnvelope                  GeneratorType = GeneratorType(gen_AttackModulationEnvelope)
+	GeneratorHoldModulationEnvelope                    GeneratorType = GeneratorType(gen_HoldModulationEnvelope)
+	GeneratorDecayModulationEnvelope                   GeneratorType = GeneratorType(gen_DecayModulationEnvelope)
+	GeneratorSustainModulationEnvelope                 GeneratorType = GeneratorType(gen_SustainModulationEnvelope)
+	GeneratorReleaseModulationEnvelope                 GeneratorType = GeneratorType(gen_ReleaseModulationEnvelope)
+	GeneratorKeyNumberToModulationEnvelopeHold         GeneratorType = GeneratorType(gen_KeyNumberToModulationEnvelopeHold)
+	GeneratorKeyNumberToModulationEnvelopeDecay        GeneratorType = GeneratorType(gen_KeyNumberToModulationEnvelopeDecay)
+	GeneratorDelayVolumeEnvelope                       GeneratorType = GeneratorType(gen_DelayVolumeEnvelope)
+	GeneratorAttackVolumeEnvelope                      GeneratorType = GeneratorType(gen_AttackVolumeEnvelope)
+	GeneratorHoldVolumeEnvelope                        GeneratorType = GeneratorType(gen_HoldVolumeEnvelope)
+	GeneratorDecayVolumeEnvelope                       GeneratorType = GeneratorType(gen_DecayVolumeEnvelope)
+	GeneratorSustainVolumeEnvelope                     GeneratorType = GeneratorType(gen_SustainVolumeEnvelope)
+	GeneratorReleaseVolumeEnvelope                     GeneratorType = GeneratorType(gen_ReleaseVolumeEnvelope)
+	GeneratorKeyNumberToVolumeEnvelopeHold             GeneratorType = GeneratorType(gen_KeyNumberToVolumeEnvelopeHold)
+	GeneratorKeyNumberToVolumeEnvelopeDecay            GeneratorType = GeneratorType(gen_KeyNumberToVolumeEnvelopeDecay)
+	GeneratorInstrument                                GeneratorType = GeneratorType(gen_Instrument)
+	GeneratorKeyRange                                  GeneratorType = GeneratorType(gen_KeyRange)
+	GeneratorVelocityRange                             GeneratorType = GeneratorType(gen_VelocityRange)
+	GeneratorStartLoopAddressCoarseOffset              GeneratorType = GeneratorType(gen_StartLoopAddressCoarseOffset)
+	GeneratorKeyNumber                                 GeneratorType = GeneratorType(gen_KeyNumber)
+	GeneratorVelocity                                  GeneratorType = GeneratorType(gen_Velocity)
+	GeneratorInitialAttenuation                        GeneratorType = GeneratorType(gen_InitialAttenuation)
+	GeneratorEndLoopAddressCoarseOffset                GeneratorType = GeneratorType(gen_EndLoopAddressCoarseOffset)
+	GeneratorCoarseTune                                GeneratorType = GeneratorType(gen_CoarseTune)
+	GeneratorFineTune                                  GeneratorType = GeneratorType(gen_FineTune)
+	GeneratorSampleID                                  GeneratorType = GeneratorType(gen_SampleID)
+	GeneratorSampleModes                               GeneratorType = GeneratorType(gen_SampleModes)
+	GeneratorScaleTuning                               GeneratorType = GeneratorType(gen_ScaleTuning)
+	GeneratorExclusiveClass                            GeneratorType = GeneratorType(gen_ExclusiveClass)
+	GeneratorOverridingRootKey                         GeneratorType = GeneratorType(gen_OverridingRootKey)
+)
+
+var generator_Names = [...]string{
+	"startAddrsOffset",
+	"endAddrsOffset",
+	"startloopAddrsOffset",
+	"endloopAddrsOffset",
+	"startAddrsCoarseOffset",
+	"modLfoToPitch",
+	"vibLfoToPitch",
+	"modEnvToPitch",
+	"initialFilterFc",
+	"initialFilterQ",
+	"modLfoToFilterFc",
+	"modEnvToFilterFc",
+	"endAddrsCoarseOffset",
+	"modLfoToVolume",
+	"unused1",
+	"chorusEffectsSend",
+	"reverbEffectsSend",
+	"pan",
+	"unused2",
+	"unused3",
+	"unused4",
+	"delayModLFO",
+	"freqModLFO",
+	"delayVibLFO",
+	"freqVibLFO",
+	"delayModEnv",
+	"attackModEnv",
+	"holdModEnv",
+	"decayModEnv",
+	"sustainModEnv",
+	"releaseModEnv",
+	"keynumToModEnvHold",
+	"keynumToModEnvDecay",
+	"delayVolEnv",
+	"attackVolEnv",
+	"holdVolEnv",
+	"decayVolEnv",
+	"sustainVolEnv",
+	"releaseVolEnv",
+	"keynumToVolEnvHold",
+	"keynumToVolEnvDecay",
+	"instrument",
+	"reserved1",
+	"keyRange",
+	"velRange",
+	"startloopAddrsCoarseOffset",
+	"keynum",
+	"velocity",
+	"initialAttenuation",
+	"reserved2",
+	"endloopAddrsCoarseOffset",
+	"coarseTune",
+	"fineTune",
+	"sampleID",
+	"sampleModes",
+	"reserved3",
+	"scaleTuning",
+	"exclusiveClass",
+	"overridingRootKey",
+	"unused5",
+	"endOper",
+}
+
+// Returns the name of the generator in the SoundFont spec.
+func (generatorType GeneratorType) String() string {
+	if int(generatorType) < len(generator_Names) {
+		return generator_Names[generatorType]
+	} else {
+		return "unknown"
+	}
+}
@@ -10,20 +10,25 @@ type Instrument struct {
 	Regions []*InstrumentRegion
 }
 
-func createInstrument(info *instrumentInfo, zones []*zone, samples []*SampleHeader) (*Instrument, error) {
+func createInstrument(p *soundFontParser, info *instrumentInfo, zones []*zone, samples []*SampleHeader) (*Instrument, error) {
 	var err error
 
 	result := new(Instrument)
 	result.Name = info.name
 
 	zoneCount := info.zoneEndIndex - info.zoneStartIndex + 1
-	if zoneCount <= 0 {
-		return nil, fmt.Errorf("the instrument %q has no zone", info.name)
+	if zoneCount <= 0 || info.zoneStartIndex < 0 || int(info.zoneStartIndex+zoneCount) > len(zones) {
+		if !p.lenient {
+			return nil, fmt.Errorf("the instrument %q has no zone", info.name)
+		}
+		p.warn("inst", "the instrument %q has no valid zone", info.name)
+		result.Regions = make([]*InstrumentRegion, 0)
+		return result, nil
 	}
 
 	zoneSpan := zones[info.zoneStartIndex : info.zoneStartIndex+zoneCount]
 
-	result.Regions, err = createInstrumentRegions(result, zoneSpan, samples)
+	result.Regions, err = createInstrumentRegions(p, result, zoneSpan, samples)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +36,7 @@ func createInstrument(info *instrumentInfo, zones []*zone, samples []*SampleHead
 	return result, nil
 }
 
-func createInstruments(infos []*instrumentInfo, zones []*zone, samples []*SampleHeader) ([]*Instrument, error) {
+func createInstruments(p *soundFontParser, infos []*instrumentInfo, zones []*zone, samples []*SampleHeader) ([]*Instrument, error) {
 
 	var err error
 
@@ -45,7 +50,7 @@ func createInstruments(infos []*instrumentInfo, zones []*zone, samples []*Sample
 	instruments := make([]*Instrument, count)
 
 	for i := 0; i < count; i++ {
-		instruments[i], err = createInstrument(infos[i], zones, samples)
+		instruments[i], err = createInstrument(p, infos[i], zones, samples)
 		if err != nil {
 			return nil, err
 		}
@@ -53,3 +58,37 @@ func createInstruments(infos []*instrumentInfo, zones []*zone, samples []*Sample
 
 	return instruments, nil
 }
+
+// Finds the region which plays the other half of the stereo pair with the given region.
+// Returns -1 if the sample of the region is not linked or the partner is not played at the same time.
+func (instrument *Instrument) findLinkedRegion(samples []*SampleHeader, index int, key int32, velocity int32) int {
+	sample := instrument.Regions[index].Sample
+	if sample == nil || int(sample.Link) >= len(samples) {
+		return -1
+	}
+	partner := samples[sample.Link]
+	if !isStereoPair(samples, sample, partner) {
+		return -1
+	}
+
+	linked := instrument.findPlayingRegion(partner, -1, key, velocity)
+	if linked == -1 {
+		return -1
+	}
+
+	// If several regions play the same sample, only the first ones are paired.
+	if instrument.findPlayingRegion(sample, linked, key, velocity) != index {
+		return -1
+	}
+
+	return linked
+}
+
+func (instrument *Instrument) findPlayingRegion(sample *SampleHeader, exclude int, key int32, velocity int32) int {
+	for i, region := range instrument.Regions {
+		if i != exclude && region.Sample == sample && region.contains(key, velocity) {
+			return i
+		}
+	}
+	return -1
+}
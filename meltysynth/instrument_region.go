@@ -5,32 +5,15 @@ import (
 )
 
 type InstrumentRegion struct {
-	Sample *SampleHeader
-	gs     [61]int16
+	Sample     *SampleHeader
+	Modulators []Modulator
+	gs         [61]int16
 }
 
-func createInstrumentRegion(inst *Instrument, global *zone, local *zone, samples []*SampleHeader) (*InstrumentRegion, error) {
+func createInstrumentRegion(p *soundFontParser, inst *Instrument, global *zone, local *zone, samples []*SampleHeader) (*InstrumentRegion, error) {
 	result := new(InstrumentRegion)
 
-	result.gs[gen_InitialFilterCutoffFrequency] = 13500
-	result.gs[gen_DelayModulationLfo] = -12000
-	result.gs[gen_DelayVibratoLfo] = -12000
-	result.gs[gen_DelayModulationEnvelope] = -12000
-	result.gs[gen_AttackModulationEnvelope] = -12000
-	result.gs[gen_HoldModulationEnvelope] = -12000
-	result.gs[gen_DecayModulationEnvelope] = -12000
-	result.gs[gen_ReleaseModulationEnvelope] = -12000
-	result.gs[gen_DelayVolumeEnvelope] = -12000
-	result.gs[gen_AttackVolumeEnvelope] = -12000
-	result.gs[gen_HoldVolumeEnvelope] = -12000
-	result.gs[gen_DecayVolumeEnvelope] = -12000
-	result.gs[gen_ReleaseVolumeEnvelope] = -12000
-	result.gs[gen_KeyRange] = 0x7F00
-	result.gs[gen_VelocityRange] = 0x7F00
-	result.gs[gen_KeyNumber] = -1
-	result.gs[gen_Velocity] = -1
-	result.gs[gen_ScaleTuning] = 100
-	result.gs[gen_OverridingRootKey] = -1
+	setDefaultInstrumentGenerators(&result.gs)
 
 	for i := 0; i < len(global.generators); i++ {
 		result.setParameter(global.generators[i])
@@ -40,16 +23,53 @@ func createInstrumentRegion(inst *Instrument, global *zone, local *zone, samples
 		result.setParameter(local.generators[i])
 	}
 
+	// The local modulators supersede the identical global ones.
+	result.Modulators = mergeModulators(global.modulators, local.modulators)
+
 	id := result.gs[gen_SampleID]
 	if !(0 <= id && int(id) < len(samples)) {
-		return nil, fmt.Errorf("the instrument %q contains an invalid sample id %d", inst.Name, id)
+		if !p.lenient {
+			return nil, p.newError("igen", fmt.Errorf("the instrument %q contains an invalid sample id %d", inst.Name, id))
+		}
+		// The region is removed in the lenient mode.
+		p.warn("igen", "the region of the instrument %q was removed since it contains an invalid sample id %d", inst.Name, id)
+		return nil, nil
 	}
 	result.Sample = samples[id]
 
 	return result, nil
 }
 
-func createInstrumentRegions(inst *Instrument, zones []*zone, samples []*SampleHeader) ([]*InstrumentRegion, error) {
+func NewInstrumentRegion(sample *SampleHeader) *InstrumentRegion {
+	result := new(InstrumentRegion)
+	result.Sample = sample
+	setDefaultInstrumentGenerators(&result.gs)
+	return result
+}
+
+func setDefaultInstrumentGenerators(gs *[61]int16) {
+	gs[gen_InitialFilterCutoffFrequency] = 13500
+	gs[gen_DelayModulationLfo] = -12000
+	gs[gen_DelayVibratoLfo] = -12000
+	gs[gen_DelayModulationEnvelope] = -12000
+	gs[gen_AttackModulationEnvelope] = -12000
+	gs[gen_HoldModulationEnvelope] = -12000
+	gs[gen_DecayModulationEnvelope] = -12000
+	gs[gen_ReleaseModulationEnvelope] = -12000
+	gs[gen_DelayVolumeEnvelope] = -12000
+	gs[gen_AttackVolumeEnvelope] = -12000
+	gs[gen_HoldVolumeEnvelope] = -12000
+	gs[gen_DecayVolumeEnvelope] = -12000
+	gs[gen_ReleaseVolumeEnvelope] = -12000
+	gs[gen_KeyRange] = 0x7F00
+	gs[gen_VelocityRange] = 0x7F00
+	gs[gen_KeyNumber] = -1
+	gs[gen_Velocity] = -1
+	gs[gen_ScaleTuning] = 100
+	gs[gen_OverridingRootKey] = -1
+}
+
+func createInstrumentRegions(p *soundFontParser, inst *Instrument, zones []*zone, samples []*SampleHeader) ([]*InstrumentRegion, error) {
 	var err error
 
 	// Is the first one the global zone?
@@ -60,23 +80,31 @@ func createInstrumentRegions(inst *Instrument, zones []*zone, samples []*SampleH
 
 		// The global zone is regarded as the base setting of subsequent zones.
 		count := len(zones) - 1
-		regions := make([]*InstrumentRegion, count)
+		regions := make([]*InstrumentRegion, 0, count)
 		for i := 0; i < count; i++ {
-			regions[i], err = createInstrumentRegion(inst, global, zones[i+1], samples)
+			var region *InstrumentRegion
+			region, err = createInstrumentRegion(p, inst, global, zones[i+1], samples)
 			if err != nil {
 				return nil, err
 			}
+			if region != nil {
+				regions = append(regions, region)
+			}
 		}
 		return regions, nil
 	} else {
 		// No global zone.
 		count := len(zones)
-		regions := make([]*InstrumentRegion, count)
+		regions := make([]*InstrumentRegion, 0, count)
 		for i := 0; i < count; i++ {
-			regions[i], err = createInstrumentRegion(inst, createEmptyZone(), zones[i], samples)
+			var region *InstrumentRegion
+			region, err = createInstrumentRegion(p, inst, createEmptyZone(), zones[i], samples)
 			if err != nil {
 				return nil, err
 			}
+			if region != nil {
+				regions = append(regions, region)
+			}
 		}
 		return regions, nil
 	}
@@ -91,6 +119,29 @@ func (region *InstrumentRegion) setParameter(param generator) {
 	}
 }
 
+func (region *InstrumentRegion) GetGenerator(generatorType GeneratorType) int16 {
+	if int(generatorType) < len(region.gs) {
+		return region.gs[generatorType]
+	} else {
+		return 0
+	}
+}
+
+// Unknown generators are ignored.
+func (region *InstrumentRegion) SetGenerator(generatorType GeneratorType, value int16) {
+	if int(generatorType) < len(region.gs) {
+		region.gs[generatorType] = value
+	}
+}
+
+func (region *InstrumentRegion) SetKeyRange(start int32, end int32) {
+	region.gs[gen_KeyRange] = int16(end<<8 | start)
+}
+
+func (region *InstrumentRegion) SetVelocityRange(start int32, end int32) {
+	region.gs[gen_VelocityRange] = int16(end<<8 | start)
+}
+
 func (region *InstrumentRegion) contains(key int32, velocity int32) bool {
 	containsKey := region.GetKeyRangeStart() <= key && key <= region.GetKeyRangeEnd()
 	containsVelocity := region.GetVelocityRangeStart() <= velocity && velocity <= region.GetVelocityRangeEnd()
@@ -0,0 +1,90 @@
+package meltysynth
+
+import "math"
+
+// Specifies how the samples are interpolated when the pitch is changed.
+type InterpolationMode int32
+
+const (
+	InterpolationLinear  InterpolationMode = 0
+	InterpolationNearest InterpolationMode = 1
+	InterpolationCubic   InterpolationMode = 2 // The 4-point cubic Hermite (Catmull-Rom) spline.
+	InterpolationSinc    InterpolationMode = 3 // The 16-point windowed sinc, which is band-limited for the high transpositions.
+)
+
+func (mode InterpolationMode) String() string {
+	switch mode {
+	case InterpolationLinear:
+		return "linear"
+	case InterpolationNearest:
+		return "nearest"
+	case InterpolationCubic:
+		return "cubic"
+	case InterpolationSinc:
+		return "sinc"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	interpolation_SincHalfWidth  int32 = 8
+	interpolation_SincResolution int32 = 1024
+)
+
+// The sinc function and the Blackman window are tabulated separately,
+// since the cutoff frequency of the sinc function is lowered for the high transpositions,
+// while the window always covers the same number of samples.
+var interpolation_SincTable = createSincTable()
+var interpolation_WindowTable = createWindowTable()
+
+func createSincTable() []float32 {
+	table := make([]float32, interpolation_SincHalfWidth*interpolation_SincResolution+1)
+	table[0] = 1
+	for i := 1; i < len(table); i++ {
+		x := math.Pi * float64(i) / float64(interpolation_SincResolution)
+		table[i] = float32(math.Sin(x) / x)
+	}
+	return table
+}
+
+func createWindowTable() []float32 {
+	table := make([]float32, interpolation_SincHalfWidth*interpolation_SincResolution+1)
+	for i := 0; i < len(table); i++ {
+		// The window is centered at zero, so the phase starts from the middle.
+		x := math.Pi * (1 + float64(i)/float64(len(table)-1))
+		table[i] = float32(0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x))
+	}
+	return table
+}
+
+func interpolateCubic(x0 float32, x1 float32, x2 float32, x3 float32, a float32) float32 {
+	c1 := 0.5 * (x2 - x0)
+	c2 := x0 - 2.5*x1 + 2*x2 - 0.5*x3
+	c3 := 0.5*(x3-x0) + 1.5*(x1-x2)
+	return ((c3*a+c2)*a+c1)*a + x1
+}
+
+// Calculates the weights of the sinc kernel for the fraction a.
+// The cutoff is relative to the Nyquist frequency of the sample.
+func calcSincWeights(weights []float32, a float32, cutoff float32) {
+	scale := float32(interpolation_SincResolution)
+
+	var sum float32
+	for i := range weights {
+		distance := float32(int32(i)-interpolation_SincHalfWidth+1) - a
+		if distance < 0 {
+			distance = -distance
+		}
+		sinc := interpolation_SincTable[int32(cutoff*distance*scale+0.5)]
+		window := interpolation_WindowTable[int32(distance*scale+0.5)]
+		weights[i] = sinc * window
+		sum += weights[i]
+	}
+
+	// The weights are normalized so that the DC gain is not affected by the truncation.
+	inverse := 1 / sum
+	for i := range weights {
+		weights[i] *= inverse
+	}
+}
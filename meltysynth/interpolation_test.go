@@ -0,0 +1,114 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+var interpolationModes = []InterpolationMode{InterpolationNearest, InterpolationLinear, InterpolationCubic, InterpolationSinc}
+
+func createInterpolationTestOscillator(mode InterpolationMode, data []int16, loopMode int32) *oscillator {
+	synthesizer := &Synthesizer{SampleRate: 44100, Interpolation: mode}
+	o := newOscillator(synthesizer)
+	length := int32(len(data) - 46)
+	o.start(data, nil, loopMode, 44100, 0, length, 0, length, 60, 0, 0, 100)
+	return o
+}
+
+func createInterpolationTestData(length int, period float64) []int16 {
+	data := make([]int16, length+46)
+	for i := 0; i < length; i++ {
+		data[i] = floatToInt16(float32(0.5 * math.Sin(2*math.Pi*float64(i)/period)))
+	}
+	return data
+}
+
+func TestInterpolation_OriginalPitch(t *testing.T) {
+	data := createInterpolationTestData(1000, 100)
+
+	for _, mode := range interpolationModes {
+		o := createInterpolationTestOscillator(mode, data, loop_NoLoop)
+		block := make([]float32, 256)
+		if !o.process(block, 60) {
+			t.Fatalf("%v: the oscillator stopped unexpectedly", mode)
+		}
+		for i, value := range block {
+			expected := float32(data[i]) / 32768
+			if math.Abs(float64(value-expected)) > 1.0e-4 {
+				t.Fatalf("%v: expected %f at %d, but got %f", mode, expected, i, value)
+			}
+		}
+	}
+}
+
+func TestInterpolation_LoopBoundary(t *testing.T) {
+	// The loop contains exactly 10 periods, so the waveform is continuous across the loop boundary.
+	data := createInterpolationTestData(1000, 100)
+
+	tolerances := map[InterpolationMode]float64{
+		InterpolationNearest: 2.0e-2,
+		InterpolationLinear:  1.0e-3,
+		InterpolationCubic:   1.0e-3,
+		InterpolationSinc:    1.0e-3,
+	}
+
+	for _, mode := range interpolationModes {
+		o := createInterpolationTestOscillator(mode, data, loop_Continuous)
+
+		// Play a fifth down, which makes the positions fractional.
+		pitch := float32(53)
+		ratio := math.Pow(2, -7.0/12)
+		block := make([]float32, 64)
+		position := float64(0)
+		for b := 0; b < 100; b++ {
+			o.process(block, pitch)
+			for i, value := range block {
+				// The kernels reach the silence before the start of the sample at first.
+				warmUp := b == 0 && i < 16
+				expected := 0.5 * math.Sin(2*math.Pi*position/100)
+				if !warmUp && math.Abs(float64(value)-expected) > tolerances[mode] {
+					t.Fatalf("%v: expected %f at %f, but got %f", mode, expected, position, value)
+				}
+				position = math.Mod(position+ratio, 1000)
+			}
+		}
+	}
+}
+
+func TestInterpolation_Settings(t *testing.T) {
+	settings := NewSynthesizerSettings(44100)
+	if settings.Interpolation != InterpolationLinear {
+		t.Error("the default interpolation should be linear")
+	}
+	settings.Interpolation = InterpolationMode(4)
+	if settings.validate() == nil {
+		t.Error("the invalid interpolation mode should be rejected")
+	}
+}
+
+func benchmarkInterpolation(b *testing.B, mode InterpolationMode) {
+	data := createInterpolationTestData(44100, 100)
+	o := createInterpolationTestOscillator(mode, data, loop_Continuous)
+	block := make([]float32, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// A high transposition, where the sinc kernel lowers the cutoff.
+		o.process(block, 79)
+	}
+}
+
+func BenchmarkInterpolation_Nearest(b *testing.B) {
+	benchmarkInterpolation(b, InterpolationNearest)
+}
+
+func BenchmarkInterpolation_Linear(b *testing.B) {
+	benchmarkInterpolation(b, InterpolationLinear)
+}
+
+func BenchmarkInterpolation_Cubic(b *testing.B) {
+	benchmarkInterpolation(b, InterpolationCubic)
+}
+
+func BenchmarkInterpolation_Sinc(b *testing.B) {
+	benchmarkInterpolation(b, InterpolationSinc)
+}
@@ -37,7 +37,7 @@ func (lfo *lfo) process() {
 		return
 	}
 
-	lfo.processedSampleCount += lfo.synthesizer.BlockSize
+	lfo.processedSampleCount += lfo.synthesizer.blockLength
 	currentTime := float64(lfo.processedSampleCount) / float64(lfo.synthesizer.SampleRate)
 
 	if currentTime < lfo.delay {
@@ -11,6 +11,7 @@ import (
 
 const (
 	msg_Normal      byte = 0
+	msg_SysEx       byte = 240
 	msg_TempoChange byte = 252
 	msg_EndOfTrack  byte = 255
 )
@@ -23,8 +24,9 @@ type message struct {
 }
 
 type MidiFile struct {
-	messages []message
-	times    []time.Duration
+	messages  []message
+	times     []time.Duration
+	sysExData [][]byte // Referred by the SysEx messages.
 }
 
 func newMessage(channel byte, command byte, data1 byte, data2 byte) message {
@@ -56,12 +58,21 @@ func tempoChange(tempo int32) message {
 	return newMessage(msg_TempoChange, command, data1, data2)
 }
 
+func sysEx(index int32) message {
+	command := byte(index >> 16)
+	data1 := byte(index >> 8)
+	data2 := byte(index)
+	return newMessage(msg_SysEx, command, data1, data2)
+}
+
 func endOfTrack() message {
 	return newMessage(msg_EndOfTrack, 0, 0, 0)
 }
 
 func (message message) getMessageType() byte {
 	switch message.channel {
+	case msg_SysEx:
+		return msg_SysEx
 	case msg_TempoChange:
 		return msg_TempoChange
 	case msg_EndOfTrack:
@@ -75,6 +86,10 @@ func (message message) getTempo() float64 {
 	return 60000000.0 / float64((int32(message.command)<<16)|(int32(message.data1)<<8)|int32(message.data2))
 }
 
+func (message message) getSysExIndex() int32 {
+	return (int32(message.command) << 16) | (int32(message.data1) << 8) | int32(message.data2)
+}
+
 func NewMidiFile(r io.Reader) (*MidiFile, error) {
 	var err error
 
@@ -116,10 +131,11 @@ func NewMidiFile(r io.Reader) (*MidiFile, error) {
 		return nil, err
 	}
 
+	var sysExData [][]byte
 	messageLists := make([][]message, trackCount)
 	tickLists := make([][]int32, trackCount)
 	for i := int16(0); i < trackCount; i++ {
-		messageList, tickList, err := readTrack(r)
+		messageList, tickList, err := readTrack(r, &sysExData)
 		if err != nil {
 			return nil, err
 		}
@@ -132,11 +148,13 @@ func NewMidiFile(r io.Reader) (*MidiFile, error) {
 	result := new(MidiFile)
 	result.messages = messages
 	result.times = times
+	result.sysExData = sysExData
 
 	return result, nil
 }
 
-func readTrack(r io.Reader) ([]message, []int32, error) {
+// The SysEx data are appended to sysExData, which is shared by all the tracks.
+func readTrack(r io.Reader, sysExData *[][]byte) ([]message, []int32, error) {
 	var n int
 	var err error
 
@@ -156,6 +174,9 @@ func readTrack(r io.Reader) ([]message, []int32, error) {
 	var tick int32
 	var lastStatus byte
 
+	// The SysEx message split into the packets is continued by the following 0xF7 events.
+	pendingSysEx := int32(-1)
+
 	for {
 		delta, err := readIntVariableLength(r)
 		if err != nil {
@@ -190,16 +211,39 @@ func readTrack(r io.Reader) ([]message, []int32, error) {
 
 		switch first {
 		case 0xF0: // System Exclusive
-			err = discardData(r)
+			var data []byte
+			data, err = readData(r)
 			if err != nil {
 				return nil, nil, err
 			}
+			index := int32(len(*sysExData))
+			*sysExData = append(*sysExData, data)
+			messages = append(messages, sysEx(index))
+			ticks = append(ticks, tick)
+			if len(data) == 0 || data[len(data)-1] != 0xF7 {
+				pendingSysEx = index
+			} else {
+				pendingSysEx = -1
+			}
 
-		case 0xF7: // System Exclusive
-			err = discardData(r)
+		case 0xF7: // System Exclusive (continuation or escape)
+			var data []byte
+			data, err = readData(r)
 			if err != nil {
 				return nil, nil, err
 			}
+			if pendingSysEx != -1 {
+				(*sysExData)[pendingSysEx] = append((*sysExData)[pendingSysEx], data...)
+				if len(data) > 0 && data[len(data)-1] == 0xF7 {
+					pendingSysEx = -1
+				}
+			} else if len(data) > 0 && data[0] == 0xF0 {
+				// The escaped SysEx message, which contains the status byte.
+				index := int32(len(*sysExData))
+				*sysExData = append(*sysExData, data[1:])
+				messages = append(messages, sysEx(index))
+				ticks = append(ticks, tick)
+			}
 
 		case 0xFF: // Meta Event
 			var metaEvent byte
@@ -340,6 +384,24 @@ func readTempo(r io.Reader) (int32, error) {
 	return (int32(b1) << 16) | (int32(b2) << 8) | int32(b3), nil
 }
 
+func readData(r io.Reader) ([]byte, error) {
+	size, err := readIntVariableLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	n, err := io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+	if n != int(size) {
+		return nil, errors.New("failed to read the data")
+	}
+
+	return data, nil
+}
+
 func discardData(r io.Reader) error {
 	size, err := readIntVariableLength(r)
 	if err != nil {
@@ -66,23 +66,47 @@ func (seq *MidiFileSequencer) processEvents() {
 		return
 	}
 
+	// The messages within the next block are scheduled at their exact positions.
+	sampleRate := float64(seq.synthesizer.SampleRate)
+	blockEnd := seq.currentTime + time.Duration(float64(time.Second)*float64(seq.synthesizer.BlockSize)/sampleRate)
+
 	msgLength := int32(len(seq.midiFile.messages))
-	for seq.msgIndex < msgLength {
-		time := seq.midiFile.times[seq.msgIndex]
-		msg := seq.midiFile.messages[seq.msgIndex]
-		if time <= seq.currentTime {
-			if msg.getMessageType() == msg_Normal {
-				seq.synthesizer.ProcessMidiMessage(int32(msg.channel), int32(msg.command), int32(msg.data1), int32(msg.data2))
+	for {
+		for seq.msgIndex < msgLength {
+			msgTime := seq.midiFile.times[seq.msgIndex]
+			msg := seq.midiFile.messages[seq.msgIndex]
+			if msgTime < blockEnd {
+				offset := int32((msgTime - seq.currentTime).Seconds() * sampleRate)
+				switch msg.getMessageType() {
+				case msg_Normal:
+					seq.synthesizer.ProcessMidiMessageAt(offset, int32(msg.channel), int32(msg.command), int32(msg.data1), int32(msg.data2))
+				case msg_SysEx:
+					seq.synthesizer.ProcessSysExAt(offset, seq.midiFile.sysExData[msg.getSysExIndex()])
+				}
+				seq.msgIndex++
+			} else {
+				break
 			}
-			seq.msgIndex++
-		} else {
-			break
 		}
-	}
 
-	if seq.msgIndex == msgLength && seq.loop {
-		seq.currentTime = 0
+		if !(seq.msgIndex == msgLength && seq.loop) {
+			return
+		}
+
+		// The notes are released at the loop point, after the messages at the end of the file.
+		// The rest of the block after the loop point belongs to the restarted timeline.
+		loopTime := seq.midiFile.GetLength()
+		offset := int32((loopTime - seq.currentTime).Seconds() * sampleRate)
+		for channel := int32(0); channel < synth_channelCount; channel++ {
+			seq.synthesizer.ProcessMidiMessageAt(offset, channel, 0xB0, 0x7B, 0)
+		}
 		seq.msgIndex = 0
-		seq.synthesizer.NoteOffAll(false)
+
+		// If the file has no length, the loop is restarted from the next block.
+		if loopTime <= 0 {
+			return
+		}
+		seq.currentTime -= loopTime
+		blockEnd -= loopTime
 	}
 }
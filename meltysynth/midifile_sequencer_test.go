@@ -0,0 +1,48 @@
+package meltysynth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMidiFileSequencer_Loop(t *testing.T) {
+	// The note in the final block of the file must be released at the loop point.
+	midiFile := &MidiFile{
+		messages: []message{
+			common3b(0x90, 60, 100),
+			common3b(0x80, 60, 0),
+			common3b(0x90, 64, 100),
+			endOfTrack(),
+		},
+		times: []time.Duration{
+			0,
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			200*time.Millisecond + 100*time.Microsecond,
+		},
+	}
+
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	sequencer := NewMidiFileSequencer(synthesizer)
+	sequencer.Play(midiFile, true)
+
+	// Renders until the middle of the second loop.
+	length := 64 * 200
+	left := make([]float32, length)
+	right := make([]float32, length)
+	sequencer.Render(left, right)
+
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		if voice.key == 64 && voice.voiceState == voice_Playing {
+			t.Error("the note at the end of the file should be released at the loop point")
+		}
+	}
+
+	// The first note of the second loop starts at the loop point, not at the next block.
+	voice := findPlayingVoice(t, synthesizer, 0)
+	start := int32(0.2001 * float64(synthesizer.SampleRate))
+	if voice.key != 60 || voice.voiceLength < int32(length)-start-1 || voice.voiceLength > int32(length)-start+1 {
+		t.Errorf("the note of the second loop should start at %d, but started at %d", start, int32(length)-voice.voiceLength)
+	}
+}
@@ -1,23 +1,320 @@
 package meltysynth
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
+	"math"
 )
 
-// Since modulators will not be supported, we discard the data.
-func discardModulatorData(r io.Reader, size int32) error {
+type Modulator struct {
+	SourceOperator       uint16
+	DestinationGenerator uint16
+	Amount               int16
+	AmountSourceOperator uint16
+	TransformOperator    uint16
+}
+
+// Some of the default modulators are implemented directly in the synthesizer,
+// since their behavior is a bit different from the SoundFont spec for better loudness control.
+// These flags indicate which built-in implementation is enabled for the voice.
+// If a region overrides the default modulator, the corresponding built-in one is disabled.
+const (
+	builtin_NoteOnVelocity uint16 = 1 << 0
+	builtin_Modulation     uint16 = 1 << 1
+	builtin_Volume         uint16 = 1 << 2
+	builtin_Pan            uint16 = 1 << 3
+	builtin_Expression     uint16 = 1 << 4
+	builtin_ReverbSend     uint16 = 1 << 5
+	builtin_ChorusSend     uint16 = 1 << 6
+	builtin_PitchWheel     uint16 = 1 << 7
+)
+
+type defaultModulator struct {
+	modulator Modulator
+	builtin   uint16
+}
+
+// The default modulators defined in the SoundFont 2.01 spec.
+// In addition, there are non-spec defaults which route the poly pressure to the vibrato depth like the channel pressure,
+// and which swell the volume with both pressures. The swell attenuates the voice by 96 centibels without pressure,
+// and each pressure removes half of it, so the volume never exceeds the level without these modulators.
+// Note that the velocity to the filter cutoff makes the soft notes darker than before these were introduced,
+// even if the SoundFont has no modulator. A region can disable it with an identical modulator whose amount is zero,
+// and SynthesizerSettings.EnableDefaultModulators disables all of the ones which are not built in.
+var defaultModulators = []defaultModulator{
+	{Modulator{0x0502, gen_InitialAttenuation, 960, 0x0000, modtrans_Linear}, builtin_NoteOnVelocity},
+	{Modulator{0x0102, gen_InitialFilterCutoffFrequency, -2400, 0x0000, modtrans_Linear}, 0},
+	{Modulator{0x000D, gen_VibratoLfoToPitch, 50, 0x0000, modtrans_Linear}, 0},
+	{Modulator{0x000A, gen_VibratoLfoToPitch, 50, 0x0000, modtrans_Linear}, 0},
+	{Modulator{0x010D, gen_InitialAttenuation, 48, 0x0000, modtrans_Linear}, 0},
+	{Modulator{0x010A, gen_InitialAttenuation, 48, 0x0000, modtrans_Linear}, 0},
+	{Modulator{0x0081, gen_VibratoLfoToPitch, 50, 0x0000, modtrans_Linear}, builtin_Modulation},
+	{Modulator{0x0587, gen_InitialAttenuation, 960, 0x0000, modtrans_Linear}, builtin_Volume},
+	{Modulator{0x028A, gen_Pan, 1000, 0x0000, modtrans_Linear}, builtin_Pan},
+	{Modulator{0x058B, gen_InitialAttenuation, 960, 0x0000, modtrans_Linear}, builtin_Expression},
+	{Modulator{0x00DB, gen_ReverbEffectsSend, 200, 0x0000, modtrans_Linear}, builtin_ReverbSend},
+	{Modulator{0x00DD, gen_ChorusEffectsSend, 200, 0x0000, modtrans_Linear}, builtin_ChorusSend},
+	{Modulator{0x020E, mod_InitialPitch, 12700, 0x0010, modtrans_Linear}, builtin_PitchWheel},
+}
+
+func readModulatorsFromChunk(r io.Reader, size int32) ([]Modulator, error) {
+	var n int
+	var err error
+
 	if size%10 != 0 {
-		return errors.New("the modulator list is invalid")
+		return nil, errors.New("the modulator list is invalid")
+	}
+
+	// Some SoundFonts have an empty modulator list without the terminator.
+	if size == 0 {
+		return make([]Modulator, 0), nil
+	}
+
+	count := size/10 - 1
+	modulators := make([]Modulator, count)
+
+	for i := int32(0); i < count; i++ {
+		var mod Modulator
+
+		err = binary.Read(r, binary.LittleEndian, &mod.SourceOperator)
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Read(r, binary.LittleEndian, &mod.DestinationGenerator)
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Read(r, binary.LittleEndian, &mod.Amount)
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Read(r, binary.LittleEndian, &mod.AmountSourceOperator)
+		if err != nil {
+			return nil, err
+		}
+
+		err = binary.Read(r, binary.LittleEndian, &mod.TransformOperator)
+		if err != nil {
+			return nil, err
+		}
+
+		modulators[i] = mod
 	}
 
-	n, err := r.Read(make([]byte, size))
+	// The last one is the terminator.
+	n, err = r.Read(make([]byte, 10))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if n != 10 {
+		return nil, errors.New("failed to read the modulator list")
+	}
+
+	return modulators, nil
+}
+
+// Two modulators are regarded as identical if they have the same sources and destination.
+// An identical modulator in a more specific zone supersedes the other one.
+func (mod Modulator) isIdentical(other Modulator) bool {
+	return mod.SourceOperator == other.SourceOperator &&
+		mod.DestinationGenerator == other.DestinationGenerator &&
+		mod.AmountSourceOperator == other.AmountSourceOperator
+}
+
+func (mod Modulator) isLinked() bool {
+	return mod.DestinationGenerator&0x8000 != 0 || mod.SourceOperator&0x7F == modsrc_Link && mod.SourceOperator&0x80 == 0
+}
+
+// If the value of the modulator depends only on the note-on event,
+// it can be evaluated once when the voice starts.
+func (mod Modulator) isStatic() bool {
+	return isStaticModulatorSource(mod.SourceOperator) && isStaticModulatorSource(mod.AmountSourceOperator)
+}
+
+func isStaticModulatorSource(operator uint16) bool {
+	if operator&0x80 != 0 {
+		return false
+	}
+	index := operator & 0x7F
+	return index == modsrc_NoController || index == modsrc_NoteOnVelocity || index == modsrc_NoteOnKeyNumber
+}
+
+func mergeModulators(modulators []Modulator, overrides []Modulator) []Modulator {
+	result := make([]Modulator, len(modulators), len(modulators)+len(overrides))
+	copy(result, modulators)
+
+	for _, override := range overrides {
+		found := false
+		for i := 0; i < len(result); i++ {
+			if result[i].isIdentical(override) {
+				result[i] = override
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, override)
+		}
+	}
+
+	return result
+}
+
+func containsIdenticalModulator(modulators []Modulator, mod Modulator) bool {
+	for i := 0; i < len(modulators); i++ {
+		if modulators[i].isIdentical(mod) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mod Modulator) getValue(v *voice, channelInfo *channel) float32 {
+	// Linked modulators are rarely used, and most synthesizers ignore them.
+	if mod.isLinked() {
+		return 0
+	}
+
+	// If the primary source is not set, the modulator has no effect.
+	if mod.SourceOperator&0x7F == modsrc_NoController && mod.SourceOperator&0x80 == 0 {
+		return 0
+	}
+
+	value := float32(mod.Amount) * calcModulatorSource(mod.SourceOperator, v, channelInfo)
+	if value == 0 {
+		return 0
+	}
+
+	if !(mod.AmountSourceOperator&0x7F == modsrc_NoController && mod.AmountSourceOperator&0x80 == 0) {
+		value *= calcModulatorSource(mod.AmountSourceOperator, v, channelInfo)
+	}
+
+	if mod.TransformOperator == modtrans_AbsoluteValue && value < 0 {
+		value = -value
+	}
+
+	return value
+}
+
+func calcModulatorSource(operator uint16, v *voice, channelInfo *channel) float32 {
+	index := operator & 0x7F
+
+	var x float32
+	if operator&0x80 != 0 {
+		x = float32(channelInfo.controllerValues[index]) / 128
+	} else {
+		switch index {
+		case modsrc_NoController:
+			x = 1
+		case modsrc_NoteOnVelocity:
+			x = float32(v.velocity) / 128
+		case modsrc_NoteOnKeyNumber:
+			x = float32(v.key) / 128
+		case modsrc_PolyPressure:
+			x = float32(channelInfo.polyPressure[v.key]) / 128
+		case modsrc_ChannelPressure:
+			x = float32(channelInfo.channelPressure) / 128
+		case modsrc_PitchWheel:
+			x = 0.5*channelInfo.pitchBend + 0.5
+		case modsrc_PitchWheelSensitivity:
+			x = channelInfo.getPitchBendRange() / 128
+		default:
+			// Unsupported sources have no effect.
+			return 0
+		}
 	}
-	if n != int(size) {
-		return errors.New("failed to read the modulator list")
+
+	// Negative direction.
+	if operator&0x100 != 0 {
+		x = 1 - x
 	}
 
-	return nil
+	curve := operator >> 10
+	bipolar := operator&0x200 != 0
+
+	if bipolar {
+		switch curve {
+		case modcurve_Linear:
+			return 2*x - 1
+		case modcurve_Concave:
+			if x >= 0.5 {
+				return calcConcave(2*x - 1)
+			} else {
+				return -calcConcave(1 - 2*x)
+			}
+		case modcurve_Convex:
+			if x >= 0.5 {
+				return calcConvex(2*x - 1)
+			} else {
+				return -calcConvex(1 - 2*x)
+			}
+		case modcurve_Switch:
+			if x >= 0.5 {
+				return 1
+			} else {
+				return -1
+			}
+		}
+	} else {
+		switch curve {
+		case modcurve_Linear:
+			return x
+		case modcurve_Concave:
+			return calcConcave(x)
+		case modcurve_Convex:
+			return calcConvex(x)
+		case modcurve_Switch:
+			if x >= 0.5 {
+				return 1
+			} else {
+				return 0
+			}
+		}
+	}
+
+	// Unknown curve types should be ignored.
+	return 0
+}
+
+func calcConcave(x float32) float32 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	return calcClamp(float32(-40.0/96.0*math.Log10(1-float64(x))), 0, 1)
+}
+
+func calcConvex(x float32) float32 {
+	return 1 - calcConcave(1-x)
+}
+
+// These generators are updated for every block when they are modulated by a MIDI controller.
+// The others are applied only when the voice starts.
+func isRealTimeGenerator(generatorType uint16) bool {
+	switch generatorType {
+	case gen_ModulationLfoToPitch,
+		gen_VibratoLfoToPitch,
+		gen_ModulationEnvelopeToPitch,
+		gen_InitialFilterCutoffFrequency,
+		gen_InitialFilterQ,
+		gen_ModulationLfoToFilterCutoffFrequency,
+		gen_ModulationEnvelopeToFilterCutoffFrequency,
+		gen_ModulationLfoToVolume,
+		gen_ChorusEffectsSend,
+		gen_ReverbEffectsSend,
+		gen_Pan,
+		gen_InitialAttenuation,
+		gen_CoarseTune,
+		gen_FineTune,
+		mod_InitialPitch:
+		return true
+	default:
+		return false
+	}
 }
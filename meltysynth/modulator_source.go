@@ -0,0 +1,28 @@
+package meltysynth
+
+const (
+	modsrc_NoController          uint16 = 0
+	modsrc_NoteOnVelocity        uint16 = 2
+	modsrc_NoteOnKeyNumber       uint16 = 3
+	modsrc_PolyPressure          uint16 = 10
+	modsrc_ChannelPressure       uint16 = 13
+	modsrc_PitchWheel            uint16 = 14
+	modsrc_PitchWheelSensitivity uint16 = 16
+	modsrc_Link                  uint16 = 127
+)
+
+const (
+	modcurve_Linear  uint16 = 0
+	modcurve_Concave uint16 = 1
+	modcurve_Convex  uint16 = 2
+	modcurve_Switch  uint16 = 3
+)
+
+const (
+	modtrans_Linear        uint16 = 0
+	modtrans_AbsoluteValue uint16 = 2
+)
+
+// The initial pitch is not a generator, but it is the destination of the default pitch wheel modulator.
+// Following FluidSynth, the unused generator number 59 is assigned to it.
+const mod_InitialPitch uint16 = gen_Unused5
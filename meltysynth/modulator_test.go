@@ -0,0 +1,278 @@
+package meltysynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestReadModulatorsFromChunk(t *testing.T) {
+	expected := []Modulator{
+		{0x0502, gen_InitialAttenuation, 960, 0, 0},
+		{0x00DB, gen_ReverbEffectsSend, -200, 0x0081, modtrans_AbsoluteValue},
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, expected)
+	binary.Write(&buf, binary.LittleEndian, Modulator{})
+
+	modulators, err := readModulatorsFromChunk(&buf, int32(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modulators) != len(expected) {
+		t.Fatalf("expected %d modulators, but got %d", len(expected), len(modulators))
+	}
+	for i := 0; i < len(expected); i++ {
+		if modulators[i] != expected[i] {
+			t.Errorf("modulator %d: expected %v, but got %v", i, expected[i], modulators[i])
+		}
+	}
+
+	_, err = readModulatorsFromChunk(bytes.NewReader(make([]byte, 15)), 15)
+	if err == nil {
+		t.Error("the invalid modulator list was accepted")
+	}
+}
+
+func TestMergeModulators(t *testing.T) {
+	global := []Modulator{
+		{0x0081, gen_VibratoLfoToPitch, 50, 0, 0},
+		{0x000D, gen_VibratoLfoToPitch, 50, 0, 0},
+	}
+	local := []Modulator{
+		{0x0081, gen_VibratoLfoToPitch, 100, 0, 0},
+		{0x0081, gen_InitialFilterCutoffFrequency, -1200, 0, 0},
+	}
+
+	merged := mergeModulators(global, local)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 modulators, but got %d", len(merged))
+	}
+	if merged[0].Amount != 100 {
+		t.Error("the local modulator did not supersede the global one")
+	}
+	if merged[1] != global[1] {
+		t.Error("the global modulator was lost")
+	}
+	if merged[2] != local[1] {
+		t.Error("the local modulator was not added")
+	}
+	if global[0].Amount != 50 {
+		t.Error("the global modulators were modified")
+	}
+}
+
+func TestModulatorSource(t *testing.T) {
+	v := &voice{key: 60, velocity: 64}
+	ch := &channel{}
+	ch.reset()
+
+	// Linear, unipolar, positive.
+	areEqual(t, float64(calcModulatorSource(0x0002, v, ch)), 0.5)
+	// Linear, unipolar, negative.
+	areEqual(t, float64(calcModulatorSource(0x0102, v, ch)), 0.5)
+	// Linear, bipolar, positive (pan is centered by default).
+	if calcModulatorSource(0x028A, v, ch) != 0 {
+		t.Error("the centered pan should be zero")
+	}
+	// Switch, unipolar, positive.
+	if calcModulatorSource(0x0C02, v, ch) != 1 {
+		t.Error("the switch should be on")
+	}
+	// Concave, unipolar, negative (velocity 127 should give almost no attenuation).
+	v.velocity = 127
+	if calcModulatorSource(0x0502, v, ch) > 0.01 {
+		t.Error("the concave curve is wrong")
+	}
+
+	ch.setControllerValue(0x01, 127)
+	if calcModulatorSource(0x0081, v, ch) < 0.99 {
+		t.Error("the controller value was not used")
+	}
+
+	ch.setPitchBend(0, 0)
+	areEqual(t, float64(calcModulatorSource(0x020E, v, ch)), -1)
+}
+
+func TestModulatorValue(t *testing.T) {
+	v := &voice{key: 60, velocity: 100}
+	ch := &channel{}
+	ch.reset()
+
+	ch.setControllerValue(0x4A, 0)
+	mod := Modulator{0x02CA, gen_InitialFilterCutoffFrequency, 2400, 0, modtrans_Linear}
+	areEqual(t, float64(mod.getValue(v, ch)), -2400)
+
+	mod.TransformOperator = modtrans_AbsoluteValue
+	areEqual(t, float64(mod.getValue(v, ch)), 2400)
+
+	// Linked modulators are ignored.
+	mod.DestinationGenerator = 0x8001
+	if mod.getValue(v, ch) != 0 {
+		t.Error("the linked modulator should be ignored")
+	}
+}
+
+func TestModulatorSource_Pressure(t *testing.T) {
+	v := &voice{key: 60, velocity: 100}
+	ch := &channel{}
+	ch.reset()
+
+	ch.setChannelPressure(64)
+	areEqual(t, float64(calcModulatorSource(0x000D, v, ch)), 0.5)
+
+	ch.setPolyPressure(60, 127)
+	ch.setPolyPressure(61, 32)
+	if calcModulatorSource(0x000A, v, ch) < 0.99 {
+		t.Error("the pressure of the key was not used")
+	}
+
+	ch.resetAllControllers()
+	if calcModulatorSource(0x000D, v, ch) != 0 || calcModulatorSource(0x000A, v, ch) != 0 {
+		t.Error("the pressures should be reset")
+	}
+}
+
+func TestSynthesizer_Pressure(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0)
+
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.NoteOn(0, 64, 100)
+	synthesizer.ProcessMidiMessage(0, 0xA0, 64, 127)
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+	synthesizer.Render(left, right)
+
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		depth := voice.modulatorOffsets[gen_VibratoLfoToPitch]
+		if voice.key == 64 && depth < 49 {
+			t.Error("the poly pressure should deepen the vibrato of the key")
+		}
+		if voice.key == 60 && depth != 0 {
+			t.Error("the poly pressure should not affect the other keys")
+		}
+	}
+
+	attenuations := make(map[int32]float32)
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		attenuations[voice.key] = voice.modulatorOffsets[gen_InitialAttenuation]
+	}
+
+	synthesizer.ProcessMidiMessage(0, 0xD0, 127, 0)
+	synthesizer.Render(left, right)
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		if voice.modulatorOffsets[gen_VibratoLfoToPitch] < 49 {
+			t.Error("the channel pressure should deepen the vibrato")
+		}
+		attenuation := voice.modulatorOffsets[gen_InitialAttenuation]
+		if attenuation >= attenuations[voice.key] {
+			t.Error("the channel pressure should swell the volume")
+		}
+		if attenuation < 0 {
+			t.Error("the pressure should not boost the volume above the level without the modulators")
+		}
+	}
+}
+
+// Pins the output with the SF2.01 default modulators,
+// where the velocity lowers the cutoff and the channel pressure deepens the vibrato and swells the volume,
+// which is attenuated without the pressure.
+func TestDefaultModulators_Rendering(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0)
+
+	left := make([]float32, 4096)
+	right := make([]float32, 4096)
+	check := func(name string, energy float64, expected map[int]float32) {
+		var sum float64
+		for i := range left {
+			sum += float64(left[i])*float64(left[i]) + float64(right[i])*float64(right[i])
+		}
+		if math.Abs(sum-energy) > 1.0e-5 {
+			t.Errorf("%s: expected the energy %f, but got %f", name, energy, sum)
+		}
+		for i, value := range expected {
+			if math.Abs(float64(left[i]-value)) > 1.0e-6 {
+				t.Errorf("%s: sample %d: expected %f, but got %f", name, i, value, left[i])
+			}
+		}
+	}
+
+	synthesizer.NoteOn(0, 60, 40)
+	synthesizer.Render(left, right)
+	check("velocity", 0.18467253, map[int]float32{100: -0.000383202743, 1000: -0.000494353706, 4095: -0.0025575615})
+
+	synthesizer.ProcessMidiMessage(0, 0xD0, 127, 0)
+	synthesizer.Render(left, right)
+	check("pressure", 0.28955755, map[int]float32{100: -0.00395048922, 1000: -0.0083010206, 4095: 0.00527273212})
+}
+
+func TestVoice_ModulatorUpdate(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0)
+
+	synthesizer.NoteOn(0, 60, 100)
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+	synthesizer.Render(left, right)
+	voice := synthesizer.voices.voices[0]
+
+	// The modulators are not evaluated unless the channel is changed.
+	voice.modulatorOffsets[gen_VibratoLfoToPitch] = 1234
+	synthesizer.Render(left, right)
+	if voice.modulatorOffsets[gen_VibratoLfoToPitch] != 1234 {
+		t.Error("the modulators should not be evaluated without any change")
+	}
+
+	synthesizer.ProcessMidiMessage(0, 0xD0, 127, 0)
+	synthesizer.Render(left, right)
+	if voice.modulatorOffsets[gen_VibratoLfoToPitch] != 50*127.0/128 {
+		t.Errorf("the modulators should be evaluated after the change: %f", voice.modulatorOffsets[gen_VibratoLfoToPitch])
+	}
+}
+
+func TestCreateZones_InvalidModulatorList(t *testing.T) {
+	p := newSoundFontParser(bytes.NewReader(nil), false)
+	infos := []*zoneInfo{
+		{generatorIndex: 0, modulatorIndex: 0, generatorCount: 1, modulatorCount: 1},
+		{generatorIndex: 1, modulatorIndex: 5, generatorCount: 0, modulatorCount: 2},
+		{generatorIndex: 1, modulatorIndex: 1},
+	}
+	generators := []generator{{generatorType: gen_Pan, value: 100}}
+	modulators := []Modulator{{0x0502, gen_InitialAttenuation, 960, 0, 0}}
+
+	zones, err := createZones(p, "pbag", infos, generators, modulators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones[0].modulators) != 1 {
+		t.Error("the valid modulator list was dropped")
+	}
+	if len(zones[1].modulators) != 0 {
+		t.Error("the invalid modulator list was not dropped")
+	}
+	if len(p.warnings) != 1 {
+		t.Errorf("expected 1 warning, but got %d", len(p.warnings))
+	}
+}
+
+func TestDefaultModulators_Disabled(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.EnableDefaultModulators = false
+	}, 0)
+
+	synthesizer.NoteOn(0, 60, 40)
+	voice := synthesizer.voices.voices[0]
+	if len(voice.modulators) != 0 {
+		t.Errorf("expected no modulator, but got %d", len(voice.modulators))
+	}
+	if voice.startOffsets[gen_InitialFilterCutoffFrequency] != 0 {
+		t.Error("the velocity should not darken the sound")
+	}
+	if voice.builtins&builtin_NoteOnVelocity == 0 {
+		t.Error("the built-in modulators should be kept")
+	}
+}
@@ -0,0 +1,94 @@
+package meltysynth
+
+// The MPE zones, where the lower zone is managed by the first channel and the upper zone by the last one.
+// The member channels of the lower zone follow its master, and the ones of the upper zone precede its master.
+const (
+	mpe_LowerMaster     int32 = 0
+	mpe_UpperMaster     int32 = 15
+	mpe_MaxMembers      int32 = 15
+	mpe_MemberBendRange int32 = 48
+	mpe_MasterBendRange int32 = 2
+)
+
+// The timbre (CC74) of the member channel controls the brightness of the note, where 64 is the center.
+var mpe_TimbreModulator = Modulator{0x02CA, gen_InitialFilterCutoffFrequency, 2400, 0x0000, modtrans_Linear}
+
+// Handles the data entry of the RPNs which affect the other channels.
+func (s *Synthesizer) processMpeDataEntry(channel int32, value int32) {
+	channelInfo := s.channels[channel]
+	if channelInfo.nrpnSelected {
+		return
+	}
+
+	switch channelInfo.rpn {
+	case 0:
+		s.shareMpeBendRange(channel)
+	case 6: // MPE Configuration Message
+		s.configureMpeZone(channel, value)
+	}
+}
+
+// The pitch bend range set on a member channel applies to all the member channels of the zone.
+func (s *Synthesizer) shareMpeBendRange(channel int32) {
+	channelInfo := s.channels[channel]
+	if channelInfo.nrpnSelected || channelInfo.rpn != 0 || channelInfo.mpeMaster == -1 {
+		return
+	}
+
+	for _, ch := range s.channels {
+		if ch.mpeMaster == channelInfo.mpeMaster {
+			ch.pitchBendRange = channelInfo.pitchBendRange
+			ch.modulatorSerial++
+		}
+	}
+}
+
+// Sets the number of the member channels of the zone, where 0 disables the zone.
+// If the zones overlap, the other one is shrunk.
+func (s *Synthesizer) configureMpeZone(channel int32, count int32) {
+	if count > mpe_MaxMembers {
+		count = mpe_MaxMembers
+	}
+
+	switch channel {
+	case mpe_LowerMaster:
+		s.mpeLowerMembers = count
+		if s.mpeLowerMembers+s.mpeUpperMembers > mpe_MaxMembers-1 {
+			s.mpeUpperMembers = mpe_MaxMembers - 1 - count
+			if s.mpeUpperMembers < 0 {
+				s.mpeUpperMembers = 0
+			}
+		}
+	case mpe_UpperMaster:
+		s.mpeUpperMembers = count
+		if s.mpeLowerMembers+s.mpeUpperMembers > mpe_MaxMembers-1 {
+			s.mpeLowerMembers = mpe_MaxMembers - 1 - count
+			if s.mpeLowerMembers < 0 {
+				s.mpeLowerMembers = 0
+			}
+		}
+	default:
+		return
+	}
+
+	for i, ch := range s.channels {
+		index := int32(i)
+		ch.mpeMaster = -1
+		if 1 <= index && index <= s.mpeLowerMembers {
+			ch.mpeMaster = mpe_LowerMaster
+		} else if mpe_UpperMaster-s.mpeUpperMembers <= index && index < mpe_UpperMaster {
+			ch.mpeMaster = mpe_UpperMaster
+		}
+	}
+
+	// The configured zone starts with the default pitch bend ranges and the centered timbre.
+	s.channels[channel].pitchBendRange = int16(mpe_MasterBendRange << 7)
+	s.channels[channel].modulatorSerial++
+	for _, ch := range s.channels {
+		if ch.mpeMaster == channel {
+			ch.pitchBendRange = int16(mpe_MemberBendRange << 7)
+			ch.controllerValues[0x4A] = 64
+			ch.modulatorSerial++
+		}
+	}
+}
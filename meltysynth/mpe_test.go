@@ -0,0 +1,121 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+func sendRpn(synthesizer *Synthesizer, channel int32, rpn int32, value int32) {
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x65, rpn>>7)
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x64, rpn&0x7F)
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x06, value)
+}
+
+func TestSynthesizer_MpeZones(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	sendRpn(synthesizer, 0, 6, 5)
+	for i, ch := range synthesizer.channels {
+		expected := int32(-1)
+		if 1 <= i && i <= 5 {
+			expected = 0
+		}
+		if ch.mpeMaster != expected {
+			t.Errorf("channel %d: expected the master %d, but got %d", i, expected, ch.mpeMaster)
+		}
+	}
+	if synthesizer.channels[3].getPitchBendRange() != 48 || synthesizer.channels[0].getPitchBendRange() != 2 {
+		t.Error("the zone should start with the default pitch bend ranges")
+	}
+
+	// The upper zone shrinks the lower one.
+	sendRpn(synthesizer, 15, 6, 12)
+	if synthesizer.mpeLowerMembers != 2 || synthesizer.channels[3].mpeMaster != 15 || synthesizer.channels[2].mpeMaster != 0 {
+		t.Errorf("expected the lower zone with 2 members, but got %d", synthesizer.mpeLowerMembers)
+	}
+
+	// The pitch bend range set on a member channel is shared by the zone.
+	sendRpn(synthesizer, 5, 0, 24)
+	for i := 3; i < 15; i++ {
+		if synthesizer.channels[i].getPitchBendRange() != 24 {
+			t.Fatalf("channel %d: the pitch bend range should be shared by the zone", i)
+		}
+	}
+	if synthesizer.channels[1].getPitchBendRange() != 48 {
+		t.Error("the other zone should not be affected")
+	}
+
+	// The zone is disabled by the reset.
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7})
+	for i, ch := range synthesizer.channels {
+		if ch.mpeMaster != -1 {
+			t.Errorf("channel %d: the zone should be disabled", i)
+		}
+	}
+}
+
+func TestSynthesizer_MpeNotes(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	lead := createStackTestSoundFont(t, "lead", 1)
+	synthesizer.AddSoundFont(lead)
+
+	sendRpn(synthesizer, 0, 6, 15)
+	synthesizer.ProcessMidiMessage(0, 0xC0, 1, 0)
+
+	// The member channels use the preset of the master channel.
+	synthesizer.NoteOn(1, 60, 100)
+	synthesizer.NoteOn(2, 64, 100)
+	first := findPlayingVoice(t, synthesizer, 1)
+	second := findPlayingVoice(t, synthesizer, 2)
+	if first.soundFont != lead || first.master != synthesizer.channels[0] {
+		t.Fatal("the note on the member channel should use the preset of the master channel")
+	}
+
+	// The timbre only affects the note on the same member channel.
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x4A, 127)
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+	synthesizer.Render(left, right)
+	if first.modulatorOffsets[gen_InitialFilterCutoffFrequency] <= 0 {
+		t.Error("the timbre should raise the cutoff")
+	}
+	if second.modulatorOffsets[gen_InitialFilterCutoffFrequency] != 0 {
+		t.Error("the timbre of the other member channel should be centered")
+	}
+}
+
+func TestSynthesizer_MpePitchBend(t *testing.T) {
+	// The note bent by an octave on a member channel sounds the same as the note an octave higher.
+	mpe := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	sendRpn(mpe, 0, 6, 15)
+	mpe.ProcessMidiMessage(1, 0xE0, 0x00, 0x50) // +12 of 48 semitones.
+	mpe.NoteOn(1, 60, 100)
+	mpe.ProcessMidiMessage(2, 0xE0, 0x00, 0x30) // -12 of 48 semitones, which is not applied to the other note.
+
+	reference := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	reference.NoteOn(0, 72, 100)
+
+	length := 4096
+	mpeLeft := make([]float32, length)
+	mpeRight := make([]float32, length)
+	mpe.Render(mpeLeft, mpeRight)
+	referenceLeft := make([]float32, length)
+	referenceRight := make([]float32, length)
+	reference.Render(referenceLeft, referenceRight)
+	for i := 0; i < length; i++ {
+		if math.Abs(float64(mpeLeft[i]-referenceLeft[i])) > 1.0e-4 {
+			t.Fatalf("the output differs from the reference at %d", i)
+		}
+	}
+
+	// The pitch bend of the master channel is added to all the notes in the zone.
+	mpe.ProcessMidiMessage(0, 0xE0, 0x00, 0x60)
+	reference.ProcessMidiMessage(0, 0xE0, 0x00, 0x60)
+	mpe.Render(mpeLeft, mpeRight)
+	reference.Render(referenceLeft, referenceRight)
+	for i := 0; i < length; i++ {
+		if math.Abs(float64(mpeLeft[i]-referenceLeft[i])) > 1.0e-4 {
+			t.Fatalf("the master pitch bend should be applied at %d", i)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package meltysynth
+
+// The sub-IDs of the MIDI Tuning Standard messages.
+const (
+	mts_BulkDump         byte = 0x01
+	mts_SingleNote       byte = 0x02
+	mts_KeyBasedDump     byte = 0x04
+	mts_ScaleOctaveDump1 byte = 0x05
+	mts_ScaleOctaveDump2 byte = 0x06
+	mts_SingleNoteBank   byte = 0x07
+	mts_ScaleOctave1     byte = 0x08
+	mts_ScaleOctave2     byte = 0x09
+)
+
+const (
+	mts_DumpNameLength int   = 16
+	mts_NoChange       int32 = 0x7F<<14 | 0x7F<<7 | 0x7F
+)
+
+// F0 7E/7F dev 08 sub ... F7
+// The real-time and non-real-time messages are treated in the same way,
+// since the pitch of the notes playing is updated for every block anyway.
+// The checksums of the dumps are not verified.
+func (s *Synthesizer) processTuningSysEx(data []byte) {
+	body := data[4:]
+
+	switch data[3] {
+	case mts_BulkDump:
+		// tt name[16] (xx yy zz)*128
+		if len(body) >= 1+mts_DumpNameLength+3*128 {
+			s.setTuningKeys(0, int32(body[0]), body[1+mts_DumpNameLength:])
+		}
+
+	case mts_KeyBasedDump:
+		// bb tt name[16] (xx yy zz)*128
+		if len(body) >= 2+mts_DumpNameLength+3*128 {
+			s.setTuningKeys(int32(body[0]), int32(body[1]), body[2+mts_DumpNameLength:])
+		}
+
+	case mts_SingleNote:
+		// tt ll (kk xx yy zz)*ll
+		if len(body) >= 2 {
+			s.changeTuningNotes(0, int32(body[0]), int32(body[1]), body[2:])
+		}
+
+	case mts_SingleNoteBank:
+		// bb tt ll (kk xx yy zz)*ll
+		if len(body) >= 3 {
+			s.changeTuningNotes(int32(body[0]), int32(body[1]), int32(body[2]), body[3:])
+		}
+
+	case mts_ScaleOctaveDump1, mts_ScaleOctaveDump2:
+		// bb tt name[16] (the offsets of the 12 pitch classes)
+		if len(body) < 2+mts_DumpNameLength {
+			return
+		}
+		var offsets [12]float32
+		if !readScaleOctaveOffsets(&offsets, data[3] == mts_ScaleOctaveDump2, body[2+mts_DumpNameLength:]) {
+			return
+		}
+		tuning := NewTuning()
+		for i := range tuning.Keys {
+			tuning.Keys[i] += offsets[i%12]
+		}
+		s.SetTuningProgram(int32(body[0]), int32(body[1]), tuning)
+
+	case mts_ScaleOctave1, mts_ScaleOctave2:
+		// ff gg hh (the offsets of the 12 pitch classes)
+		if len(body) < 3 {
+			return
+		}
+		var offsets [12]float32
+		if !readScaleOctaveOffsets(&offsets, data[3] == mts_ScaleOctave2, body[3:]) {
+			return
+		}
+		// The bits of ff, gg and hh correspond to the channels 15-16, 8-14 and 1-7.
+		mask := int32(body[0]&0x03)<<14 | int32(body[1]&0x7F)<<7 | int32(body[2]&0x7F)
+		for i, ch := range s.channels {
+			if mask&(1<<i) != 0 {
+				ch.scaleTuning = offsets
+			}
+		}
+	}
+}
+
+// Reads the tuning of all the keys.
+func (s *Synthesizer) setTuningKeys(bank int32, program int32, data []byte) {
+	tuning := NewTuning()
+	for key := range tuning.Keys {
+		pitch, changed := readMtsPitch(data[3*key:])
+		if changed {
+			tuning.Keys[key] = pitch
+		}
+	}
+	s.SetTuningProgram(bank, program, tuning)
+}
+
+// Changes the tuning of the keys, which also affects the notes playing with the tuning program.
+// The registered tuning may be shared with the caller of SetTuningProgram, so the changes are made on a copy of it.
+func (s *Synthesizer) changeTuningNotes(bank int32, program int32, count int32, data []byte) {
+	tuning := NewTuning()
+	if current, found := s.tuningPrograms[(bank<<7)|program]; found {
+		*tuning = *current
+	}
+
+	for i := int32(0); i < count && int(4*i+3) < len(data); i++ {
+		key := data[4*i] & 0x7F
+		pitch, changed := readMtsPitch(data[4*i+1:])
+		if changed {
+			tuning.Keys[key] = pitch
+		}
+	}
+
+	s.SetTuningProgram(bank, program, tuning)
+}
+
+// The channels selecting the tuning program refer to the new one.
+func (s *Synthesizer) updateChannelTunings() {
+	for _, ch := range s.channels {
+		if ch.tuningSelected {
+			ch.selectTuningProgram()
+		}
+	}
+}
+
+// xx yy zz, where xx is the semitone and yyzz is the fraction of it in 14 bits.
+func readMtsPitch(data []byte) (float32, bool) {
+	value := int32(data[0]&0x7F)<<14 | int32(data[1]&0x7F)<<7 | int32(data[2]&0x7F)
+	if value == mts_NoChange {
+		return 0, false
+	}
+	return float32(value>>14) + float32(value&0x3FFF)/16384, true
+}
+
+// Reads the offsets in semitones, which are given in cents from -64 to 63 in the 1-byte form,
+// or in 14 bits from -100 to 100 cents in the 2-byte form.
+func readScaleOctaveOffsets(offsets *[12]float32, twoBytes bool, data []byte) bool {
+	if twoBytes {
+		if len(data) < 24 {
+			return false
+		}
+		for i := range offsets {
+			value := int32(data[2*i]&0x7F)<<7 | int32(data[2*i+1]&0x7F)
+			offsets[i] = float32(value-8192) / 8192
+		}
+	} else {
+		if len(data) < 12 {
+			return false
+		}
+		for i := range offsets {
+			offsets[i] = float32(int32(data[i]&0x7F)-64) / 100
+		}
+	}
+	return true
+}
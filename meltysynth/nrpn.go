@@ -0,0 +1,163 @@
+package meltysynth
+
+import "math"
+
+// The sound-edit parameters of GS/XG, selected by the NRPN MSB 0x01.
+const (
+	nrpn_VibratoRate    int32 = 0
+	nrpn_VibratoDepth   int32 = 1
+	nrpn_VibratoDelay   int32 = 2
+	nrpn_FilterCutoff   int32 = 3
+	nrpn_FilterQ        int32 = 4
+	nrpn_AttackTime     int32 = 5
+	nrpn_DecayTime      int32 = 6
+	nrpn_ReleaseTime    int32 = 7
+	nrpn_ParameterCount int32 = 8
+)
+
+func (ch *channel) resetNrpn() {
+	ch.nrpn = -1
+	ch.nrpnSelected = false
+	for i := 0; i < len(ch.nrpnValues); i++ {
+		ch.nrpnValues[i] = 64
+	}
+	for i := 0; i < 128; i++ {
+		ch.drumPitch[i] = 64
+		ch.drumLevel[i] = 127
+		ch.drumPan[i] = 64
+	}
+}
+
+func (ch *channel) setNrpnCoarse(value int32) {
+	ch.nrpn = int16((int32(ch.nrpn) & 0x7F) | (value << 7))
+	ch.nrpnSelected = true
+}
+
+func (ch *channel) setNrpnFine(value int32) {
+	ch.nrpn = int16((int32(ch.nrpn) & 0xFF80) | value)
+	ch.nrpnSelected = true
+}
+
+// Returns the raw value of the parameter selected by the NRPN, or nil if the parameter is not supported.
+// The values are relative to 64, except for the drum level.
+// The drum parameters are only accepted on the percussion channels.
+func (ch *channel) getNrpnTarget() *byte {
+	if ch.nrpn < 0 {
+		return nil
+	}
+
+	lsb := ch.nrpn & 0x7F
+	msb := ch.nrpn >> 7
+	if (msb == 0x18 || msb == 0x1A || msb == 0x1C) && !ch.isPercussionChannel {
+		return nil
+	}
+
+	switch msb {
+	case 0x01:
+		switch lsb {
+		case 0x08:
+			return &ch.nrpnValues[nrpn_VibratoRate]
+		case 0x09:
+			return &ch.nrpnValues[nrpn_VibratoDepth]
+		case 0x0A:
+			return &ch.nrpnValues[nrpn_VibratoDelay]
+		case 0x20:
+			return &ch.nrpnValues[nrpn_FilterCutoff]
+		case 0x21:
+			return &ch.nrpnValues[nrpn_FilterQ]
+		case 0x63:
+			return &ch.nrpnValues[nrpn_AttackTime]
+		case 0x64:
+			return &ch.nrpnValues[nrpn_DecayTime]
+		case 0x66:
+			return &ch.nrpnValues[nrpn_ReleaseTime]
+		}
+	case 0x18: // Drum pitch coarse.
+		return &ch.drumPitch[lsb]
+	case 0x1A: // Drum level.
+		return &ch.drumLevel[lsb]
+	case 0x1C: // Drum pan.
+		return &ch.drumPan[lsb]
+	}
+
+	return nil
+}
+
+// Changes the selected RPN or NRPN by the step of the data increment and decrement.
+// The RPNs are changed in the same way as the data entry.
+func (s *Synthesizer) dataIncrement(channel int32, delta int32) {
+	ch := s.channels[channel]
+	if ch.nrpnSelected {
+		target := ch.getNrpnTarget()
+		if target != nil {
+			*target = byte(clampDataEntry(int32(*target) + delta))
+		}
+		return
+	}
+
+	switch ch.rpn {
+	case 0:
+		s.dataEntryCoarse(channel, clampDataEntry(int32(ch.pitchBendRange>>7)+delta))
+	case 1:
+		s.dataEntryCoarse(channel, clampDataEntry(int32(ch.fineTune>>7)+delta))
+	case 2:
+		s.dataEntryCoarse(channel, clampDataEntry(int32(ch.coarseTune)+64+delta))
+	}
+}
+
+// The RPNs may affect the other channels of the MPE zone.
+func (s *Synthesizer) dataEntryCoarse(channel int32, value int32) {
+	s.channels[channel].dataEntryCoarse(value)
+	s.processMpeDataEntry(channel, value)
+}
+
+func clampDataEntry(value int32) int32 {
+	if value < 0 {
+		return 0
+	}
+	if value > 127 {
+		return 127
+	}
+	return value
+}
+
+// Adds the offsets of the NRPN parameters to the generators of the voice at the note-on.
+// The changes take effect from the next note.
+func (ch *channel) applyNrpnOffsets(offsets *[61]float32, key int32) {
+	// The full range of the relative values (-64 to 63) corresponds to the following amounts.
+	vibratoRate := float32(ch.nrpnValues[nrpn_VibratoRate]) - 64
+	vibratoDepth := float32(ch.nrpnValues[nrpn_VibratoDepth]) - 64
+	vibratoDelay := float32(ch.nrpnValues[nrpn_VibratoDelay]) - 64
+	cutoff := float32(ch.nrpnValues[nrpn_FilterCutoff]) - 64
+	resonance := float32(ch.nrpnValues[nrpn_FilterQ]) - 64
+	attack := float32(ch.nrpnValues[nrpn_AttackTime]) - 64
+	decay := float32(ch.nrpnValues[nrpn_DecayTime]) - 64
+	release := float32(ch.nrpnValues[nrpn_ReleaseTime]) - 64
+
+	offsets[gen_FrequencyVibratoLfo] += vibratoRate * (1200.0 / 64) // One octave.
+	offsets[gen_VibratoLfoToPitch] += vibratoDepth * (100.0 / 64)   // One semitone.
+	offsets[gen_DelayVibratoLfo] += vibratoDelay * (2400.0 / 64)    // Four times.
+	offsets[gen_InitialFilterCutoffFrequency] += cutoff * (4800.0 / 64)
+	offsets[gen_InitialFilterQ] += resonance * (240.0 / 64)
+	offsets[gen_AttackVolumeEnvelope] += attack * (4800.0 / 64)
+	offsets[gen_AttackModulationEnvelope] += attack * (4800.0 / 64)
+	offsets[gen_DecayVolumeEnvelope] += decay * (4800.0 / 64)
+	offsets[gen_DecayModulationEnvelope] += decay * (4800.0 / 64)
+	offsets[gen_ReleaseVolumeEnvelope] += release * (4800.0 / 64)
+	offsets[gen_ReleaseModulationEnvelope] += release * (4800.0 / 64)
+
+	if !(0 <= key && key < 128) || !ch.isPercussionChannel {
+		return
+	}
+
+	offsets[gen_CoarseTune] += float32(ch.drumPitch[key]) - 64
+	offsets[gen_Pan] += (float32(ch.drumPan[key]) - 64) * (500.0 / 64)
+
+	// The initial attenuation is reduced to 40% in the voice, which is compensated here.
+	level := ch.drumLevel[key]
+	if level == 0 {
+		offsets[gen_InitialAttenuation] += 1440 / 0.4
+	} else if level < 127 {
+		offsets[gen_InitialAttenuation] += float32(-200 * math.Log10(float64(level)/127) / 0.4)
+	}
+}
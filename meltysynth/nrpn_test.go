@@ -0,0 +1,114 @@
+package meltysynth
+
+import "testing"
+
+func sendNrpn(synthesizer *Synthesizer, channel int32, msb int32, lsb int32, value int32) {
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x63, msb)
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x62, lsb)
+	synthesizer.ProcessMidiMessage(channel, 0xB0, 0x06, value)
+}
+
+func TestChannel_Nrpn(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0, 128<<16)
+	ch := synthesizer.channels[0]
+
+	sendNrpn(synthesizer, 0, 0x01, 0x20, 80)
+	if ch.nrpnValues[nrpn_FilterCutoff] != 80 {
+		t.Errorf("expected the cutoff 80, but got %d", ch.nrpnValues[nrpn_FilterCutoff])
+	}
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x60, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x60, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x61, 0)
+	if ch.nrpnValues[nrpn_FilterCutoff] != 81 {
+		t.Errorf("expected the cutoff 81 after the increment, but got %d", ch.nrpnValues[nrpn_FilterCutoff])
+	}
+
+	// Selecting the RPN switches the data entry back.
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x65, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x64, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x06, 12)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x60, 0)
+	if ch.getPitchBendRange() != 13 {
+		t.Errorf("expected the pitch bend range 13, but got %f", ch.getPitchBendRange())
+	}
+	if ch.nrpnValues[nrpn_FilterCutoff] != 81 {
+		t.Error("the NRPN should not be changed by the RPN data entry")
+	}
+
+	// The offset is added to the ones of the default modulators.
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.NoteOn(1, 60, 100)
+	offset := synthesizer.voices.voices[0].startOffsets[gen_InitialFilterCutoffFrequency] -
+		synthesizer.voices.voices[1].startOffsets[gen_InitialFilterCutoffFrequency]
+	if offset != 17*75 {
+		t.Errorf("expected the cutoff offset %d, but got %f", 17*75, offset)
+	}
+}
+
+func TestChannel_NrpnDrum(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0, 128<<16)
+
+	sendNrpn(synthesizer, 9, 0x18, 36, 76)
+	sendNrpn(synthesizer, 9, 0x1C, 36, 0)
+	sendNrpn(synthesizer, 9, 0x1A, 38, 0)
+	synthesizer.NoteOn(9, 36, 100)
+	synthesizer.NoteOn(9, 38, 100)
+
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		switch voice.key {
+		case 36:
+			if voice.startOffsets[gen_CoarseTune] != 12 {
+				t.Error("the drum should be pitched up by an octave")
+			}
+			if voice.instrumentPan != -50 {
+				t.Errorf("the drum should be panned to the left, but got %f", voice.instrumentPan)
+			}
+		case 38:
+			if voice.noteGain > nonAudible {
+				t.Error("the drum with the level 0 should be silent")
+			}
+		}
+	}
+
+	// The other keys are not affected.
+	synthesizer.NoteOn(9, 40, 100)
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		if voice.key == 40 && (voice.startOffsets[gen_CoarseTune] != 0 || voice.startOffsets[gen_Pan] != 0) {
+			t.Error("the other drums should not be affected")
+		}
+	}
+}
+
+func TestChannel_NrpnDrum_MelodicChannel(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0)
+
+	// The drum parameters sent to the melodic channel are ignored.
+	sendNrpn(synthesizer, 0, 0x18, 60, 76)
+	sendNrpn(synthesizer, 0, 0x1A, 60, 0)
+	if synthesizer.channels[0].drumPitch[60] != 64 || synthesizer.channels[0].drumLevel[60] != 127 {
+		t.Error("the drum parameters should not be stored on the melodic channel")
+	}
+
+	synthesizer.channels[0].drumPitch[60] = 76
+	synthesizer.NoteOn(0, 60, 100)
+	voice := findActiveVoice(synthesizer, 0, 60)
+	if voice == nil || voice.startOffsets[gen_CoarseTune] != 0 || voice.noteGain < nonAudible {
+		t.Error("the drum parameters should not be applied to the melodic channel")
+	}
+}
+
+func TestChannel_DataIncrement_MpeBendRange(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, nil, 0)
+	sendRpn(synthesizer, 0, 6, 3)
+
+	// The pitch bend range changed by the data increment is shared by the zone, like the data entry.
+	sendRpn(synthesizer, 1, 0, 24)
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x60, 0)
+	for i := 1; i <= 3; i++ {
+		if synthesizer.channels[i].getPitchBendRange() != 25 {
+			t.Errorf("channel %d: expected the pitch bend range 25, but got %f", i, synthesizer.channels[i].getPitchBendRange())
+		}
+	}
+}
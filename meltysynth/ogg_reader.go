@@ -0,0 +1,80 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Reads the packets of the first logical stream in the Ogg data.
+// The reading stops at the end of the stream, and the last granule position is returned.
+func readOggPackets(data []byte) ([][]byte, int64, error) {
+	var packets [][]byte
+	var packet []byte
+	var granule int64 = -1
+	var serial uint32
+
+	pos := 0
+	first := true
+	for pos+27 <= len(data) {
+		if string(data[pos:pos+4]) != "OggS" {
+			return nil, 0, errors.New("the ogg page was not found")
+		}
+		if data[pos+4] != 0 {
+			return nil, 0, errors.New("the ogg version is not supported")
+		}
+
+		headerType := data[pos+5]
+		pageGranule := int64(binary.LittleEndian.Uint64(data[pos+6 : pos+14]))
+		pageSerial := binary.LittleEndian.Uint32(data[pos+14 : pos+18])
+		segmentCount := int(data[pos+26])
+		pos += 27
+
+		if pos+segmentCount > len(data) {
+			return nil, 0, errors.New("the ogg page is truncated")
+		}
+		segments := data[pos : pos+segmentCount]
+		pos += segmentCount
+
+		if first {
+			serial = pageSerial
+			first = false
+		} else if pageSerial != serial {
+			// Skip the pages of other logical streams.
+			for _, segment := range segments {
+				pos += int(segment)
+			}
+			continue
+		}
+
+		for _, segment := range segments {
+			size := int(segment)
+			if pos+size > len(data) {
+				return nil, 0, errors.New("the ogg page is truncated")
+			}
+			packet = append(packet, data[pos:pos+size]...)
+			pos += size
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		if pageGranule != -1 {
+			granule = pageGranule
+		}
+
+		// The end of the stream.
+		if headerType&0x04 != 0 {
+			return packets, granule, nil
+		}
+	}
+
+	if first {
+		return nil, 0, errors.New("the ogg page was not found")
+	}
+	if pos < len(data) {
+		return nil, 0, errors.New("the ogg page is truncated")
+	}
+
+	return packets, granule, nil
+}
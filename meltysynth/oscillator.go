@@ -8,14 +8,18 @@ import (
 // A fixed-point number is expressed by Int64, whose lower 24 bits represent the fraction part,
 // and the rest represent the integer part.
 // For clarity, fixed-point number variables have a suffix "_fp".
+// The samples are always handled as 24-bit values,
+// so that the 16-bit and 24-bit SoundFonts share the same code path.
 
 const fracBits int32 = 24
 const fracUnit int64 = 1 << fracBits
-const fpToSample float32 = float32(1) / float32(32768*fracUnit)
+const fpToSample float32 = float32(1) / float32(8388608*fracUnit)
+const intToSample float32 = float32(1) / float32(8388608)
 
 type oscillator struct {
 	synthesizer      *Synthesizer
 	data             []int16
+	data24           []byte
 	loopMode         int32
 	sampleRate       int32
 	sampleStart      int32
@@ -28,6 +32,12 @@ type oscillator struct {
 	sampleRateRatio  float32
 	looping          bool
 	position_fp      int64
+
+	// Whether the position has jumped back to the start of the loop at least once.
+	// After that, the samples before the loop are replaced with the end of the loop for the interpolation.
+	wrapped bool
+
+	sincWeights [2 * interpolation_SincHalfWidth]float32
 }
 
 func newOscillator(s *Synthesizer) *oscillator {
@@ -36,8 +46,9 @@ func newOscillator(s *Synthesizer) *oscillator {
 	return result
 }
 
-func (o *oscillator) start(data []int16, loopMode int32, sampleRate int32, start int32, end int32, startLoop int32, endLoop int32, rootKey int32, coarseTune int32, fineTune int32, scaleTuning int32) {
+func (o *oscillator) start(data []int16, data24 []byte, loopMode int32, sampleRate int32, start int32, end int32, startLoop int32, endLoop int32, rootKey int32, coarseTune int32, fineTune int32, scaleTuning int32) {
 	o.data = data
+	o.data24 = data24
 	o.loopMode = loopMode
 	o.sampleRate = sampleRate
 	o.sampleStart = start
@@ -57,6 +68,7 @@ func (o *oscillator) start(data []int16, loopMode int32, sampleRate int32, start
 	}
 
 	o.position_fp = int64(start) << fracBits
+	o.wrapped = false
 }
 
 func (o *oscillator) release() {
@@ -66,14 +78,21 @@ func (o *oscillator) release() {
 }
 
 func (o *oscillator) process(block []float32, pitch float32) bool {
+	return o.fillBlock(block, o.getPitchRatio(pitch))
+}
+
+func (o *oscillator) getPitchRatio(pitch float32) float64 {
 	pitchChange := o.pitchChangeScale*(pitch-float32(o.rootKey)) + o.tune
-	pitchRatio := float64(o.sampleRateRatio) * math.Pow(float64(2), float64(pitchChange)/float64(12))
-	return o.fillBlock(block, pitchRatio)
+	return float64(o.sampleRateRatio) * math.Pow(float64(2), float64(pitchChange)/float64(12))
 }
 
 func (o *oscillator) fillBlock(block []float32, pitchRatio float64) bool {
 	pitchRatio_fp := int64(float64(fracUnit) * pitchRatio)
 
+	if o.synthesizer.Interpolation != InterpolationLinear {
+		return o.fillBlock_Kernel(block, pitchRatio_fp, pitchRatio)
+	}
+
 	if o.looping {
 		return o.fillBlock_Continuous(block, pitchRatio_fp)
 	} else {
@@ -96,8 +115,8 @@ func (o *oscillator) fillBlock_NoLoop(block []float32, pitchRatio_fp int64) bool
 			return false
 		}
 
-		x1 := int64(o.data[index])
-		x2 := int64(o.data[index+1])
+		x1 := o.getSample(index)
+		x2 := o.getSample(index + 1)
 		a_fp := o.position_fp & (fracUnit - 1)
 		block[t] = fpToSample * float32((x1<<fracBits)+a_fp*(x2-x1))
 
@@ -118,6 +137,7 @@ func (o *oscillator) fillBlock_Continuous(block []float32, pitchRatio_fp int64)
 	for t := 0; t < blockLength; t++ {
 		if o.position_fp >= endLoop_fp {
 			o.position_fp -= loopLength_fp
+			o.wrapped = true
 		}
 
 		index1 := int32(o.position_fp >> fracBits)
@@ -127,8 +147,8 @@ func (o *oscillator) fillBlock_Continuous(block []float32, pitchRatio_fp int64)
 			index2 -= loopLength
 		}
 
-		x1 := int64(o.data[index1])
-		x2 := int64(o.data[index2])
+		x1 := o.getSample(index1)
+		x2 := o.getSample(index2)
 		a_fp := o.position_fp & (fracUnit - 1)
 		block[t] = fpToSample * float32((x1<<fracBits)+a_fp*(x2-x1))
 
@@ -137,3 +157,105 @@ func (o *oscillator) fillBlock_Continuous(block []float32, pitchRatio_fp int64)
 
 	return true
 }
+
+// Renders the block with the interpolation other than the linear one.
+// The samples are read through readSample, so that the kernels wider than two samples respect the loop.
+func (o *oscillator) fillBlock_Kernel(block []float32, pitchRatio_fp int64, pitchRatio float64) bool {
+	blockLength := len(block)
+
+	endLoop_fp := int64(o.endLoop) << fracBits
+	loopLength_fp := int64(o.endLoop-o.startLoop) << fracBits
+
+	// The cutoff is lowered to avoid aliasing when the sample is played faster.
+	cutoff := float32(1)
+	if pitchRatio > 1 {
+		cutoff = float32(1 / pitchRatio)
+	}
+
+	for t := 0; t < blockLength; t++ {
+		if o.looping {
+			if o.position_fp >= endLoop_fp {
+				o.position_fp -= loopLength_fp
+				o.wrapped = true
+			}
+		} else if int32(o.position_fp>>fracBits) >= o.sampleEnd {
+			if t > 0 {
+				for i := t; i < blockLength; i++ {
+					block[i] = 0
+				}
+				return true
+			}
+			return false
+		}
+
+		index := int32(o.position_fp >> fracBits)
+		a := float32(o.position_fp&(fracUnit-1)) / float32(fracUnit)
+
+		switch o.synthesizer.Interpolation {
+		case InterpolationNearest:
+			if a >= 0.5 {
+				index++
+			}
+			block[t] = o.readSample(index)
+		case InterpolationCubic:
+			block[t] = interpolateCubic(o.readSample(index-1), o.readSample(index), o.readSample(index+1), o.readSample(index+2), a)
+		default:
+			weights := o.sincWeights[:]
+			calcSincWeights(weights, a, cutoff)
+			first := index - interpolation_SincHalfWidth + 1
+			last := first + int32(len(weights))
+			lower, upper := o.sampleStart, o.sampleEnd
+			if o.looping {
+				if o.wrapped {
+					lower = o.startLoop
+				}
+				upper = o.endLoop
+			}
+			var sum float32
+			if first >= lower && last <= upper && int(last) <= len(o.data) {
+				// Fast path for the kernel which does not cross the boundaries.
+				for i, weight := range weights {
+					sum += weight * float32(o.getSample(first+int32(i)))
+				}
+				sum *= intToSample
+			} else {
+				for i, weight := range weights {
+					sum += weight * o.readSample(first+int32(i))
+				}
+			}
+			block[t] = sum
+		}
+
+		o.position_fp += pitchRatio_fp
+	}
+
+	return true
+}
+
+// Reads the sample as a float, wrapping the index around the loop if necessary.
+// The samples outside the sample data are treated as silence.
+func (o *oscillator) readSample(index int32) float32 {
+	if o.looping && o.endLoop > o.startLoop {
+		loopLength := o.endLoop - o.startLoop
+		for index >= o.endLoop {
+			index -= loopLength
+		}
+		if o.wrapped {
+			for index < o.startLoop {
+				index += loopLength
+			}
+		}
+	}
+
+	if index < o.sampleStart || index >= o.sampleEnd || int(index) >= len(o.data) {
+		return 0
+	}
+	return intToSample * float32(o.getSample(index))
+}
+
+func (o *oscillator) getSample(index int32) int64 {
+	if o.data24 == nil {
+		return int64(o.data[index]) << 8
+	}
+	return (int64(o.data[index]) << 8) | int64(o.data24[index])
+}
@@ -0,0 +1,36 @@
+package meltysynth
+
+// The soft pedal lowers the level and the brightness of the notes played while it is pressed.
+// It is applied only at the note-on, so the notes already sounding are not affected.
+const (
+	pedal_SoftAttenuation float32 = 4    // In decibels.
+	pedal_SoftCutoff      float32 = 1200 // In cents.
+)
+
+// Only the notes whose keys are held at the moment the sostenuto pedal is pressed are sustained.
+func (s *Synthesizer) setSostenuto(channel int32, value int32) {
+	channelInfo := s.channels[channel]
+	pressed := value >= 64
+
+	if pressed && !channelInfo.sostenuto {
+		for i := int32(0); i < s.voices.activeVoiceCount; i++ {
+			voice := s.voices.voices[i]
+			if voice.channel == channel {
+				voice.sostenuto = voice.voiceState == voice_Playing
+			}
+		}
+	}
+
+	channelInfo.sostenuto = pressed
+}
+
+// Adds the offsets of the soft pedal to the generators of the voice at the note-on.
+func (ch *channel) applySoftPedal(offsets *[61]float32) {
+	if !ch.softPedal {
+		return
+	}
+
+	// The initial attenuation is reduced to 40% in the voice, which is compensated here.
+	offsets[gen_InitialAttenuation] += 10 * pedal_SoftAttenuation / 0.4
+	offsets[gen_InitialFilterCutoffFrequency] -= pedal_SoftCutoff
+}
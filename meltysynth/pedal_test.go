@@ -0,0 +1,118 @@
+package meltysynth
+
+import "testing"
+
+func TestSynthesizer_Sostenuto(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.Render(left, right)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x42, 127)
+	synthesizer.NoteOn(0, 64, 100)
+	caught := findActiveVoice(synthesizer, 0, 60)
+	other := findActiveVoice(synthesizer, 0, 64)
+	if caught == nil || other == nil {
+		t.Fatal("the voices were not found")
+	}
+
+	// Only the note held at the pedal-down is sustained.
+	synthesizer.Render(left, right)
+	synthesizer.NoteOff(0, 60)
+	synthesizer.NoteOff(0, 64)
+	synthesizer.Render(left, right)
+	if caught.voiceState != voice_ReleaseRequested {
+		t.Error("the note held at the pedal-down should be sustained")
+	}
+	if other.voiceState != voice_Released {
+		t.Error("the note played after the pedal-down should not be sustained")
+	}
+
+	// The hold pedal keeps the note after the sostenuto pedal is released.
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x40, 127)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x42, 0)
+	synthesizer.Render(left, right)
+	if caught.voiceState != voice_ReleaseRequested {
+		t.Error("the note should be sustained by the hold pedal")
+	}
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x40, 0)
+	synthesizer.Render(left, right)
+	if caught.voiceState != voice_Released {
+		t.Error("the note should be released when both pedals are released")
+	}
+
+	// The notes released before the pedal-down are not caught.
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x40, 127)
+	synthesizer.NoteOn(0, 67, 100)
+	released := findActiveVoice(synthesizer, 0, 67)
+	if released == nil {
+		t.Fatal("the voice was not found")
+	}
+	synthesizer.Render(left, right)
+	synthesizer.NoteOff(0, 67)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x42, 127)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x40, 0)
+	synthesizer.Render(left, right)
+	if released.voiceState != voice_Released {
+		t.Error("the note released before the pedal-down should not be sustained")
+	}
+}
+
+func TestSynthesizer_SoftPedal(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x43, 127)
+	synthesizer.NoteOn(1, 60, 100)
+	normal := findActiveVoice(synthesizer, 0, 60)
+	soft := findActiveVoice(synthesizer, 1, 60)
+	if normal == nil || soft == nil {
+		t.Fatal("the voices were not found")
+	}
+
+	decibels := calcLinearToDecibels(soft.noteGain) - calcLinearToDecibels(normal.noteGain)
+	if decibels < -pedal_SoftAttenuation-0.01 || decibels > -pedal_SoftAttenuation+0.01 {
+		t.Errorf("expected the level %f dB, but got %f dB", -pedal_SoftAttenuation, decibels)
+	}
+	if soft.cutoff >= normal.cutoff {
+		t.Error("the cutoff should be lowered by the soft pedal")
+	}
+
+	// The pedal only affects the notes played while it is pressed.
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x43, 0)
+	if soft.noteGain == normal.noteGain {
+		t.Error("the notes already playing should not be affected")
+	}
+	synthesizer.NoteOn(1, 64, 100)
+	if voice := findActiveVoice(synthesizer, 1, 64); voice == nil || voice.noteGain != normal.noteGain {
+		t.Error("the notes after the pedal-up should not be affected")
+	}
+}
+
+func TestSynthesizer_Sostenuto_Legato(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x7E, 1)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x42, 127)
+	synthesizer.NoteOff(0, 60)
+	synthesizer.Render(left, right)
+	voice := findActiveVoice(synthesizer, 0, 60)
+	if voice == nil || !voice.sostenuto {
+		t.Fatal("the note held at the pedal-down should be caught")
+	}
+
+	// The legato note is not the one caught by the pedal.
+	synthesizer.NoteOn(0, 62, 100)
+	if findActiveVoice(synthesizer, 0, 62) != voice {
+		t.Fatal("the voice should be moved to the new key")
+	}
+	synthesizer.NoteOff(0, 62)
+	synthesizer.Render(left, right)
+	if voice.voiceState != voice_Released {
+		t.Error("the legato note should not be sustained by the sostenuto pedal")
+	}
+}
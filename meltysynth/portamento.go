@@ -0,0 +1,170 @@
+package meltysynth
+
+import "math"
+
+func (ch *channel) setPortamentoTimeCoarse(value int32) {
+	ch.portamentoTime = int16((int32(ch.portamentoTime) & 0x7F) | (value << 7))
+}
+
+func (ch *channel) setPortamentoTimeFine(value int32) {
+	ch.portamentoTime = int16((int32(ch.portamentoTime) & 0xFF80) | value)
+}
+
+func (ch *channel) setPortamento(value int32) {
+	ch.portamento = value >= 64
+}
+
+func (ch *channel) setPortamentoControl(value int32) {
+	ch.portamentoControl = value
+}
+
+// Switches between the mono mode and the poly mode, which also turns off all the notes.
+func (ch *channel) setMonoMode(value bool) {
+	ch.monoMode = value
+	ch.clearHeldKeys()
+}
+
+// Returns the time in seconds to glide to the new key, regardless of the interval.
+// The time grows exponentially from 1 ms to about 30 s over the range of the controller.
+func (ch *channel) getPortamentoTime() float32 {
+	if ch.portamentoTime == 0 {
+		return 0
+	}
+	return float32(0.001 * math.Pow(10, 4.5*float64(ch.portamentoTime)/16383))
+}
+
+// Returns the key which the next note glides from, or -1 if the portamento is not applied.
+// The key given by the portamento control is consumed.
+func (ch *channel) takePortamentoSource() int32 {
+	if ch.portamentoControl >= 0 {
+		key := ch.portamentoControl
+		ch.portamentoControl = -1
+		return key
+	}
+	if ch.portamento && ch.portamentoTime > 0 {
+		return ch.lastKey
+	}
+	return -1
+}
+
+func (ch *channel) pushHeldKey(key int32) {
+	ch.removeHeldKey(key)
+	ch.heldKeys = append(ch.heldKeys, key)
+}
+
+func (ch *channel) clearHeldKeys() {
+	ch.heldKeys = ch.heldKeys[:0]
+}
+
+func (ch *channel) removeHeldKey(key int32) {
+	for i, k := range ch.heldKeys {
+		if k == key {
+			ch.heldKeys = append(ch.heldKeys[:i], ch.heldKeys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Moves the sounding voices of the channel to the new key without restarting the envelopes.
+// If the key is out of the regions of the sounding voices, they are faded out and the note is started
+// with the velocity, where 0 means the velocity of the sounding note.
+// Returns false if no voice is sounding, where the note should be started normally.
+func (s *Synthesizer) legato(channel int32, key int32, velocity int32) bool {
+	channelInfo := s.channels[channel]
+	control := channelInfo.portamentoControl
+
+	// Without the portamento, the pitch changes immediately.
+	var time float32
+	if channelInfo.portamento || control >= 0 {
+		time = channelInfo.getPortamentoTime()
+	}
+
+	var sounding *voice
+	sameRegion := true
+	for i := int32(0); i < s.voices.activeVoiceCount; i++ {
+		voice := s.voices.voices[i]
+		if voice.isSounding(channel) {
+			sounding = voice
+			sameRegion = sameRegion && voice.presetRegion.contains(key, voice.velocity) && voice.instrumentRegion.contains(key, voice.velocity)
+		}
+	}
+	if sounding == nil {
+		return false
+	}
+
+	// The sample of the other region cannot be continued, so the note is restarted.
+	if !sameRegion {
+		if velocity == 0 {
+			velocity = sounding.velocity
+		}
+		for i := int32(0); i < s.voices.activeVoiceCount; i++ {
+			voice := s.voices.voices[i]
+			if voice.isSounding(channel) {
+				voice.fadeOut()
+			}
+		}
+		s.startNote(channel, key, velocity)
+		return true
+	}
+
+	for i := int32(0); i < s.voices.activeVoiceCount; i++ {
+		voice := s.voices.voices[i]
+		if !voice.isSounding(channel) {
+			continue
+		}
+
+		// The sostenuto pedal caught the previous key, not the new one.
+		voice.sostenuto = false
+
+		// The glide starts from the current pitch, unless the portamento control specifies the key.
+		from := voice.getGlidingKey()
+		if control >= 0 {
+			from = channelInfo.getKeyPitch(control)
+		}
+		voice.key = key
+		voice.glide(from, time)
+		voice.voiceState = voice_Playing
+	}
+
+	// The key is used by the modulators for the poly pressure.
+	channelInfo.modulatorSerial++
+	channelInfo.portamentoControl = -1
+	channelInfo.lastKey = key
+	return true
+}
+
+// Whether the voice is playing a note of the channel, which the legato note is connected to.
+func (v *voice) isSounding(channel int32) bool {
+	return v.channel == channel && v.voiceState != voice_Released && v.noteGain >= nonAudible
+}
+
+// Starts the pitch glide from the pitch, which reaches the key of the voice after the time in seconds.
+func (v *voice) glide(from float32, time float32) {
+	v.glideOffset = from - v.synthesizer.channels[v.channel].getKeyPitch(v.key)
+	if time <= 0 || v.glideOffset == 0 {
+		v.glideOffset = 0
+		v.glideRate = 0
+		return
+	}
+	v.glideRate = float32(math.Abs(float64(v.glideOffset))) / (time * float32(v.synthesizer.SampleRate))
+}
+
+// Returns the pitch of the key with the tuning, which is gliding by the portamento.
+func (v *voice) getGlidingKey() float32 {
+	return v.synthesizer.channels[v.channel].getKeyPitch(v.key) + v.glideOffset
+}
+
+func (v *voice) updateGlide(blockLength int32) {
+	step := v.glideRate * float32(blockLength)
+	if v.glideOffset > 0 {
+		v.glideOffset -= step
+		if v.glideOffset < 0 {
+			v.glideOffset = 0
+		}
+	} else {
+		v.glideOffset += step
+		if v.glideOffset > 0 {
+			v.glideOffset = 0
+		}
+	}
+}
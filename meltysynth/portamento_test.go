@@ -0,0 +1,146 @@
+package meltysynth
+
+import "testing"
+
+func renderPortamentoTest(synthesizer *Synthesizer, length int) {
+	left := make([]float32, length)
+	right := make([]float32, length)
+	synthesizer.Render(left, right)
+}
+
+func TestSynthesizer_Portamento(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x05, 64)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x41, 127)
+	time := synthesizer.channels[0].getPortamentoTime()
+	if !(0.1 < time && time < 0.3) {
+		t.Fatalf("expected the portamento time around 0.2 s, but got %f", time)
+	}
+
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.NoteOff(0, 60)
+	synthesizer.NoteOn(0, 72, 100)
+	voice := findPlayingVoice(t, synthesizer, 0)
+	if voice.getGlidingKey() != 60 {
+		t.Fatalf("the glide should start from the last key, but started from %f", voice.getGlidingKey())
+	}
+
+	// The pitch rises monotonically, and reaches the key after the portamento time.
+	previous := voice.getGlidingKey()
+	for i := 0; i < 10; i++ {
+		renderPortamentoTest(synthesizer, int(float32(synthesizer.SampleRate)*time/10))
+		current := voice.getGlidingKey()
+		if current < previous {
+			t.Fatal("the pitch should rise monotonically")
+		}
+		previous = current
+	}
+	renderPortamentoTest(synthesizer, int(synthesizer.BlockSize))
+	if voice.getGlidingKey() != 72 {
+		t.Errorf("the glide should reach the key, but the pitch was %f", voice.getGlidingKey())
+	}
+
+	// The portamento control overrides the source key of the next note only.
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x41, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x54, 48)
+	synthesizer.NoteOn(0, 50, 100)
+	if synthesizer.voices.voices[synthesizer.voices.activeVoiceCount-1].getGlidingKey() != 48 {
+		t.Error("the glide should start from the key of the portamento control")
+	}
+	synthesizer.NoteOn(0, 52, 100)
+	if synthesizer.voices.voices[synthesizer.voices.activeVoiceCount-1].getGlidingKey() != 52 {
+		t.Error("the portamento control should only affect the next note")
+	}
+}
+
+func TestSynthesizer_MonoLegato(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x7E, 1)
+
+	synthesizer.NoteOn(0, 60, 100)
+	renderPortamentoTest(synthesizer, 1024)
+	voice := findPlayingVoice(t, synthesizer, 0)
+	length := voice.voiceLength
+
+	// The envelopes are not restarted by the legato note.
+	synthesizer.NoteOn(0, 64, 100)
+	if findPlayingVoice(t, synthesizer, 0) != voice || voice.key != 64 || voice.voiceLength != length {
+		t.Fatal("the voice should be moved to the new key without restarting")
+	}
+	if voice.getGlidingKey() != 64 {
+		t.Error("the pitch should change immediately without the portamento")
+	}
+
+	// Releasing the sounding key returns to the key still held.
+	synthesizer.NoteOff(0, 64)
+	if findPlayingVoice(t, synthesizer, 0) != voice || voice.key != 60 {
+		t.Fatal("the voice should return to the key still held")
+	}
+
+	synthesizer.NoteOff(0, 60)
+	if voice.voiceState == voice_Playing {
+		t.Error("the voice should be released when all the keys are released")
+	}
+
+	// The poly mode plays each note with its own voice.
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x7F, 0)
+	renderPortamentoTest(synthesizer, 44100)
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.NoteOn(0, 64, 100)
+	if synthesizer.voices.activeVoiceCount != 2 {
+		t.Errorf("expected 2 voices in the poly mode, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+}
+
+func TestSynthesizer_MonoLegato_RegionChange(t *testing.T) {
+	// The keys up to 63 and from 64 are played with the different samples.
+	builder := NewSoundFontBuilder("split")
+	instrument := builder.AddInstrument("split")
+	for i, name := range []string{"low", "high"} {
+		sample := builder.AddSampleFloat32(name, createSineWave(1000, 100), 44100, 60)
+		region := instrument.AddRegion(sample)
+		region.SetGenerator(GeneratorSampleModes, int16(loop_Continuous))
+		region.SetGenerator(GeneratorKeyRange, int16(64*i|(64*i+63)<<8))
+	}
+	builder.AddPreset("split", 0, 0).AddRegion(instrument)
+	soundFont, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := soundFont.Instruments[0].Regions
+	settings := NewSynthesizerSettings(44100)
+	settings.EnableReverbAndChorus = false
+	synthesizer, err := NewSynthesizer(soundFont, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.ProcessMidiMessage(0, 0xB0, 0x7E, 1)
+
+	synthesizer.NoteOn(0, 60, 100)
+	renderPortamentoTest(synthesizer, 1024)
+	low := findPlayingVoice(t, synthesizer, 0)
+
+	// The key in the same region glides.
+	synthesizer.NoteOn(0, 62, 100)
+	if findPlayingVoice(t, synthesizer, 0) != low {
+		t.Fatal("the voice should be moved to the key in the same region")
+	}
+
+	// The key in the other region starts a new voice, while the previous one is faded out.
+	synthesizer.NoteOn(0, 66, 80)
+	high := findPlayingVoice(t, synthesizer, 0)
+	if high == low || high.instrumentRegion != regions[1] || high.velocity != 80 {
+		t.Fatal("the note should be started with the region of the key")
+	}
+	if low.voiceState != voice_Released {
+		t.Error("the previous voice should be released")
+	}
+
+	// Returning to the key still held also starts a new voice, with the velocity of the sounding note.
+	synthesizer.NoteOff(0, 66)
+	voice := findPlayingVoice(t, synthesizer, 0)
+	if voice == high || voice.key != 62 || voice.instrumentRegion != regions[0] || voice.velocity != 80 {
+		t.Error("the key still held should be started with its region")
+	}
+}
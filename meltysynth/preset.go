@@ -15,7 +15,7 @@ type Preset struct {
 	Regions     []*PresetRegion
 }
 
-func createPreset(info *presetInfo, zones []*zone, instruments []*Instrument) (*Preset, error) {
+func createPreset(p *soundFontParser, info *presetInfo, zones []*zone, instruments []*Instrument) (*Preset, error) {
 	var err error
 
 	result := new(Preset)
@@ -28,13 +28,18 @@ func createPreset(info *presetInfo, zones []*zone, instruments []*Instrument) (*
 	result.Morphology = info.morphology
 
 	zoneCount := info.zoneEndIndex - info.zoneStartIndex + 1
-	if zoneCount <= 0 {
-		return nil, fmt.Errorf("the preset %q has no zone", info.name)
+	if zoneCount <= 0 || info.zoneStartIndex < 0 || int(info.zoneStartIndex+zoneCount) > len(zones) {
+		if !p.lenient {
+			return nil, fmt.Errorf("the preset %q has no zone", info.name)
+		}
+		p.warn("phdr", "the preset %q has no valid zone", info.name)
+		result.Regions = make([]*PresetRegion, 0)
+		return result, nil
 	}
 
 	zoneSpan := zones[info.zoneStartIndex : info.zoneStartIndex+zoneCount]
 
-	result.Regions, err = createPresetRegions(result, zoneSpan, instruments)
+	result.Regions, err = createPresetRegions(p, result, zoneSpan, instruments)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +47,7 @@ func createPreset(info *presetInfo, zones []*zone, instruments []*Instrument) (*
 	return result, nil
 }
 
-func createPresets(infos []*presetInfo, zones []*zone, instruments []*Instrument) ([]*Preset, error) {
+func createPresets(p *soundFontParser, infos []*presetInfo, zones []*zone, instruments []*Instrument) ([]*Preset, error) {
 
 	var err error
 
@@ -56,7 +61,7 @@ func createPresets(infos []*presetInfo, zones []*zone, instruments []*Instrument
 	presets := make([]*Preset, count)
 
 	for i := 0; i < count; i++ {
-		presets[i], err = createPreset(infos[i], zones, instruments)
+		presets[i], err = createPreset(p, infos[i], zones, instruments)
 		if err != nil {
 			return nil, err
 		}
@@ -6,14 +6,14 @@ import (
 
 type PresetRegion struct {
 	Instrument *Instrument
+	Modulators []Modulator
 	gs         [61]int16
 }
 
-func createPresetRegion(preset *Preset, global *zone, local *zone, instruments []*Instrument) (*PresetRegion, error) {
+func createPresetRegion(p *soundFontParser, preset *Preset, global *zone, local *zone, instruments []*Instrument) (*PresetRegion, error) {
 	result := new(PresetRegion)
 
-	result.gs[gen_KeyRange] = 0x7F00
-	result.gs[gen_VelocityRange] = 0x7F00
+	setDefaultPresetGenerators(&result.gs)
 
 	for i := 0; i < len(global.generators); i++ {
 		result.setParameter(global.generators[i])
@@ -23,16 +23,36 @@ func createPresetRegion(preset *Preset, global *zone, local *zone, instruments [
 		result.setParameter(local.generators[i])
 	}
 
+	// The local modulators supersede the identical global ones.
+	result.Modulators = mergeModulators(global.modulators, local.modulators)
+
 	id := result.gs[gen_Instrument]
 	if !(0 <= id && int(id) < len(instruments)) {
-		return nil, fmt.Errorf("the preset %q contains an invalid instrument id %d", preset.Name, id)
+		if !p.lenient {
+			return nil, p.newError("pgen", fmt.Errorf("the preset %q contains an invalid instrument id %d", preset.Name, id))
+		}
+		// The region is removed in the lenient mode.
+		p.warn("pgen", "the region of the preset %q was removed since it contains an invalid instrument id %d", preset.Name, id)
+		return nil, nil
 	}
 	result.Instrument = instruments[id]
 
 	return result, nil
 }
 
-func createPresetRegions(preset *Preset, zones []*zone, instruments []*Instrument) ([]*PresetRegion, error) {
+func NewPresetRegion(instrument *Instrument) *PresetRegion {
+	result := new(PresetRegion)
+	result.Instrument = instrument
+	setDefaultPresetGenerators(&result.gs)
+	return result
+}
+
+func setDefaultPresetGenerators(gs *[61]int16) {
+	gs[gen_KeyRange] = 0x7F00
+	gs[gen_VelocityRange] = 0x7F00
+}
+
+func createPresetRegions(p *soundFontParser, preset *Preset, zones []*zone, instruments []*Instrument) ([]*PresetRegion, error) {
 
 	var global *zone = nil
 	var err error
@@ -45,12 +65,16 @@ func createPresetRegions(preset *Preset, zones []*zone, instruments []*Instrumen
 
 		// The global zone is regarded as the base setting of subsequent zones.
 		count := len(zones) - 1
-		regions := make([]*PresetRegion, count)
+		regions := make([]*PresetRegion, 0, count)
 		for i := 0; i < count; i++ {
-			regions[i], err = createPresetRegion(preset, global, zones[i+1], instruments)
+			var region *PresetRegion
+			region, err = createPresetRegion(p, preset, global, zones[i+1], instruments)
 			if err != nil {
 				return nil, err
 			}
+			if region != nil {
+				regions = append(regions, region)
+			}
 		}
 		return regions, nil
 
@@ -58,12 +82,16 @@ func createPresetRegions(preset *Preset, zones []*zone, instruments []*Instrumen
 
 		// No global zone.
 		count := len(zones)
-		regions := make([]*PresetRegion, count)
+		regions := make([]*PresetRegion, 0, count)
 		for i := 0; i < count; i++ {
-			regions[i], err = createPresetRegion(preset, createEmptyZone(), zones[i], instruments)
+			var region *PresetRegion
+			region, err = createPresetRegion(p, preset, createEmptyZone(), zones[i], instruments)
 			if err != nil {
 				return nil, err
 			}
+			if region != nil {
+				regions = append(regions, region)
+			}
 		}
 		return regions, nil
 	}
@@ -79,6 +107,29 @@ func (region *PresetRegion) setParameter(param generator) {
 	}
 }
 
+func (region *PresetRegion) GetGenerator(generatorType GeneratorType) int16 {
+	if int(generatorType) < len(region.gs) {
+		return region.gs[generatorType]
+	} else {
+		return 0
+	}
+}
+
+// Unknown generators are ignored.
+func (region *PresetRegion) SetGenerator(generatorType GeneratorType, value int16) {
+	if int(generatorType) < len(region.gs) {
+		region.gs[generatorType] = value
+	}
+}
+
+func (region *PresetRegion) SetKeyRange(start int32, end int32) {
+	region.gs[gen_KeyRange] = int16(end<<8 | start)
+}
+
+func (region *PresetRegion) SetVelocityRange(start int32, end int32) {
+	region.gs[gen_VelocityRange] = int16(end<<8 | start)
+}
+
 func (region *PresetRegion) contains(key int32, velocity int32) bool {
 	containsKey := region.GetKeyRangeStart() <= key && key <= region.GetKeyRangeEnd()
 	containsVelocity := region.GetVelocityRangeStart() <= velocity && velocity <= region.GetVelocityRangeEnd()
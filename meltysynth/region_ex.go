@@ -2,19 +2,36 @@ package meltysynth
 
 import "math"
 
-func (o *oscillator) startByRegion(data []int16, region regionPair) {
+func (o *oscillator) startByRegion(window waveWindow, region regionPair) {
 	sampleRate := region.instrument.Sample.SampleRate
 	loopMode := region.GetSampleModes()
-	sampleStart := region.GetSampleStart()
-	sampleEnd := region.GetSampleEnd()
-	startLoop := region.GetSampleStartLoop()
-	endLoop := region.GetSampleEndLoop()
+	sampleStart := region.GetSampleStart() - window.offset
+	sampleEnd := region.GetSampleEnd() - window.offset
+	startLoop := region.GetSampleStartLoop() - window.offset
+	endLoop := region.GetSampleEndLoop() - window.offset
 	rootKey := region.GetRootKey()
 	coarseTune := region.GetCoarseTune()
 	fineTune := region.GetFineTune()
 	scaleTuning := region.GetScaleTuning()
 
-	o.start(data, loopMode, sampleRate, sampleStart, sampleEnd, startLoop, endLoop, rootKey, coarseTune, fineTune, scaleTuning)
+	// The address offsets changed by the modulators may point outside the sample data.
+	last := int32(len(window.data)) - 1
+	sampleStart = clampSamplePosition(sampleStart, last)
+	sampleEnd = clampSamplePosition(sampleEnd, last)
+	startLoop = clampSamplePosition(startLoop, last)
+	endLoop = clampSamplePosition(endLoop, last)
+
+	o.start(window.data, window.data24, loopMode, sampleRate, sampleStart, sampleEnd, startLoop, endLoop, rootKey, coarseTune, fineTune, scaleTuning)
+}
+
+func clampSamplePosition(position int32, last int32) int32 {
+	if position < 0 {
+		return 0
+	}
+	if position > last {
+		return last
+	}
+	return position
 }
 
 func (env *volumeEnvelope) startByRegion(region regionPair, key int32, velocity int32) {
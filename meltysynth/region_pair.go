@@ -1,8 +1,13 @@
 package meltysynth
 
+import "math"
+
 type regionPair struct {
 	preset     *PresetRegion
 	instrument *InstrumentRegion
+
+	// The values of the modulators evaluated at the note-on.
+	modulation *[61]float32
 }
 
 func newRegionPair(preset *PresetRegion, inst *InstrumentRegion) regionPair {
@@ -15,39 +20,51 @@ func newRegionPair(preset *PresetRegion, inst *InstrumentRegion) regionPair {
 }
 
 func (region regionPair) getGeneratorValue(generatorType uint16) int32 {
-	return int32(region.preset.gs[generatorType]) + int32(region.instrument.gs[generatorType])
+	value := int32(region.preset.gs[generatorType]) + int32(region.instrument.gs[generatorType])
+	if region.modulation != nil {
+		value += int32(math.Round(float64(region.modulation[generatorType])))
+	}
+	return value
 }
 
 func (region regionPair) GetSampleStart() int32 {
-	return region.instrument.GetSampleStart()
+	return region.instrument.Sample.Start + region.GetStartAddressOffset()
 }
 
 func (region regionPair) GetSampleEnd() int32 {
-	return region.instrument.GetSampleEnd()
+	return region.instrument.Sample.End + region.GetEndAddressOffset()
 }
 
 func (region regionPair) GetSampleStartLoop() int32 {
-	return region.instrument.GetSampleStartLoop()
+	return region.instrument.Sample.StartLoop + region.GetStartLoopAddressOffset()
 }
 
 func (region regionPair) GetSampleEndLoop() int32 {
-	return region.instrument.GetSampleEndLoop()
+	return region.instrument.Sample.EndLoop + region.GetEndLoopAddressOffset()
 }
 
+// The address offsets are not allowed in the preset regions, but can be changed by the modulators.
 func (region regionPair) GetStartAddressOffset() int32 {
-	return region.instrument.GetStartAddressOffset()
+	return region.instrument.GetStartAddressOffset() + region.getAddressModulation(gen_StartAddressOffset, gen_StartAddressCoarseOffset)
 }
 
 func (region regionPair) GetEndAddressOffset() int32 {
-	return region.instrument.GetEndAddressOffset()
+	return region.instrument.GetEndAddressOffset() + region.getAddressModulation(gen_EndAddressOffset, gen_EndAddressCoarseOffset)
 }
 
 func (region regionPair) GetStartLoopAddressOffset() int32 {
-	return region.instrument.GetStartLoopAddressOffset()
+	return region.instrument.GetStartLoopAddressOffset() + region.getAddressModulation(gen_StartLoopAddressOffset, gen_StartLoopAddressCoarseOffset)
 }
 
 func (region regionPair) GetEndLoopAddressOffset() int32 {
-	return region.instrument.GetEndLoopAddressOffset()
+	return region.instrument.GetEndLoopAddressOffset() + region.getAddressModulation(gen_EndLoopAddressOffset, gen_EndLoopAddressCoarseOffset)
+}
+
+func (region regionPair) getAddressModulation(fine uint16, coarse uint16) int32 {
+	if region.modulation == nil {
+		return 0
+	}
+	return 32768*int32(math.Round(float64(region.modulation[coarse]))) + int32(math.Round(float64(region.modulation[fine])))
 }
 
 func (region regionPair) GetModulationLfoToPitch() int32 {
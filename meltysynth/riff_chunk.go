@@ -0,0 +1,86 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The RIFF chunk in memory, which is used to read the formats other than SoundFont.
+type riffChunk struct {
+	id       string
+	listType string // The type of the RIFF or LIST chunk, or empty for the other chunks.
+	data     []byte // The contents of the chunk, without the list type.
+	offset   int    // The position of the chunk header in the parent data.
+}
+
+// Splits the data into the chunks. The pad bytes for the odd-sized chunks are skipped.
+func readRiffChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+
+	pos := 0
+	for pos+8 <= len(data) {
+		offset := pos
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+
+		if size < 0 || size > len(data)-pos {
+			return nil, fmt.Errorf("the size of the %q chunk is out of range", id)
+		}
+
+		chunk := riffChunk{id: id, data: data[pos : pos+size], offset: offset}
+		if id == "RIFF" || id == "LIST" {
+			if size < 4 {
+				return nil, fmt.Errorf("the %q chunk has no type", id)
+			}
+			chunk.listType = string(chunk.data[0:4])
+			chunk.data = chunk.data[4:]
+		}
+		chunks = append(chunks, chunk)
+
+		pos += size + size%2
+	}
+
+	return chunks, nil
+}
+
+func findRiffChunk(chunks []riffChunk, id string) *riffChunk {
+	for i := 0; i < len(chunks); i++ {
+		if chunks[i].id == id {
+			return &chunks[i]
+		}
+	}
+	return nil
+}
+
+func findRiffList(chunks []riffChunk, listType string) *riffChunk {
+	for i := 0; i < len(chunks); i++ {
+		if chunks[i].id == "LIST" && chunks[i].listType == listType {
+			return &chunks[i]
+		}
+	}
+	return nil
+}
+
+// Reads the string of the chunk in the INFO list, or returns an empty string if not found.
+func readRiffInfoString(info *riffChunk, id string) string {
+	if info == nil {
+		return ""
+	}
+	chunks, err := readRiffChunks(info.data)
+	if err != nil {
+		return ""
+	}
+	chunk := findRiffChunk(chunks, id)
+	if chunk == nil {
+		return ""
+	}
+	value := chunk.data
+	for i := 0; i < len(value); i++ {
+		if value[i] == 0 {
+			value = value[0:i]
+			break
+		}
+	}
+	return string(value)
+}
@@ -0,0 +1,9 @@
+package meltysynth
+
+const (
+	sampleType_Mono   uint16 = 1
+	sampleType_Right  uint16 = 2
+	sampleType_Left   uint16 = 4
+	sampleType_Linked uint16 = 8
+	sampleType_Rom    uint16 = 0x8000
+)
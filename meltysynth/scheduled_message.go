@@ -0,0 +1,67 @@
+package meltysynth
+
+type scheduledMessage struct {
+	offset  int32
+	channel int32
+	command int32
+	data1   int32
+	data2   int32
+	sysEx   []byte // Processed as a SysEx message if not nil.
+}
+
+// Schedules the MIDI message to be processed at the given sample offset from the beginning of the next Render call.
+// The block being rendered is split at the offset, so that the message takes effect at the exact sample.
+// If the previous Render call ended in the middle of a block, the messages within the rest of the block
+// are delayed until its end. Rendering in multiples of the block size avoids this.
+func (s *Synthesizer) ProcessMidiMessageAt(offset int32, channel int32, command int32, data1 int32, data2 int32) {
+	s.schedule(scheduledMessage{
+		offset:  offset,
+		channel: channel,
+		command: command,
+		data1:   data1,
+		data2:   data2,
+	})
+}
+
+// Schedules the SysEx message in the same way as ProcessMidiMessageAt.
+// The data is not copied, so it must not be modified until the message is processed.
+func (s *Synthesizer) ProcessSysExAt(offset int32, data []byte) {
+	if data == nil {
+		data = []byte{}
+	}
+	s.schedule(scheduledMessage{offset: offset, sysEx: data})
+}
+
+func (s *Synthesizer) schedule(msg scheduledMessage) {
+	if msg.offset < 0 {
+		msg.offset = 0
+	}
+
+	// The messages with the same offset are processed in the order of arrival.
+	index := len(s.scheduledMessages)
+	for index > 0 && s.scheduledMessages[index-1].offset > msg.offset {
+		index--
+	}
+
+	s.scheduledMessages = append(s.scheduledMessages, scheduledMessage{})
+	copy(s.scheduledMessages[index+1:], s.scheduledMessages[index:])
+	s.scheduledMessages[index] = msg
+}
+
+// Processes the scheduled messages which have been reached at the position in the current Render call.
+func (s *Synthesizer) processScheduledMessages(position int32) {
+	count := 0
+	for count < len(s.scheduledMessages) && s.scheduledMessages[count].offset <= position {
+		msg := s.scheduledMessages[count]
+		if msg.sysEx != nil {
+			s.ProcessSysEx(msg.sysEx)
+		} else {
+			s.ProcessMidiMessage(msg.channel, msg.command, msg.data1, msg.data2)
+		}
+		count++
+	}
+
+	if count > 0 {
+		s.scheduledMessages = s.scheduledMessages[:copy(s.scheduledMessages, s.scheduledMessages[count:])]
+	}
+}
@@ -0,0 +1,84 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+// Checks that the output is the same as the reference delayed by the offset,
+// after the envelope reaches the sustain level.
+func checkDelayedOutput(t *testing.T, output []float32, reference []float32, offset int) {
+	for i := 256; i < len(reference)-offset; i++ {
+		if math.Abs(float64(output[i+offset]-reference[i])) > 1.0e-6 {
+			t.Fatalf("the output should be delayed by %d samples", offset)
+		}
+	}
+}
+
+func renderScheduleTestReference(t *testing.T, length int) []float32 {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+	synthesizer.NoteOn(0, 60, 100)
+	left := make([]float32, length)
+	right := make([]float32, length)
+	synthesizer.Render(left, right)
+	return left
+}
+
+func TestSynthesizer_ProcessMidiMessageAt(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	// The onset is not aligned to the block size.
+	synthesizer.ProcessMidiMessageAt(100, 0, 0x90, 60, 100)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+	synthesizer.Render(left, right)
+	for i := 0; i < 100; i++ {
+		if left[i] != 0 {
+			t.Fatal("the note should not be started before the offset")
+		}
+	}
+	checkDelayedOutput(t, left, renderScheduleTestReference(t, 1024), 100)
+	if (synthesizer.blockPosition+synthesizer.blockLength)%synthesizer.BlockSize != 0 {
+		t.Error("the blocks should be aligned to the block size again")
+	}
+}
+
+func TestSynthesizer_ProcessMidiMessageAt_CarriedOver(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	// The message beyond the first call takes effect in the second one.
+	synthesizer.ProcessMidiMessageAt(300, 0, 0x90, 60, 100)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+	synthesizer.Render(left[0:200], right[0:200])
+	if synthesizer.voices.activeVoiceCount != 0 {
+		t.Fatal("the note should not be started yet")
+	}
+	synthesizer.Render(left[200:], right[200:])
+	checkDelayedOutput(t, left, renderScheduleTestReference(t, 1024), 300)
+
+	// The note-off is processed after the note-on with the same offset.
+	synthesizer.ProcessMidiMessageAt(10, 1, 0x90, 60, 100)
+	synthesizer.ProcessMidiMessageAt(10, 1, 0x80, 60, 0)
+	synthesizer.ProcessMidiMessageAt(5, 2, 0x90, 60, 100)
+	if synthesizer.scheduledMessages[0].channel != 2 || synthesizer.scheduledMessages[2].command != 0x80 {
+		t.Error("the messages should be sorted by the offset in the order of arrival")
+	}
+}
+
+func TestSynthesizer_ProcessMidiMessageAt_OneSampleBlock(t *testing.T) {
+	// At the low sample rate, the default cutoff exceeds the Nyquist frequency and the filter is inactive.
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.SampleRate = 16000
+	}, 0)
+
+	// The block between the messages is only one sample long.
+	synthesizer.ProcessMidiMessageAt(0, 0, 0x90, 60, 100)
+	synthesizer.ProcessMidiMessageAt(1, 0, 0xB0, 0x07, 80)
+	left := make([]float32, 256)
+	right := make([]float32, 256)
+	synthesizer.Render(left, right)
+	if synthesizer.voices.activeVoiceCount != 1 {
+		t.Error("the note should be playing")
+	}
+}
@@ -0,0 +1,495 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The opcodes of a region, where the ones of the enclosing headers are inherited.
+type sfzRegion map[string]string
+
+var sfzTokenPattern = regexp.MustCompile(`<(\w+)>|([A-Za-z0-9_]+)=`)
+
+// Reads the SFZ instrument and the WAV samples from fsys, and builds a SoundFont
+// which contains the instrument as the preset of the patch 0 in the bank 0.
+func NewSoundFontFromSFZ(fsys fs.FS, name string) (*SoundFont, error) {
+	builder := NewSoundFontBuilder(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+	_, err := builder.ImportSFZ(fsys, name, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return builder.Build()
+}
+
+// Reads the SFZ instrument and the WAV samples from fsys, and adds them as a preset.
+// The sample paths are resolved relative to the SFZ file.
+// The opcodes which cannot be represented by SoundFont, such as the release triggers
+// and the round robins, are ignored.
+func (builder *SoundFontBuilder) ImportSFZ(fsys fs.FS, name string, patchNumber int32, bankNumber int32) (*Preset, error) {
+	lines, err := readSfzLines(fsys, name, make(map[string]string), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, defaultPath := parseSfzRegions(lines)
+
+	instrumentName := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	instrument := builder.AddInstrument(instrumentName)
+
+	samples := make(map[string]*SampleHeader)
+	for _, opcodes := range regions {
+		if opcodes["trigger"] != "" && opcodes["trigger"] != "attack" {
+			continue
+		}
+
+		samplePath := opcodes["sample"]
+		if samplePath == "" {
+			continue
+		}
+		samplePath = path.Join(path.Dir(name), strings.ReplaceAll(defaultPath, `\`, "/"), strings.ReplaceAll(samplePath, `\`, "/"))
+
+		sample, found := samples[samplePath]
+		if !found {
+			sample, err = builder.addWaveFile(fsys, samplePath)
+			if err != nil {
+				return nil, err
+			}
+			samples[samplePath] = sample
+		}
+
+		region := instrument.AddRegion(sample)
+		err = applySfzOpcodes(region, opcodes)
+		if err != nil {
+			return nil, fmt.Errorf("the sfz file %q contains an invalid region: %v", name, err)
+		}
+	}
+
+	preset := builder.AddPreset(instrumentName, patchNumber, bankNumber)
+	preset.AddRegion(instrument)
+
+	return preset, nil
+}
+
+// Reads the lines without the comments, where the #define and #include directives are processed.
+func readSfzLines(fsys fs.FS, name string, defines map[string]string, depth int) ([]string, error) {
+	if depth > 16 {
+		return nil, errors.New("the sfz files are included recursively")
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(data)
+	for {
+		start := strings.Index(text, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+2:], "*/")
+		if end < 0 {
+			text = text[:start]
+			break
+		}
+		text = text[:start] + " " + text[start+2+end+2:]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		index := strings.Index(line, "//")
+		if index >= 0 {
+			line = line[:index]
+		}
+		line = strings.TrimSpace(line)
+
+		for key, value := range defines {
+			line = strings.ReplaceAll(line, key, value)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#define"):
+			fields := strings.Fields(line[len("#define"):])
+			if len(fields) >= 2 {
+				defines[fields[0]] = strings.Join(fields[1:], " ")
+			}
+		case strings.HasPrefix(line, "#include"):
+			included := strings.Trim(strings.TrimSpace(line[len("#include"):]), `"`)
+			included = path.Join(path.Dir(name), strings.ReplaceAll(included, `\`, "/"))
+			includedLines, err := readSfzLines(fsys, included, defines, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, includedLines...)
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// Collects the regions, each of which has the opcodes of the global, master, group and region headers.
+func parseSfzRegions(lines []string) ([]sfzRegion, string) {
+	var regions []sfzRegion
+	var defaultPath string
+
+	// The opcodes of each header level.
+	levels := map[string]sfzRegion{"global": {}, "master": {}, "group": {}}
+	current := sfzRegion{}
+	header := ""
+
+	flush := func() {
+		if header == "region" {
+			region := sfzRegion{}
+			for _, level := range []string{"global", "master", "group"} {
+				for key, value := range levels[level] {
+					region[key] = value
+				}
+			}
+			for key, value := range current {
+				region[key] = value
+			}
+			regions = append(regions, region)
+		}
+	}
+
+	for _, line := range lines {
+		matches := sfzTokenPattern.FindAllStringSubmatchIndex(line, -1)
+		for i, match := range matches {
+			if match[2] >= 0 {
+				flush()
+				header = line[match[2]:match[3]]
+				current = sfzRegion{}
+				switch header {
+				case "global":
+					levels["master"] = sfzRegion{}
+					levels["group"] = sfzRegion{}
+				case "master":
+					levels["group"] = sfzRegion{}
+				}
+				if _, found := levels[header]; found {
+					levels[header] = current
+				}
+				continue
+			}
+
+			// The value continues until the next opcode or header, since the sample path may contain spaces.
+			end := len(line)
+			if i+1 < len(matches) {
+				end = matches[i+1][0]
+			}
+			key := line[match[4]:match[5]]
+			value := strings.TrimSpace(line[match[1]:end])
+			if header == "control" && key == "default_path" {
+				defaultPath = value
+			} else {
+				current[key] = value
+			}
+		}
+	}
+	flush()
+
+	return regions, defaultPath
+}
+
+func (builder *SoundFontBuilder) addWaveFile(fsys fs.FS, name string) (*SampleHeader, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].id != "RIFF" || chunks[0].listType != "WAVE" {
+		return nil, fmt.Errorf("the file %q is not a wav file", name)
+	}
+	chunks, err = readRiffChunks(chunks[0].data)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, sampleRate, err := readWaveSamples(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the wav file %q: %v", name, err)
+	}
+
+	sample := builder.AddSample(strings.TrimSuffix(path.Base(name), path.Ext(name)), samples, sampleRate, 60)
+
+	// The loop in the smpl chunk is used as the default one.
+	smpl := findRiffChunk(chunks, "smpl")
+	if smpl != nil && len(smpl.data) >= 36+24 && binary.LittleEndian.Uint32(smpl.data[28:]) > 0 {
+		loop := smpl.data[36:]
+		start := int32(binary.LittleEndian.Uint32(loop[8:]))
+		end := int32(binary.LittleEndian.Uint32(loop[12:]))
+		builder.SetSampleLoop(sample, start, end+1)
+	}
+
+	return sample, nil
+}
+
+func applySfzOpcodes(region *InstrumentRegion, opcodes sfzRegion) error {
+	sample := region.Sample
+
+	lokey, hikey := int32(0), int32(127)
+	lovel, hivel := int32(0), int32(127)
+	rootKey := int32(60)
+	startLoop := sample.StartLoop - sample.Start
+	endLoop := sample.EndLoop - sample.Start
+	var ampSustain, filSustain float64 = 100, 100
+	var tune, transpose float64
+	var filDepth, pitchDepth float64
+	var group, offBy int64
+
+	// The sample is looped by default if the WAV file has a loop.
+	if sample.StartLoop != sample.Start || sample.EndLoop != sample.End {
+		region.gs[gen_SampleModes] = int16(loop_Continuous)
+	}
+
+	// The key opcode is processed first, since it is overridden by the lokey, hikey and pitch_keycenter opcodes.
+	if value, found := opcodes["key"]; found {
+		key, err := parseSfzKey(value)
+		if err != nil {
+			return fmt.Errorf("the opcode key=%s is invalid: %v", value, err)
+		}
+		lokey, hikey, rootKey = key, key, key
+	}
+
+	for key, value := range opcodes {
+		var err error
+		switch key {
+		case "lokey":
+			lokey, err = parseSfzKey(value)
+		case "hikey":
+			hikey, err = parseSfzKey(value)
+		case "lovel":
+			lovel, err = parseSfzInt(value)
+		case "hivel":
+			hivel, err = parseSfzInt(value)
+		case "pitch_keycenter":
+			rootKey, err = parseSfzKey(value)
+		case "tune":
+			tune, err = strconv.ParseFloat(value, 64)
+		case "transpose":
+			transpose, err = strconv.ParseFloat(value, 64)
+		case "pitch_keytrack":
+			err = setSfzGenerator(region, gen_ScaleTuning, value, 1)
+		case "volume":
+			// The initial attenuation is scaled by 0.4 in the synthesizer, to emulate the other SoundFont players.
+			err = setSfzGenerator(region, gen_InitialAttenuation, value, -10/0.4)
+		case "pan":
+			err = setSfzGenerator(region, gen_Pan, value, 5)
+		case "loop_mode", "loopmode":
+			switch value {
+			case "no_loop", "one_shot":
+				region.gs[gen_SampleModes] = int16(loop_NoLoop)
+			case "loop_continuous":
+				region.gs[gen_SampleModes] = int16(loop_Continuous)
+			case "loop_sustain":
+				region.gs[gen_SampleModes] = int16(loop_LoopUntilNoteOff)
+			default:
+				err = fmt.Errorf("unknown loop mode %q", value)
+			}
+		case "loop_start", "loopstart":
+			startLoop, err = parseSfzInt(value)
+		case "loop_end", "loopend":
+			endLoop, err = parseSfzInt(value)
+			endLoop++
+		case "offset":
+			var offset int32
+			offset, err = parseSfzInt(value)
+			setAddressOffset(region, gen_StartAddressOffset, gen_StartAddressCoarseOffset, offset)
+		case "end":
+			var end int32
+			end, err = parseSfzInt(value)
+			if end > 0 {
+				setAddressOffset(region, gen_EndAddressOffset, gen_EndAddressCoarseOffset, sample.Start+end+1-sample.End)
+			}
+		case "group":
+			group, err = strconv.ParseInt(value, 10, 64)
+		case "off_by":
+			offBy, err = strconv.ParseInt(value, 10, 64)
+		case "ampeg_delay":
+			err = setSfzTimeGenerator(region, gen_DelayVolumeEnvelope, value)
+		case "ampeg_attack":
+			err = setSfzTimeGenerator(region, gen_AttackVolumeEnvelope, value)
+		case "ampeg_hold":
+			err = setSfzTimeGenerator(region, gen_HoldVolumeEnvelope, value)
+		case "ampeg_decay":
+			err = setSfzTimeGenerator(region, gen_DecayVolumeEnvelope, value)
+		case "ampeg_sustain":
+			ampSustain, err = strconv.ParseFloat(value, 64)
+		case "ampeg_release":
+			err = setSfzTimeGenerator(region, gen_ReleaseVolumeEnvelope, value)
+		case "fileg_delay", "pitcheg_delay":
+			err = setSfzTimeGenerator(region, gen_DelayModulationEnvelope, value)
+		case "fileg_attack", "pitcheg_attack":
+			err = setSfzTimeGenerator(region, gen_AttackModulationEnvelope, value)
+		case "fileg_hold", "pitcheg_hold":
+			err = setSfzTimeGenerator(region, gen_HoldModulationEnvelope, value)
+		case "fileg_decay", "pitcheg_decay":
+			err = setSfzTimeGenerator(region, gen_DecayModulationEnvelope, value)
+		case "fileg_sustain", "pitcheg_sustain":
+			filSustain, err = strconv.ParseFloat(value, 64)
+		case "fileg_release", "pitcheg_release":
+			err = setSfzTimeGenerator(region, gen_ReleaseModulationEnvelope, value)
+		case "fileg_depth":
+			filDepth, err = strconv.ParseFloat(value, 64)
+		case "pitcheg_depth":
+			pitchDepth, err = strconv.ParseFloat(value, 64)
+		case "cutoff":
+			var hertz float64
+			hertz, err = strconv.ParseFloat(value, 64)
+			if err == nil && hertz > 0 {
+				setClampedGenerator(region, gen_InitialFilterCutoffFrequency, 1200*math.Log2(hertz/8.176))
+			}
+		case "resonance":
+			err = setSfzGenerator(region, gen_InitialFilterQ, value, 10)
+		case "amplfo_freq", "fillfo_freq":
+			err = setSfzFrequencyGenerator(region, gen_FrequencyModulationLfo, value)
+		case "amplfo_delay", "fillfo_delay":
+			err = setSfzTimeGenerator(region, gen_DelayModulationLfo, value)
+		case "amplfo_depth":
+			err = setSfzGenerator(region, gen_ModulationLfoToVolume, value, 10)
+		case "fillfo_depth":
+			err = setSfzGenerator(region, gen_ModulationLfoToFilterCutoffFrequency, value, 1)
+		case "pitchlfo_freq":
+			err = setSfzFrequencyGenerator(region, gen_FrequencyVibratoLfo, value)
+		case "pitchlfo_delay":
+			err = setSfzTimeGenerator(region, gen_DelayVibratoLfo, value)
+		case "pitchlfo_depth":
+			err = setSfzGenerator(region, gen_VibratoLfoToPitch, value, 1)
+		}
+		if err != nil {
+			return fmt.Errorf("the opcode %s=%s is invalid: %v", key, value, err)
+		}
+	}
+
+	region.SetKeyRange(lokey, hikey)
+	region.SetVelocityRange(lovel, hivel)
+	region.gs[gen_OverridingRootKey] = int16(rootKey)
+
+	cents := int32(math.Round(100*transpose + tune))
+	region.gs[gen_CoarseTune] = int16(cents / 100)
+	region.gs[gen_FineTune] = int16(cents % 100)
+
+	if ampSustain > 0 {
+		setClampedGenerator(region, gen_SustainVolumeEnvelope, -200*math.Log10(ampSustain/100))
+	} else {
+		region.gs[gen_SustainVolumeEnvelope] = 1440
+	}
+	setClampedGenerator(region, gen_SustainModulationEnvelope, 1000-10*filSustain)
+
+	// SoundFont has only one modulation envelope, which is shared by the filter and the pitch.
+	setClampedGenerator(region, gen_ModulationEnvelopeToFilterCutoffFrequency, filDepth)
+	setClampedGenerator(region, gen_ModulationEnvelopeToPitch, pitchDepth)
+
+	// Only the voices which cut themselves, such as the hi-hats, can be represented by the exclusive class.
+	if group != 0 && group == offBy {
+		region.gs[gen_ExclusiveClass] = int16(group)
+	}
+
+	sampleLength := sample.End - sample.Start
+	if 0 <= startLoop && startLoop < endLoop && endLoop <= sampleLength {
+		setAddressOffset(region, gen_StartLoopAddressOffset, gen_StartLoopAddressCoarseOffset, sample.Start+startLoop-sample.StartLoop)
+		setAddressOffset(region, gen_EndLoopAddressOffset, gen_EndLoopAddressCoarseOffset, sample.Start+endLoop-sample.EndLoop)
+	}
+
+	if lokey > hikey || hikey > 127 || lovel > hivel || hivel > 127 {
+		return errors.New("the key or velocity range is invalid")
+	}
+
+	return nil
+}
+
+func parseSfzInt(value string) (int32, error) {
+	result, err := strconv.ParseInt(value, 10, 32)
+	return int32(result), err
+}
+
+// Parses the key number or the note name such as "c4" and "f#3", where "c4" is 60.
+func parseSfzKey(value string) (int32, error) {
+	key, err := strconv.ParseInt(value, 10, 32)
+	if err == nil {
+		return int32(key), nil
+	}
+
+	value = strings.ToLower(value)
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid key %q", value)
+	}
+	index := strings.IndexByte("c d ef g a b", value[0])
+	if index < 0 {
+		return 0, fmt.Errorf("invalid key %q", value)
+	}
+	rest := value[1:]
+	switch rest[0] {
+	case '#':
+		index++
+		rest = rest[1:]
+	case 'b':
+		index--
+		rest = rest[1:]
+	}
+	octave, err := strconv.ParseInt(rest, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid key %q", value)
+	}
+	return int32(12*(octave+1)) + int32(index), nil
+}
+
+func setSfzGenerator(region *InstrumentRegion, generatorType uint16, value string, scale float64) error {
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	setClampedGenerator(region, generatorType, scale*x)
+	return nil
+}
+
+// Converts the time in seconds to the time cents.
+func setSfzTimeGenerator(region *InstrumentRegion, generatorType uint16, value string) error {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if seconds <= 0 {
+		region.gs[generatorType] = -12000
+		return nil
+	}
+	setClampedGenerator(region, generatorType, 1200*math.Log2(seconds))
+	return nil
+}
+
+// Converts the frequency in hertz to the absolute cents.
+func setSfzFrequencyGenerator(region *InstrumentRegion, generatorType uint16, value string) error {
+	hertz, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if hertz <= 0 {
+		return nil
+	}
+	setClampedGenerator(region, generatorType, 1200*math.Log2(hertz/8.176))
+	return nil
+}
+
+func setClampedGenerator(region *InstrumentRegion, generatorType uint16, value float64) {
+	value = math.Round(value)
+	if value < math.MinInt16 {
+		value = math.MinInt16
+	}
+	if value > math.MaxInt16 {
+		value = math.MaxInt16
+	}
+	region.gs[generatorType] = int16(value)
+}
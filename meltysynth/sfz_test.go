@@ -0,0 +1,130 @@
+package meltysynth
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func createTestWave(length int, loop bool) []byte {
+	samples := make([]int16, length)
+	for i := 0; i < length; i++ {
+		samples[i] = int16(8000 * (i%50 - 25) / 25)
+	}
+	chunks := [][]byte{
+		createRiffChunk("fmt ", littleEndianBytes(uint16(1), uint16(1), uint32(44100), uint32(88200), uint16(2), uint16(16))),
+		createRiffChunk("data", littleEndianBytes(samples)),
+	}
+	if loop {
+		chunks = append(chunks, createRiffChunk("smpl", littleEndianBytes(make([]byte, 28), uint32(1), uint32(0),
+			uint32(0), uint32(0), uint32(100), uint32(899), uint32(0), uint32(0))))
+	}
+	return createRiffList("RIFF", "WAVE", chunks...)
+}
+
+const testSfz = `
+/* The test instrument
+   with a block comment. */
+#define $VEL 64
+<control> default_path=samples\
+<global> ampeg_release=0.5 // The release of all regions.
+<group> lovel=0 hivel=$VEL ampeg_attack=0.25 ampeg_sustain=50
+<region> sample=pad sound.wav lokey=c3 hikey=b3 pitch_keycenter=a3 tune=-30 transpose=1
+<region> sample=pad sound.wav key=72 loop_mode=loop_sustain loop_start=200 loop_end=599
+<group> lovel=65
+#include "hat.sfz"
+`
+
+const testHatSfz = `
+<region> sample=hat.wav key=42 group=1 off_by=1 volume=-6 pan=-50 cutoff=1000 loop_mode=one_shot
+<region> sample=hat.wav key=43 trigger=release
+`
+
+func TestSoundFontFromSFZ(t *testing.T) {
+	fsys := fstest.MapFS{
+		"inst/test.sfz":              {Data: []byte(testSfz)},
+		"inst/hat.sfz":               {Data: []byte(testHatSfz)},
+		"inst/samples/pad sound.wav": {Data: createTestWave(1000, true)},
+		"inst/samples/hat.wav":       {Data: createTestWave(300, false)},
+	}
+
+	soundFont, err := NewSoundFontFromSFZ(fsys, "inst/test.sfz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(soundFont.Presets) != 1 || soundFont.Presets[0].Name != "test" {
+		t.Fatalf("unexpected presets")
+	}
+	if len(soundFont.SampleHeaders) != 2 {
+		t.Fatalf("expected 2 samples, but got %d", len(soundFont.SampleHeaders))
+	}
+
+	regions := soundFont.Instruments[0].Regions
+	if len(regions) != 3 {
+		t.Fatalf("expected 3 regions, but got %d", len(regions))
+	}
+
+	pad := regions[0]
+	if pad.GetKeyRangeStart() != 48 || pad.GetKeyRangeEnd() != 59 || pad.GetRootKey() != 57 {
+		t.Errorf("unexpected key range %d-%d or root key %d", pad.GetKeyRangeStart(), pad.GetKeyRangeEnd(), pad.GetRootKey())
+	}
+	if pad.GetVelocityRangeEnd() != 64 {
+		t.Errorf("the opcode of the group was not inherited")
+	}
+	if pad.GetCoarseTune() != 0 || pad.GetFineTune() != 70 {
+		t.Errorf("unexpected tuning %d %d", pad.GetCoarseTune(), pad.GetFineTune())
+	}
+	if pad.GetAttackVolumeEnvelope() != 0.25 || pad.GetReleaseVolumeEnvelope() != 0.5 || pad.gs[gen_SustainVolumeEnvelope] != 60 {
+		t.Errorf("the envelope was not converted")
+	}
+	if pad.GetSampleModes() != loop_Continuous || pad.GetSampleStartLoop()-pad.Sample.Start != 100 || pad.GetSampleEndLoop()-pad.Sample.Start != 900 {
+		t.Errorf("the loop of the wav file was not used")
+	}
+
+	sustained := regions[1]
+	if sustained.GetKeyRangeStart() != 72 || sustained.GetKeyRangeEnd() != 72 || sustained.GetRootKey() != 72 {
+		t.Errorf("the key opcode was not converted")
+	}
+	if sustained.GetSampleModes() != loop_LoopUntilNoteOff || sustained.GetSampleStartLoop()-sustained.Sample.Start != 200 || sustained.GetSampleEndLoop()-sustained.Sample.Start != 600 {
+		t.Errorf("the loop of the region was not converted")
+	}
+
+	hat := regions[2]
+	if hat.GetVelocityRangeStart() != 65 || hat.GetVelocityRangeEnd() != 127 || hat.GetReleaseVolumeEnvelope() != 0.5 {
+		t.Errorf("the opcodes of the second group were not applied")
+	}
+	if hat.GetExclusiveClass() != 1 || hat.GetSampleModes() != loop_NoLoop || hat.GetPan() != -25 {
+		t.Errorf("the opcodes of the included file were not applied")
+	}
+	if hat.gs[gen_InitialAttenuation] != 150 || hat.gs[gen_InitialFilterCutoffFrequency] != 8321 {
+		t.Errorf("unexpected attenuation %d or cutoff %d", hat.gs[gen_InitialAttenuation], hat.gs[gen_InitialFilterCutoffFrequency])
+	}
+
+	synthesizer, err := NewSynthesizer(soundFont, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.NoteOn(0, 50, 60)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+	synthesizer.Render(left, right)
+	silent := true
+	for _, value := range left {
+		if value != 0 {
+			silent = false
+		}
+	}
+	if silent {
+		t.Error("the imported SoundFont did not make any sound")
+	}
+}
+
+func TestSfzKey(t *testing.T) {
+	keys := map[string]int32{"60": 60, "c4": 60, "C#4": 61, "db4": 61, "a3": 57, "c-1": 0, "g9": 127, "bb2": 46}
+	for value, expected := range keys {
+		key, err := parseSfzKey(value)
+		if err != nil || key != expected {
+			t.Errorf("%q: expected %d, but got %d (%v)", value, expected, key, err)
+		}
+	}
+}
@@ -11,52 +11,43 @@ type SoundFont struct {
 	Info          *SoundFontInfo
 	BitsPerSample int32
 	WaveData      []int16
+	WaveData24    []byte // The lower 8 bits of the 24-bit samples, or nil for 16-bit SoundFonts.
 	SampleHeaders []*SampleHeader
 	Presets       []*Preset
 	Instruments   []*Instrument
+
+	// The sample data which is read on demand, or nil if the wave data is in memory.
+	lazyData *lazySampleData
 }
 
 func NewSoundFont(r io.Reader) (*SoundFont, error) {
-	chunkId, err := readFourCC(r)
-	if err != nil {
-		return nil, err
-	}
-	if chunkId != "RIFF" {
-		return nil, errors.New("the riff chunk was not found")
-	}
-
-	var size int32
-	err = binary.Read(r, binary.LittleEndian, &size)
-	if err != nil {
-		return nil, err
-	}
+	return readSoundFont(newSoundFontParser(r, false))
+}
 
-	var formType string
-	formType, err = readFourCC(r)
+func readSoundFont(p *soundFontParser) (*SoundFont, error) {
+	err := readRiffHeader(p)
 	if err != nil {
 		return nil, err
 	}
-	if formType != "sfbk" {
-		return nil, fmt.Errorf(`the type of the riff chunk must be "sfbk", but was %q`, formType)
-	}
 
 	result := &SoundFont{}
 
-	result.Info, err = newSoundFontInfo(r)
+	result.Info, err = newSoundFontInfo(p)
 	if err != nil {
 		return nil, err
 	}
 
 	var sampleData *soundFontSampleData
-	sampleData, err = newSoundFontSampleData(r)
+	sampleData, err = newSoundFontSampleData(p, result.Info.Version.Major >= 3)
 	if err != nil {
 		return nil, err
 	}
 	result.BitsPerSample = sampleData.bitsPerSample
 	result.WaveData = sampleData.samples
+	result.WaveData24 = sampleData.samples24
 
 	var parameters *soundFontParameters
-	parameters, err = newSoundFontParameters(r)
+	parameters, err = newSoundFontParameters(p)
 	if err != nil {
 		return nil, err
 	}
@@ -65,5 +56,52 @@ func NewSoundFont(r io.Reader) (*SoundFont, error) {
 	result.Presets = parameters.presets
 	result.Instruments = parameters.instruments
 
+	if hasCompressedSamples(result.SampleHeaders) {
+		data := sampleData.data
+		if data == nil {
+			// The version is wrong, but the raw bytes can be restored from the samples.
+			data = samplesToBytes(sampleData.samples)
+		}
+		result.WaveData, err = decompressSamples(data, sampleData.samples, result.SampleHeaders)
+		if err != nil {
+			return nil, p.newError("smpl", err)
+		}
+		result.BitsPerSample = 16
+		result.WaveData24 = nil
+		result.Info.Version = SoundFontVersion{Major: 2, Minor: 1}
+	}
+
+	p.repairSampleHeaders(result.SampleHeaders, int32(len(result.WaveData)))
+
 	return result, nil
 }
+
+func readRiffHeader(p *soundFontParser) error {
+	r := p.reader
+
+	p.beginChunk("RIFF")
+	chunkId, err := readFourCC(r)
+	if err != nil {
+		return p.newError("RIFF", err)
+	}
+	if chunkId != "RIFF" {
+		return p.newError("RIFF", errors.New("the riff chunk was not found"))
+	}
+
+	var size int32
+	err = binary.Read(r, binary.LittleEndian, &size)
+	if err != nil {
+		return p.newError("RIFF", err)
+	}
+
+	var formType string
+	formType, err = readFourCC(r)
+	if err != nil {
+		return p.newError("RIFF", err)
+	}
+	if formType != "sfbk" {
+		return p.newError("RIFF", fmt.Errorf(`the type of the riff chunk must be "sfbk", but was %q`, formType))
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package meltysynth
+
+import (
+	"errors"
+	"fmt"
+)
+
+type SoundFontBuilder struct {
+	info          *SoundFontInfo
+	waveData      []int16
+	sampleHeaders []*SampleHeader
+	instruments   []*Instrument
+	presets       []*Preset
+
+	// The partners of the linked stereo samples.
+	links map[*SampleHeader]*SampleHeader
+}
+
+func NewSoundFontBuilder(name string) *SoundFontBuilder {
+	result := new(SoundFontBuilder)
+
+	result.info = new(SoundFontInfo)
+	result.info.Version = SoundFontVersion{Major: 2, Minor: 1}
+	result.info.TargetSoundEngine = "EMU8000"
+	result.info.BankName = name
+
+	result.links = make(map[*SampleHeader]*SampleHeader)
+
+	return result
+}
+
+func (builder *SoundFontBuilder) Info() *SoundFontInfo {
+	return builder.info
+}
+
+// Adds the mono sample to the wave data.
+// The loop covers the whole sample until SetSampleLoop is called.
+func (builder *SoundFontBuilder) AddSample(name string, data []int16, sampleRate int32, originalPitch uint8) *SampleHeader {
+	start := int32(len(builder.waveData))
+	builder.waveData = append(builder.waveData, data...)
+	end := int32(len(builder.waveData))
+
+	// Each sample must be followed by at least 46 zero samples.
+	builder.waveData = append(builder.waveData, make([]int16, 46)...)
+
+	header := new(SampleHeader)
+	header.Name = name
+	header.Start = start
+	header.End = end
+	header.StartLoop = start
+	header.EndLoop = end
+	header.SampleRate = sampleRate
+	header.OriginalPitch = originalPitch
+	header.SampleType = 1
+
+	builder.sampleHeaders = append(builder.sampleHeaders, header)
+
+	return header
+}
+
+// Adds the mono sample in the range of -1 to 1 to the wave data.
+func (builder *SoundFontBuilder) AddSampleFloat32(name string, data []float32, sampleRate int32, originalPitch uint8) *SampleHeader {
+	converted := make([]int16, len(data))
+	for i := 0; i < len(data); i++ {
+		converted[i] = floatToInt16(data[i])
+	}
+	return builder.AddSample(name, converted, sampleRate, originalPitch)
+}
+
+// Sets the loop points relative to the start of the sample.
+func (builder *SoundFontBuilder) SetSampleLoop(sample *SampleHeader, startLoop int32, endLoop int32) error {
+	if !(0 <= startLoop && startLoop < endLoop && endLoop <= sample.End-sample.Start) {
+		return fmt.Errorf("the loop of the sample %q is out of range", sample.Name)
+	}
+
+	sample.StartLoop = sample.Start + startLoop
+	sample.EndLoop = sample.Start + endLoop
+
+	return nil
+}
+
+// Links the samples as the left and right channels of a stereo sample.
+// The regions which play the pair at the same time are rendered by a single voice.
+func (builder *SoundFontBuilder) LinkSamples(left *SampleHeader, right *SampleHeader) error {
+	if left == right {
+		return fmt.Errorf("the sample %q cannot be linked to itself", left.Name)
+	}
+	if left.End-left.Start != right.End-right.Start {
+		return fmt.Errorf("the samples %q and %q have different lengths", left.Name, right.Name)
+	}
+
+	left.SampleType = sampleType_Left
+	right.SampleType = sampleType_Right
+	builder.links[left] = right
+	builder.links[right] = left
+
+	return nil
+}
+
+func (builder *SoundFontBuilder) AddInstrument(name string) *Instrument {
+	instrument := new(Instrument)
+	instrument.Name = name
+	builder.instruments = append(builder.instruments, instrument)
+	return instrument
+}
+
+func (builder *SoundFontBuilder) AddPreset(name string, patchNumber int32, bankNumber int32) *Preset {
+	preset := new(Preset)
+	preset.Name = name
+	preset.PatchNumber = patchNumber
+	preset.BankNumber = bankNumber
+	builder.presets = append(builder.presets, preset)
+	return preset
+}
+
+func (instrument *Instrument) AddRegion(sample *SampleHeader) *InstrumentRegion {
+	region := NewInstrumentRegion(sample)
+	instrument.Regions = append(instrument.Regions, region)
+	return region
+}
+
+func (preset *Preset) AddRegion(instrument *Instrument) *PresetRegion {
+	region := NewPresetRegion(instrument)
+	preset.Regions = append(preset.Regions, region)
+	return region
+}
+
+// Builds the SoundFont from the copies of the samples, instruments and presets,
+// so the builder can be modified and built again without affecting the result.
+func (builder *SoundFontBuilder) Build() (*SoundFont, error) {
+	if len(builder.presets) == 0 {
+		return nil, errors.New("no valid preset was found")
+	}
+	if len(builder.instruments) == 0 {
+		return nil, errors.New("no valid instrument was found")
+	}
+
+	sampleIds := make(map[*SampleHeader]int16, len(builder.sampleHeaders))
+	sampleHeaders := make([]*SampleHeader, len(builder.sampleHeaders))
+	for i, sample := range builder.sampleHeaders {
+		sampleIds[sample] = int16(i)
+		copied := *sample
+		sampleHeaders[i] = &copied
+	}
+
+	for sample, partner := range builder.links {
+		id, found := sampleIds[partner]
+		if !found {
+			return nil, fmt.Errorf("the sample %q is linked to a sample not in the SoundFont", sample.Name)
+		}
+		if index, found := sampleIds[sample]; found {
+			sampleHeaders[index].Link = uint16(id)
+		}
+	}
+
+	instrumentIds := make(map[*Instrument]int16, len(builder.instruments))
+	for i, instrument := range builder.instruments {
+		instrumentIds[instrument] = int16(i)
+	}
+
+	// The ID generators are set as if the SoundFont was read from a file.
+	instruments := make([]*Instrument, len(builder.instruments))
+	for i, instrument := range builder.instruments {
+		copied := &Instrument{Name: instrument.Name, Regions: make([]*InstrumentRegion, len(instrument.Regions))}
+		for j, region := range instrument.Regions {
+			id, found := sampleIds[region.Sample]
+			if !found {
+				return nil, fmt.Errorf("the instrument %q refers to a sample not in the SoundFont", instrument.Name)
+			}
+			if !isValidRange(region.gs[gen_KeyRange]) || !isValidRange(region.gs[gen_VelocityRange]) {
+				return nil, fmt.Errorf("the instrument %q contains an invalid key or velocity range", instrument.Name)
+			}
+			copiedRegion := *region
+			copiedRegion.Sample = sampleHeaders[id]
+			copiedRegion.Modulators = append([]Modulator(nil), region.Modulators...)
+			copiedRegion.gs[gen_SampleID] = id
+			copied.Regions[j] = &copiedRegion
+		}
+		instruments[i] = copied
+	}
+
+	presets := make([]*Preset, len(builder.presets))
+	for i, preset := range builder.presets {
+		copied := *preset
+		copied.Regions = make([]*PresetRegion, len(preset.Regions))
+		for j, region := range preset.Regions {
+			id, found := instrumentIds[region.Instrument]
+			if !found {
+				return nil, fmt.Errorf("the preset %q refers to an instrument not in the SoundFont", preset.Name)
+			}
+			if !isValidRange(region.gs[gen_KeyRange]) || !isValidRange(region.gs[gen_VelocityRange]) {
+				return nil, fmt.Errorf("the preset %q contains an invalid key or velocity range", preset.Name)
+			}
+			copiedRegion := *region
+			copiedRegion.Instrument = instruments[id]
+			copiedRegion.Modulators = append([]Modulator(nil), region.Modulators...)
+			copiedRegion.gs[gen_Instrument] = id
+			copied.Regions[j] = &copiedRegion
+		}
+		presets[i] = &copied
+	}
+
+	info := *builder.info
+
+	result := new(SoundFont)
+	result.Info = &info
+	result.BitsPerSample = 16
+	result.WaveData = append([]int16(nil), builder.waveData...)
+	result.SampleHeaders = sampleHeaders
+	result.Instruments = instruments
+	result.Presets = presets
+
+	return result, nil
+}
+
+func isValidRange(value int16) bool {
+	start := int32(value) & 0xFF
+	end := (int32(value) >> 8) & 0xFF
+	return start <= end && end <= 127
+}
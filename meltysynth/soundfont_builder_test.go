@@ -0,0 +1,125 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+func createSineWave(length int, period int) []float32 {
+	data := make([]float32, length)
+	for i := 0; i < length; i++ {
+		data[i] = float32(0.5 * math.Sin(2*math.Pi*float64(i)/float64(period)))
+	}
+	return data
+}
+
+func TestSoundFontBuilder(t *testing.T) {
+	builder := NewSoundFontBuilder("test")
+
+	sine := builder.AddSampleFloat32("sine", createSineWave(4410, 100), 44100, 69)
+	err := builder.SetSampleLoop(sine, 100, 4400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	square := builder.AddSample("square", []int16{10000, 10000, -10000, -10000}, 44100, 60)
+
+	instrument := builder.AddInstrument("instrument")
+	low := instrument.AddRegion(sine)
+	low.SetKeyRange(0, 63)
+	low.SetGenerator(GeneratorSampleModes, 1)
+	high := instrument.AddRegion(square)
+	high.SetKeyRange(64, 127)
+	high.SetVelocityRange(1, 100)
+	high.SetGenerator(GeneratorInitialAttenuation, 60)
+
+	preset := builder.AddPreset("preset", 0, 0)
+	preset.AddRegion(instrument).SetGenerator(GeneratorCoarseTune, -12)
+
+	soundFont, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sine.End-sine.Start != 4410 || square.Start != sine.End+46 {
+		t.Errorf("the samples were not placed correctly")
+	}
+	if sine.StartLoop != sine.Start+100 || sine.EndLoop != sine.Start+4400 {
+		t.Errorf("the loop was not set")
+	}
+	if soundFont.WaveData[sine.Start+25] != 16384 {
+		t.Errorf("the float samples were not converted: %d", soundFont.WaveData[sine.Start+25])
+	}
+	if high.GetKeyRangeStart() != 64 || high.GetVelocityRangeEnd() != 100 || high.GetInitialAttenuation() != 6 {
+		t.Errorf("the generators were not set")
+	}
+	if soundFont.Instruments[0].Regions[1].GetGenerator(GeneratorSampleID) != 1 {
+		t.Errorf("the sample ID was not set")
+	}
+
+	// The SoundFont is not affected by the changes made to the builder after Build.
+	high.SetGenerator(GeneratorInitialAttenuation, 0)
+	sine.Name = "changed"
+	if soundFont.Instruments[0].Regions[1].GetInitialAttenuation() != 6 || soundFont.SampleHeaders[0].Name != "sine" {
+		t.Errorf("the SoundFont shares the objects with the builder")
+	}
+	if soundFont.Presets[0].Regions[0].Instrument != soundFont.Instruments[0] || soundFont.Instruments[0].Regions[0].Sample != soundFont.SampleHeaders[0] {
+		t.Errorf("the references were not updated")
+	}
+
+	checkSameSoundFont(t, soundFont, writeAndReadSoundFont(t, soundFont))
+
+	synthesizer, err := NewSynthesizer(soundFont, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.NoteOn(0, 60, 100)
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+	synthesizer.Render(left, right)
+
+	var sum float64
+	for i := 0; i < len(left); i++ {
+		sum += math.Abs(float64(left[i]))
+	}
+	if sum == 0 {
+		t.Error("the built SoundFont did not make any sound")
+	}
+}
+
+func TestSoundFontBuilder_Invalid(t *testing.T) {
+	builder := NewSoundFontBuilder("test")
+	sample := builder.AddSample("sample", make([]int16, 10), 44100, 60)
+
+	if builder.SetSampleLoop(sample, 5, 11) == nil {
+		t.Error("the loop out of range was accepted")
+	}
+
+	_, err := builder.Build()
+	if err == nil {
+		t.Error("the SoundFont without presets was accepted")
+	}
+
+	instrument := builder.AddInstrument("instrument")
+	instrument.AddRegion(sample).SetKeyRange(100, 50)
+	builder.AddPreset("preset", 0, 0).AddRegion(instrument)
+	_, err = builder.Build()
+	if err == nil {
+		t.Error("the invalid key range was accepted")
+	}
+}
+
+func TestGeneratorType(t *testing.T) {
+	if GeneratorPan.String() != "pan" || GeneratorKeyRange.String() != "keyRange" || GeneratorType(1000).String() != "unknown" {
+		t.Error("the generator names are wrong")
+	}
+
+	region := new(InstrumentRegion)
+	region.SetGenerator(GeneratorFineTune, -20)
+	region.SetGenerator(GeneratorType(1000), 5)
+	if region.GetGenerator(GeneratorFineTune) != -20 {
+		t.Error("the generator was not set")
+	}
+	if region.GetGenerator(GeneratorType(1000)) != 0 {
+		t.Error("the unknown generator should be ignored")
+	}
+}
@@ -0,0 +1,92 @@
+package meltysynth
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// In SF3, the samples with this flag are compressed with Ogg Vorbis.
+// The start and end of the sample header are the byte offsets of the Ogg data,
+// and the loop points are relative to the start of the decoded sample.
+const sampleType_OggVorbis uint16 = 0x10
+
+func hasCompressedSamples(headers []*SampleHeader) bool {
+	for _, header := range headers {
+		if header.SampleType&sampleType_OggVorbis != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes all the compressed samples and rebuilds the wave data.
+// The sample headers are modified to point to the new wave data.
+func decompressSamples(data []byte, samples []int16, headers []*SampleHeader) ([]int16, error) {
+	var result []int16
+
+	for _, header := range headers {
+		start := int32(len(result))
+
+		if header.SampleType&sampleType_OggVorbis != 0 {
+			if header.Start < 0 || header.Start > header.End || int(header.End) > len(data) {
+				return nil, fmt.Errorf("the compressed sample %q is out of range", header.Name)
+			}
+
+			decoded, _, err := decodeVorbis(data[header.Start:header.End])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode the compressed sample %q: %v", header.Name, err)
+			}
+
+			for _, value := range decoded {
+				result = append(result, floatToInt16(value))
+			}
+
+			header.StartLoop += start
+			header.EndLoop += start
+			header.SampleType &^= sampleType_OggVorbis
+		} else {
+			sampleStart := header.Start
+			if sampleStart < 0 {
+				sampleStart = 0
+			}
+			sampleEnd := header.End
+			if sampleEnd > int32(len(samples)) {
+				sampleEnd = int32(len(samples))
+			}
+			if sampleStart < sampleEnd {
+				result = append(result, samples[sampleStart:sampleEnd]...)
+			}
+
+			header.StartLoop += start - header.Start
+			header.EndLoop += start - header.Start
+		}
+
+		header.Start = start
+		header.End = int32(len(result))
+
+		// Each sample must be followed by at least 46 zero samples.
+		result = append(result, make([]int16, 46)...)
+	}
+
+	return result, nil
+}
+
+func samplesToBytes(samples []int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, value := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(value))
+	}
+	return data
+}
+
+func floatToInt16(value float32) int16 {
+	x := math.Floor(32768*float64(value) + 0.5)
+	if x > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if x < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(x)
+}
@@ -0,0 +1,180 @@
+package meltysynth
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+)
+
+// The fixture is a small mono stream made of two VQ codebooks, a flat floor and a residue,
+// and the expected values were taken from an independent decoder.
+func loadVorbisFixture(t *testing.T) []byte {
+	data, err := os.ReadFile("testdata/tone.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeVorbis(t *testing.T) {
+	samples, sampleRate, err := decodeVorbis(loadVorbisFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampleRate != 22050 {
+		t.Errorf("expected the sample rate 22050, but got %d", sampleRate)
+	}
+
+	// The length is given by the granule position of the last page.
+	if len(samples) != 800 {
+		t.Fatalf("expected 800 samples, but got %d", len(samples))
+	}
+
+	expected := map[int]float64{
+		0:   -0.041130174,
+		1:   -0.026726084,
+		100: 0.031241408,
+		255: -0.063853323,
+		256: -0.13093838,
+		400: 0.035921294,
+		511: 0.031607196,
+		640: -0.04332234,
+		799: 0.079035193,
+	}
+	for i, value := range expected {
+		if math.Abs(float64(samples[i])-value) > 1.0e-6 {
+			t.Errorf("sample %d: expected %f, but got %f", i, value, samples[i])
+		}
+	}
+
+	var sum float64
+	for _, value := range samples {
+		sum += float64(value) * float64(value)
+	}
+	if math.Abs(sum-8.673617) > 1.0e-4 {
+		t.Errorf("expected the energy 8.673617, but got %f", sum)
+	}
+}
+
+func TestDecodeVorbis_Malformed(t *testing.T) {
+	data := loadVorbisFixture(t)
+	audioPage := bytes.LastIndex(data, []byte("OggS"))
+
+	// The truncated data must be rejected, except at the boundary of the pages.
+	for i := 0; i < len(data); i++ {
+		_, _, err := decodeVorbis(data[0:i])
+		if err == nil && i != audioPage {
+			t.Errorf("the data truncated at %d was accepted", i)
+		}
+	}
+
+	// The corrupted data may or may not be decoded, but it must not panic.
+	for i := 0; i < len(data); i++ {
+		for bit := 0; bit < 8; bit++ {
+			corrupted := append([]byte(nil), data...)
+			corrupted[i] ^= 1 << bit
+			decodeVorbis(corrupted)
+		}
+	}
+}
+
+func TestDecompressSamples_Vorbis(t *testing.T) {
+	ogg := loadVorbisFixture(t)
+	decoded, _, err := decodeVorbis(ogg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An uncompressed sample followed by the compressed one.
+	samples := []int16{1, 2, 3, 4}
+	data := append(samplesToBytes(samples), ogg...)
+	headers := []*SampleHeader{
+		{Name: "a", Start: 0, End: 4, StartLoop: 1, EndLoop: 3},
+		{Name: "b", Start: 8, End: int32(8 + len(ogg)), StartLoop: 100, EndLoop: 700, SampleType: sampleType_OggVorbis},
+	}
+
+	result, err := decompressSamples(data, samples, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := headers[1]
+	if b.SampleType&sampleType_OggVorbis != 0 {
+		t.Error("the sample is still marked as compressed")
+	}
+	if b.Start != 50 || b.End != 850 || b.StartLoop != 150 || b.EndLoop != 750 {
+		t.Errorf("sample b was not relocated: %+v", *b)
+	}
+	for i, value := range decoded {
+		if result[b.Start+int32(i)] != floatToInt16(value) {
+			t.Fatalf("the decoded sample differs at %d", i)
+		}
+	}
+}
+
+func TestDecompressSamples_Uncompressed(t *testing.T) {
+	samples := []int16{0, 0, 1, 2, 3, 4, 0, 0, 5, 6, 7}
+	headers := []*SampleHeader{
+		{Name: "a", Start: 2, End: 6, StartLoop: 3, EndLoop: 5},
+		{Name: "b", Start: 8, End: 11, StartLoop: 8, EndLoop: 10},
+	}
+
+	result, err := decompressSamples(nil, samples, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 4+46+3+46 {
+		t.Fatalf("unexpected length %d", len(result))
+	}
+
+	a := headers[0]
+	if a.Start != 0 || a.End != 4 || a.StartLoop != 1 || a.EndLoop != 3 {
+		t.Errorf("sample a was not relocated: %+v", *a)
+	}
+	b := headers[1]
+	if b.Start != 50 || b.End != 53 || b.StartLoop != 50 || b.EndLoop != 52 {
+		t.Errorf("sample b was not relocated: %+v", *b)
+	}
+	if result[b.Start] != 5 || result[b.End-1] != 7 || result[a.End] != 0 {
+		t.Error("the wave data is wrong")
+	}
+}
+
+func TestDecompressSamples_InvalidRange(t *testing.T) {
+	headers := []*SampleHeader{
+		{Name: "a", Start: 0, End: 100, SampleType: sampleType_OggVorbis},
+	}
+	_, err := decompressSamples(make([]byte, 10), nil, headers)
+	if err == nil {
+		t.Error("the out of range sample was accepted")
+	}
+}
+
+func TestFloatToInt16(t *testing.T) {
+	values := []float32{0, 0.5, -0.5, 1, -1, 2, -2}
+	expected := []int16{0, 16384, -16384, 32767, -32768, 32767, -32768}
+	for i := 0; i < len(values); i++ {
+		if floatToInt16(values[i]) != expected[i] {
+			t.Errorf("%f: expected %d, but got %d", values[i], expected[i], floatToInt16(values[i]))
+		}
+	}
+}
+
+func TestSF3_SoundFont(t *testing.T) {
+	soundFont := loadSF3(t)
+
+	// The version is changed to SF2, since the samples are no longer compressed.
+	if soundFont.Info.Version.Major != 2 {
+		t.Errorf("expected version 2, but got %d", soundFont.Info.Version.Major)
+	}
+
+	for _, header := range soundFont.SampleHeaders {
+		if header.SampleType&sampleType_OggVorbis != 0 {
+			t.Errorf("the sample %q is still compressed", header.Name)
+		}
+		if header.Start < 0 || header.Start > header.End || int(header.End) > len(soundFont.WaveData) {
+			t.Errorf("the sample %q is out of range", header.Name)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 )
 
 type SoundFontInfo struct {
@@ -21,48 +20,54 @@ type SoundFontInfo struct {
 	Tools             string
 }
 
-func newSoundFontInfo(r io.Reader) (*SoundFontInfo, error) {
+func newSoundFontInfo(p *soundFontParser) (*SoundFontInfo, error) {
 	var err error
 
+	r := p.reader
+
+	p.beginChunk("LIST")
 	var chunkId string
 	chunkId, err = readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if chunkId != "LIST" {
-		return nil, errors.New("the list chunk was not found")
+		return nil, p.newError("LIST", errors.New("the list chunk was not found"))
 	}
 
 	var pos int32 = 0
 	var end int32
 	err = binary.Read(r, binary.LittleEndian, &end)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 
 	var listType string
 	listType, err = readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if listType != "INFO" {
-		return nil, fmt.Errorf(`the type of the list chunk must be "INFO", but was %q`, listType)
+		return nil, p.newError("LIST", fmt.Errorf(`the type of the list chunk must be "INFO", but was %q`, listType))
 	}
 	pos += 4
 	result := new(SoundFontInfo)
 
 	for pos < end {
+		position := r.position
+
 		var id string
 		id, err = readFourCC(r)
 		if err != nil {
-			return nil, err
+			return nil, p.newError("LIST", err)
 		}
 		pos += 4
+		p.offsets[id] = position
 
 		var size int32
 		err = binary.Read(r, binary.LittleEndian, &size)
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 		pos += 4
 
@@ -90,11 +95,15 @@ func newSoundFontInfo(r io.Reader) (*SoundFontInfo, error) {
 		case "ISFT":
 			result.Tools, err = readFixedLengthString(r, size)
 		default:
-			return nil, fmt.Errorf("the info list contains an unknown id %q", id)
+			// The unknown chunks are padded to an even size.
+			if size%2 != 0 && pos+size < end {
+				size++
+			}
+			err = p.skipUnknownChunk("info", id, size)
 		}
 
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 
 		pos += size
@@ -0,0 +1,320 @@
+package meltysynth
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// The part of the wave data needed to play a region.
+type waveWindow struct {
+	data   []int16
+	data24 []byte
+	offset int32 // The position of the first sample in the whole wave data.
+}
+
+// The sample data which is read from the file on demand.
+// The recently used windows are cached up to the specified size in bytes.
+type lazySampleData struct {
+	reader     io.ReaderAt
+	position   int64
+	size       int32
+	count      int32
+	position24 int64
+	has24      bool
+	cacheSize  int64
+	cacheUsed  int64
+	cache      map[[2]int32]*list.Element
+	cacheOrder *list.List
+	cacheMutex sync.Mutex
+}
+
+type lazyCacheEntry struct {
+	key    [2]int32
+	window waveWindow
+	size   int64
+}
+
+// Reads the SoundFont from r, without loading the sample data into memory.
+// The sample data is read on demand when a note is played.
+// If cacheSize is greater than zero, up to cacheSize bytes of the sample data is cached.
+// SF3 SoundFonts are decoded into memory, since the compressed samples cannot be read partially.
+func NewSoundFontFromReaderAt(r io.ReaderAt, cacheSize int64) (*SoundFont, error) {
+	sr := io.NewSectionReader(r, 0, math.MaxInt64)
+	return readSoundFontFromReaderAt(newSoundFontParser(sr, false), sr, r, cacheSize)
+}
+
+// Reads the SoundFont from r in the lenient mode, without loading the sample data into memory.
+// See NewSoundFontLenient for the problems repaired.
+func NewSoundFontFromReaderAtLenient(r io.ReaderAt, cacheSize int64) (*SoundFont, []SoundFontWarning, error) {
+	sr := io.NewSectionReader(r, 0, math.MaxInt64)
+	p := newSoundFontParser(sr, true)
+	result, err := readSoundFontFromReaderAt(p, sr, r, cacheSize)
+	if err != nil {
+		return nil, p.warnings, err
+	}
+	return result, p.warnings, nil
+}
+
+func readSoundFontFromReaderAt(p *soundFontParser, sr *io.SectionReader, r io.ReaderAt, cacheSize int64) (*SoundFont, error) {
+	err := readRiffHeader(p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SoundFont{}
+
+	result.Info, err = newSoundFontInfo(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var lazyData *lazySampleData
+	lazyData, err = newLazySampleData(p, sr, r, cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	result.BitsPerSample = 16
+	if lazyData.has24 {
+		result.BitsPerSample = 24
+	}
+	result.lazyData = lazyData
+
+	var parameters *soundFontParameters
+	parameters, err = newSoundFontParameters(p)
+	if err != nil {
+		return nil, err
+	}
+
+	result.SampleHeaders = parameters.sampleHeaders
+	result.Presets = parameters.presets
+	result.Instruments = parameters.instruments
+
+	if hasCompressedSamples(result.SampleHeaders) {
+		data := make([]byte, lazyData.size)
+		err = readFullAt(r, data, lazyData.position)
+		if err != nil {
+			return nil, p.newError("smpl", err)
+		}
+		result.WaveData, err = decompressSamples(data, nil, result.SampleHeaders)
+		if err != nil {
+			return nil, p.newError("smpl", err)
+		}
+		result.BitsPerSample = 16
+		result.Info.Version = SoundFontVersion{Major: 2, Minor: 1}
+		result.lazyData = nil
+		p.repairSampleHeaders(result.SampleHeaders, int32(len(result.WaveData)))
+	} else {
+		p.repairSampleHeaders(result.SampleHeaders, lazyData.count)
+	}
+
+	return result, nil
+}
+
+// The sub-chunks are skipped by seeking, instead of being read through the parser.
+func newLazySampleData(p *soundFontParser, sr *io.SectionReader, r io.ReaderAt, cacheSize int64) (*lazySampleData, error) {
+	pr := p.reader
+
+	p.beginChunk("LIST")
+	chunkId, err := readFourCC(pr)
+	if err != nil {
+		return nil, p.newError("LIST", err)
+	}
+	if chunkId != "LIST" {
+		return nil, p.newError("LIST", errors.New("the list chunk was not found"))
+	}
+
+	var pos int32
+	var end int32
+	err = binary.Read(pr, binary.LittleEndian, &end)
+	if err != nil {
+		return nil, p.newError("LIST", err)
+	}
+
+	listType, err := readFourCC(pr)
+	if err != nil {
+		return nil, p.newError("LIST", err)
+	}
+	if listType != "sdta" {
+		return nil, p.newError("LIST", fmt.Errorf(`the type of the list chunk must be "sdta", but was %q`, listType))
+	}
+	pos += 4
+
+	result := new(lazySampleData)
+	result.reader = r
+	result.cacheSize = cacheSize
+	result.cache = make(map[[2]int32]*list.Element)
+	result.cacheOrder = list.New()
+
+	found := false
+	var size24 int32
+
+	for pos < end {
+		position := pr.position
+
+		var id string
+		id, err = readFourCC(pr)
+		if err != nil {
+			return nil, p.newError("LIST", err)
+		}
+		pos += 4
+		p.offsets[id] = position
+
+		var size int32
+		err = binary.Read(pr, binary.LittleEndian, &size)
+		if err != nil {
+			return nil, p.newError(id, err)
+		}
+		pos += 4
+
+		switch id {
+		case "smpl":
+			found = true
+			result.position = pr.position
+			result.size = size
+			result.count = size / 2
+		case "sm24":
+			result.position24 = pr.position
+			size24 = size
+		default:
+			if !p.lenient {
+				return nil, p.newError(id, fmt.Errorf("the sdta list contains an unknown id %q", id))
+			}
+			p.warn(id, "the unknown chunk was skipped")
+		}
+
+		// The sub-chunks are padded to an even size.
+		skip := size + size%2
+		if pos+skip > end {
+			skip = end - pos
+		}
+		pr.position, err = sr.Seek(int64(skip), io.SeekCurrent)
+		if err != nil {
+			return nil, p.newError(id, err)
+		}
+		pos += skip
+	}
+
+	if !found {
+		return nil, p.newError("LIST", errors.New("no valid sample data was found"))
+	}
+
+	// If the size of the sm24 sub-chunk does not match the smpl sub-chunk, it should be ignored.
+	result.has24 = size24 == result.count || size24 == result.count+1
+
+	return result, nil
+}
+
+func (soundFont *SoundFont) getWaveWindow(region regionPair) (waveWindow, error) {
+	if soundFont.lazyData == nil {
+		return waveWindow{data: soundFont.WaveData, data24: soundFont.WaveData24}, nil
+	}
+
+	start := region.GetSampleStart()
+	end := region.GetSampleEnd()
+	startLoop := region.GetSampleStartLoop()
+	endLoop := region.GetSampleEndLoop()
+
+	// Each sample is followed by at least 46 zero samples,
+	// which are read by the interpolation beyond the end.
+	first := start
+	if startLoop < first {
+		first = startLoop
+	}
+	last := end
+	if endLoop > last {
+		last = endLoop
+	}
+	last += 46
+
+	return soundFont.lazyData.read(first, last)
+}
+
+func (data *lazySampleData) read(first int32, last int32) (waveWindow, error) {
+	if first < 0 {
+		first = 0
+	}
+	if last > data.count {
+		last = data.count
+	}
+	if first >= last {
+		return waveWindow{}, errors.New("the sample is out of range")
+	}
+
+	key := [2]int32{first, last}
+
+	data.cacheMutex.Lock()
+	element, found := data.cache[key]
+	if found {
+		data.cacheOrder.MoveToFront(element)
+	}
+	data.cacheMutex.Unlock()
+	if found {
+		return element.Value.(*lazyCacheEntry).window, nil
+	}
+
+	length := last - first
+
+	buffer := make([]byte, 2*int64(length))
+	err := readFullAt(data.reader, buffer, data.position+2*int64(first))
+	if err != nil {
+		return waveWindow{}, err
+	}
+	samples := make([]int16, length)
+	for i := 0; i < len(samples); i++ {
+		samples[i] = int16(binary.LittleEndian.Uint16(buffer[2*i:]))
+	}
+
+	var samples24 []byte
+	if data.has24 {
+		samples24 = make([]byte, length)
+		err = readFullAt(data.reader, samples24, data.position24+int64(first))
+		if err != nil {
+			return waveWindow{}, err
+		}
+	}
+
+	window := waveWindow{data: samples, data24: samples24, offset: first}
+
+	entry := &lazyCacheEntry{key: key, window: window, size: int64(len(buffer) + len(samples24))}
+	if entry.size <= data.cacheSize {
+		data.cacheMutex.Lock()
+		if _, found := data.cache[key]; !found {
+			data.cache[key] = data.cacheOrder.PushFront(entry)
+			data.cacheUsed += entry.size
+			for data.cacheUsed > data.cacheSize {
+				oldest := data.cacheOrder.Back()
+				data.cacheOrder.Remove(oldest)
+				delete(data.cache, oldest.Value.(*lazyCacheEntry).key)
+				data.cacheUsed -= oldest.Value.(*lazyCacheEntry).size
+			}
+		}
+		data.cacheMutex.Unlock()
+	}
+
+	return window, nil
+}
+
+// Copies the sample data from the file to w, in the same layout as the smpl and sm24 sub-chunks.
+func (data *lazySampleData) writeTo(w io.Writer, bytes24 bool) error {
+	var err error
+	if !bytes24 {
+		_, err = io.Copy(w, io.NewSectionReader(data.reader, data.position, 2*int64(data.count)))
+	} else {
+		_, err = io.Copy(w, io.NewSectionReader(data.reader, data.position24, int64(data.count)))
+	}
+	return err
+}
+
+// ReadAt may return io.EOF even if all the bytes are read.
+func readFullAt(r io.ReaderAt, buffer []byte, offset int64) error {
+	n, err := r.ReadAt(buffer, offset)
+	if n == len(buffer) {
+		return nil
+	}
+	return err
+}
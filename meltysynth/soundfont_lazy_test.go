@@ -0,0 +1,180 @@
+package meltysynth
+
+import (
+	"bytes"
+	"container/list"
+	"math"
+	"testing"
+)
+
+func renderTestNotes(t *testing.T, soundFont *SoundFont) []float32 {
+	synthesizer, err := NewSynthesizer(soundFont, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.NoteOn(0, 40, 100)
+	synthesizer.NoteOn(0, 80, 50)
+	left := make([]float32, 4096)
+	right := make([]float32, 4096)
+	synthesizer.Render(left, right)
+	return append(left, right...)
+}
+
+func TestSoundFontFromReaderAt(t *testing.T) {
+	for _, cacheSize := range []int64{0, 1 << 20} {
+		expected := createTestSoundFont()
+		var buf bytes.Buffer
+		err := expected.Write(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		soundFont, err := NewSoundFontFromReaderAt(bytes.NewReader(buf.Bytes()), cacheSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if soundFont.WaveData != nil {
+			t.Error("the wave data should not be loaded")
+		}
+		if soundFont.BitsPerSample != 24 {
+			t.Errorf("expected 24 bits per sample, but got %d", soundFont.BitsPerSample)
+		}
+
+		x := renderTestNotes(t, expected)
+		y := renderTestNotes(t, soundFont)
+		for i := 0; i < len(x); i++ {
+			if x[i] != y[i] {
+				t.Fatalf("cache size %d: the output differs at %d", cacheSize, i)
+			}
+		}
+
+		if cacheSize == 0 && soundFont.lazyData.cacheOrder.Len() != 0 {
+			t.Error("the sample data was cached")
+		}
+		if cacheSize > 0 && soundFont.lazyData.cacheOrder.Len() == 0 {
+			t.Error("the sample data was not cached")
+		}
+
+		// The lazy SoundFont can be written as well.
+		var rewritten bytes.Buffer
+		err = soundFont.Write(&rewritten)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), rewritten.Bytes()) {
+			t.Error("the rewritten SoundFont differs")
+		}
+	}
+}
+
+func TestLazySampleData_CacheEviction(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		buf.Write([]byte{byte(i), 0})
+	}
+
+	data := &lazySampleData{reader: bytes.NewReader(buf.Bytes()), size: 2000, count: 1000, cacheSize: 500}
+	data.cache = make(map[[2]int32]*list.Element)
+	data.cacheOrder = list.New()
+
+	for i := int32(0); i < 10; i++ {
+		window, err := data.read(100*i, 100*i+100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if window.offset != 100*i || window.data[1] != int16((100*i+1)%256) {
+			t.Fatal("the window is wrong")
+		}
+		if data.cacheUsed > data.cacheSize {
+			t.Fatalf("the cache exceeded the limit: %d", data.cacheUsed)
+		}
+	}
+	if data.cacheOrder.Len() != 2 {
+		t.Errorf("expected 2 cached windows, but got %d", data.cacheOrder.Len())
+	}
+
+	_, err := data.read(1000, 1100)
+	if err == nil {
+		t.Error("the window out of range was accepted")
+	}
+}
+
+func TestSoundFontFromReaderAt_ModulatedAddress(t *testing.T) {
+	builder := NewSoundFontBuilder("test")
+	loud := make([]int16, 100)
+	for i := range loud {
+		loud[i] = 10000
+	}
+	builder.AddSample("loud", loud, 44100, 60)
+	silent := builder.AddSample("silent", make([]int16, 100), 44100, 60)
+
+	// The velocity moves the start of the silent sample back to the loud one.
+	region := builder.AddInstrument("instrument").AddRegion(silent)
+	region.Modulators = []Modulator{{0x0002, gen_StartAddressOffset, -292, 0, 0}}
+	builder.AddPreset("preset", 0, 0).AddRegion(builder.instruments[0])
+
+	expected, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = expected.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soundFont, err := NewSoundFontFromReaderAt(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(soundFont *SoundFont, velocity int32) []float32 {
+		synthesizer, err := NewSynthesizer(soundFont, NewSynthesizerSettings(44100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		synthesizer.NoteOn(0, 60, velocity)
+		left := make([]float32, 64)
+		right := make([]float32, 64)
+		synthesizer.Render(left, right)
+		return left
+	}
+
+	x := render(expected, 64)
+	y := render(soundFont, 64)
+	var sum float64
+	for i := 0; i < len(x); i++ {
+		if x[i] != y[i] {
+			t.Fatalf("the output differs at %d", i)
+		}
+		sum += math.Abs(float64(x[i]))
+	}
+	if sum == 0 {
+		t.Error("the modulated start address was not applied")
+	}
+
+	// The start moved before the beginning of the wave data is clamped.
+	render(expected, 127)
+	render(soundFont, 127)
+}
+
+func TestSoundFontFromReaderAtLenient(t *testing.T) {
+	soundFont := createTestSoundFont()
+	soundFont.SampleHeaders[0].EndLoop = 1000
+	var buf bytes.Buffer
+	err := soundFont.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, warnings, err := NewSoundFontFromReaderAtLenient(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, but got %d", len(warnings))
+	}
+	header := result.SampleHeaders[0]
+	if header.StartLoop != header.Start || header.EndLoop != header.End {
+		t.Errorf("the invalid loop was not repaired: %+v", *header)
+	}
+}
@@ -53,3 +53,16 @@ func calcClamp(value float32, min float32, max float32) float32 {
 		return value
 	}
 }
+
+// Calculates the gains of the left and right channels for the pan in the range of -50 to 50.
+func calcPanGains(mixGain float32, pan float32) (float32, float32) {
+	angle := float32(math.Pi/200) * (pan + 50)
+	switch {
+	case angle <= 0:
+		return mixGain, 0
+	case angle >= halfPi:
+		return 0, mixGain
+	default:
+		return mixGain * float32(math.Cos(float64(angle))), mixGain * float32(math.Sin(float64(angle)))
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 )
 
 type soundFontParameters struct {
@@ -13,50 +12,58 @@ type soundFontParameters struct {
 	instruments   []*Instrument
 }
 
-func newSoundFontParameters(r io.Reader) (*soundFontParameters, error) {
+func newSoundFontParameters(p *soundFontParser) (*soundFontParameters, error) {
+	r := p.reader
+
+	p.beginChunk("LIST")
 	chunkId, err := readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if chunkId != "LIST" {
-		return nil, errors.New("the list chunk was not found")
+		return nil, p.newError("LIST", errors.New("the list chunk was not found"))
 	}
 
 	var pos, end int32
 	err = binary.Read(r, binary.LittleEndian, &end)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 
 	listType, err := readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if listType != "pdta" {
-		return nil, fmt.Errorf(`the type of the list chunk must be "pdta", but was %q`, listType)
+		return nil, p.newError("LIST", fmt.Errorf(`the type of the list chunk must be "pdta", but was %q`, listType))
 	}
 	pos += 4
 
 	var presetInfos []*presetInfo
 	var presetBag []*zoneInfo
+	var presetModulators []Modulator
 	var presetGenerators []generator
 	var instrumentInfos []*instrumentInfo
 	var instrumentBag []*zoneInfo
+	var instrumentModulators []Modulator
 	var instrumentGenerators []generator
 	var sampleHeaders []*SampleHeader
 
 	for pos < end {
+		position := r.position
+
 		var id string
 		id, err = readFourCC(r)
 		if err != nil {
-			return nil, err
+			return nil, p.newError("LIST", err)
 		}
 		pos += 4
+		p.offsets[id] = position
 
 		var size int32
 		err = binary.Read(r, binary.LittleEndian, &size)
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 		pos += 4
 
@@ -66,7 +73,7 @@ func newSoundFontParameters(r io.Reader) (*soundFontParameters, error) {
 		case "pbag":
 			presetBag, err = readZonesFromChunk(r, size)
 		case "pmod":
-			err = discardModulatorData(r, size)
+			presetModulators, err = readModulatorsFromChunk(r, size)
 		case "pgen":
 			presetGenerators, err = readGeneratorsFromChunk(r, size)
 		case "inst":
@@ -74,66 +81,70 @@ func newSoundFontParameters(r io.Reader) (*soundFontParameters, error) {
 		case "ibag":
 			instrumentBag, err = readZonesFromChunk(r, size)
 		case "imod":
-			err = discardModulatorData(r, size)
+			instrumentModulators, err = readModulatorsFromChunk(r, size)
 		case "igen":
 			instrumentGenerators, err = readGeneratorsFromChunk(r, size)
 		case "shdr":
 			sampleHeaders, err = readSampleHeadersFromChunk(r, size)
 		default:
-			return nil, fmt.Errorf("the info list contains an unknown id %q", id)
+			// The unknown chunks are padded to an even size.
+			if size%2 != 0 && pos+size < end {
+				size++
+			}
+			err = p.skipUnknownChunk("pdta", id, size)
 		}
 
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 
 		pos += size
 	}
 
 	if presetInfos == nil {
-		return nil, errors.New("the phdr sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the phdr sub-chunk was not found"))
 	}
 	if presetBag == nil {
-		return nil, errors.New("the pbag sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the pbag sub-chunk was not found"))
 	}
 	if presetGenerators == nil {
-		return nil, errors.New("the pgen sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the pgen sub-chunk was not found"))
 	}
 	if instrumentInfos == nil {
-		return nil, errors.New("the inst sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the inst sub-chunk was not found"))
 	}
 	if instrumentBag == nil {
-		return nil, errors.New("the ibag sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the ibag sub-chunk was not found"))
 	}
 	if instrumentGenerators == nil {
-		return nil, errors.New("the igen sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the igen sub-chunk was not found"))
 	}
 	if sampleHeaders == nil {
-		return nil, errors.New("the shdr sub-chunk was not found")
+		return nil, p.newError("LIST", errors.New("the shdr sub-chunk was not found"))
 	}
 
 	parameters := new(soundFontParameters)
 
 	parameters.sampleHeaders = sampleHeaders
 
-	instrumentZones, err := createZones(instrumentBag, instrumentGenerators)
+	instrumentZones, err := createZones(p, "ibag", instrumentBag, instrumentGenerators, instrumentModulators)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("ibag", err)
 	}
 
-	parameters.instruments, err = createInstruments(instrumentInfos, instrumentZones, sampleHeaders)
+	parameters.instruments, err = createInstruments(p, instrumentInfos, instrumentZones, sampleHeaders)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("inst", err)
 	}
 
-	presetZones, err := createZones(presetBag, presetGenerators)
+	presetZones, err := createZones(p, "pbag", presetBag, presetGenerators, presetModulators)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("pbag", err)
 	}
 
-	parameters.presets, err = createPresets(presetInfos, presetZones, parameters.instruments)
+	parameters.presets, err = createPresets(p, presetInfos, presetZones, parameters.instruments)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("phdr", err)
 	}
 
 	return parameters, nil
@@ -0,0 +1,132 @@
+package meltysynth
+
+import (
+	"fmt"
+	"io"
+)
+
+// The problem found while reading the SoundFont in the lenient mode.
+type SoundFontWarning struct {
+	Chunk   string // The ID of the chunk where the problem was found.
+	Offset  int64  // The byte offset of the chunk from the beginning of the file.
+	Message string
+}
+
+func (warning SoundFontWarning) String() string {
+	return fmt.Sprintf("%q chunk at offset %d: %s", warning.Chunk, warning.Offset, warning.Message)
+}
+
+// The error returned when the SoundFont cannot be read.
+type SoundFontError struct {
+	Chunk  string // The ID of the chunk where the error occurred.
+	Offset int64  // The byte offset of the chunk from the beginning of the file.
+	Err    error
+}
+
+func (e *SoundFontError) Error() string {
+	return fmt.Sprintf("%q chunk at offset %d: %v", e.Chunk, e.Offset, e.Err)
+}
+
+func (e *SoundFontError) Unwrap() error {
+	return e.Err
+}
+
+// Reads the SoundFont in the lenient mode.
+// The unknown chunks are skipped and the recoverable problems, such as invalid loop points
+// or references to missing samples, are repaired. The problems found are returned as warnings.
+func NewSoundFontLenient(r io.Reader) (*SoundFont, []SoundFontWarning, error) {
+	p := newSoundFontParser(r, true)
+	result, err := readSoundFont(p)
+	if err != nil {
+		return nil, p.warnings, err
+	}
+	return result, p.warnings, nil
+}
+
+// Keeps track of the position in the file and the problems found while reading the SoundFont.
+type soundFontParser struct {
+	reader   *positionReader
+	lenient  bool
+	warnings []SoundFontWarning
+
+	// The offsets of the chunks read so far, which are used to report the problems.
+	offsets map[string]int64
+}
+
+type positionReader struct {
+	r        io.Reader
+	position int64
+}
+
+func (r *positionReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.position += int64(n)
+	return n, err
+}
+
+func newSoundFontParser(r io.Reader, lenient bool) *soundFontParser {
+	result := new(soundFontParser)
+	result.reader = &positionReader{r: r}
+	result.lenient = lenient
+	result.offsets = make(map[string]int64)
+	return result
+}
+
+// Records the offset of the chunk which begins at the current position.
+func (p *soundFontParser) beginChunk(id string) {
+	p.offsets[id] = p.reader.position
+}
+
+func (p *soundFontParser) newError(chunk string, err error) error {
+	if _, ok := err.(*SoundFontError); ok {
+		return err
+	}
+	return &SoundFontError{Chunk: chunk, Offset: p.offsets[chunk], Err: err}
+}
+
+func (p *soundFontParser) warn(chunk string, format string, a ...interface{}) {
+	p.warnings = append(p.warnings, SoundFontWarning{Chunk: chunk, Offset: p.offsets[chunk], Message: fmt.Sprintf(format, a...)})
+}
+
+// Skips the unknown chunk in the lenient mode.
+func (p *soundFontParser) skipUnknownChunk(list string, id string, size int32) error {
+	if !p.lenient {
+		return fmt.Errorf("the %s list contains an unknown id %q", list, id)
+	}
+	p.warn(id, "the unknown chunk was skipped")
+	_, err := io.CopyN(io.Discard, p.reader, int64(size))
+	return err
+}
+
+// Repairs the sample headers which point outside the wave data in the lenient mode.
+// The compressed samples are not checked, since their positions are not in samples.
+func (p *soundFontParser) repairSampleHeaders(headers []*SampleHeader, sampleCount int32) {
+	if !p.lenient {
+		return
+	}
+
+	for _, header := range headers {
+		if header.SampleType&sampleType_OggVorbis != 0 {
+			continue
+		}
+
+		if header.Start < 0 || header.End > sampleCount || header.Start > header.End {
+			p.warn("shdr", "the sample %q is out of range", header.Name)
+			if header.Start < 0 {
+				header.Start = 0
+			}
+			if header.End > sampleCount {
+				header.End = sampleCount
+			}
+			if header.Start > header.End {
+				header.Start = header.End
+			}
+		}
+
+		if !(header.Start <= header.StartLoop && header.StartLoop < header.EndLoop && header.EndLoop <= header.End) {
+			p.warn("shdr", "the loop of the sample %q is invalid", header.Name)
+			header.StartLoop = header.Start
+			header.EndLoop = header.End
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package meltysynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func writeTestSoundFontBytes(t *testing.T, soundFont *SoundFont) []byte {
+	var buf bytes.Buffer
+	err := soundFont.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Inserts the chunk at the beginning of the list, and returns the offset of the inserted chunk.
+func insertChunk(data []byte, listType string, id string, payload []byte) ([]byte, int64) {
+	position := bytes.Index(data, []byte(listType)) + 4
+
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	binary.Write(&chunk, binary.LittleEndian, int32(len(payload)))
+	chunk.Write(payload)
+	if len(payload)%2 != 0 {
+		chunk.WriteByte(0)
+	}
+
+	result := append([]byte(nil), data[:position]...)
+	result = append(result, chunk.Bytes()...)
+	result = append(result, data[position:]...)
+
+	listSize := binary.LittleEndian.Uint32(result[position-8:])
+	binary.LittleEndian.PutUint32(result[position-8:], listSize+uint32(chunk.Len()))
+	riffSize := binary.LittleEndian.Uint32(result[4:])
+	binary.LittleEndian.PutUint32(result[4:], riffSize+uint32(chunk.Len()))
+
+	return result, int64(position)
+}
+
+func TestSoundFontParser_UnknownChunk(t *testing.T) {
+	expected := createTestSoundFont()
+	data := writeTestSoundFontBytes(t, expected)
+	data, offset := insertChunk(data, "INFO", "XTRA", []byte("vendor"))
+	data, _ = insertChunk(data, "pdta", "xmod", []byte{1, 2, 3})
+
+	_, err := NewSoundFont(bytes.NewReader(data))
+	var sfErr *SoundFontError
+	if !errors.As(err, &sfErr) {
+		t.Fatalf("expected a SoundFontError, but got %v", err)
+	}
+	if sfErr.Chunk != "XTRA" || sfErr.Offset != offset {
+		t.Errorf("expected the XTRA chunk at %d, but got %q at %d", offset, sfErr.Chunk, sfErr.Offset)
+	}
+
+	actual, warnings, err := NewSoundFontLenient(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, but got %v", warnings)
+	}
+	if warnings[0].Chunk != "XTRA" || warnings[0].Offset != offset {
+		t.Errorf("unexpected warning: %v", warnings[0])
+	}
+	if warnings[1].Chunk != "xmod" {
+		t.Errorf("unexpected warning: %v", warnings[1])
+	}
+	checkSameSoundFont(t, expected, actual)
+}
+
+func TestSoundFontParser_Repair(t *testing.T) {
+	soundFont := createTestSoundFont()
+	soundFont.SampleHeaders[0].StartLoop = 95
+	soundFont.SampleHeaders[0].EndLoop = 500
+	data := writeTestSoundFontBytes(t, soundFont)
+
+	// Replace the sample ID of the first instrument region with an invalid one.
+	igen := bytes.Index(data, []byte("igen"))
+	size := int(binary.LittleEndian.Uint32(data[igen+4:]))
+	for i := igen + 8; i < igen+8+size; i += 4 {
+		if binary.LittleEndian.Uint16(data[i:]) == gen_SampleID {
+			binary.LittleEndian.PutUint16(data[i+2:], 999)
+			break
+		}
+	}
+
+	_, err := NewSoundFont(bytes.NewReader(data))
+	var sfErr *SoundFontError
+	if !errors.As(err, &sfErr) {
+		t.Fatalf("expected a SoundFontError, but got %v", err)
+	}
+	if sfErr.Chunk != "igen" || sfErr.Offset != int64(igen) {
+		t.Errorf("expected the igen chunk at %d, but got %q at %d", igen, sfErr.Chunk, sfErr.Offset)
+	}
+
+	actual, warnings, err := NewSoundFontLenient(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, but got %v", warnings)
+	}
+	if len(actual.Instruments[0].Regions) != 1 {
+		t.Errorf("the invalid region was not removed")
+	}
+	sample := actual.SampleHeaders[0]
+	if sample.StartLoop != sample.Start || sample.EndLoop != sample.End {
+		t.Errorf("the loop was not repaired: %d-%d", sample.StartLoop, sample.EndLoop)
+	}
+}
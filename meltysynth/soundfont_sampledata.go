@@ -10,74 +10,110 @@ import (
 type soundFontSampleData struct {
 	bitsPerSample int32
 	samples       []int16
+	samples24     []byte
+
+	// The raw bytes of the smpl sub-chunk, which are needed to decode the compressed samples.
+	// This is only kept for SF3, since the samples are not compressed in SF2.
+	data []byte
 }
 
-func newSoundFontSampleData(r io.Reader) (*soundFontSampleData, error) {
-	var n int
+func newSoundFontSampleData(p *soundFontParser, keepRawData bool) (*soundFontSampleData, error) {
+	r := p.reader
+
+	p.beginChunk("LIST")
 	chunkId, err := readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if chunkId != "LIST" {
-		return nil, errors.New("the list chunk was not found")
+		return nil, p.newError("LIST", errors.New("the list chunk was not found"))
 	}
 
 	var pos int32
 	var end int32
 	err = binary.Read(r, binary.LittleEndian, &end)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 
 	listType, err := readFourCC(r)
 	if err != nil {
-		return nil, err
+		return nil, p.newError("LIST", err)
 	}
 	if listType != "sdta" {
-		return nil, fmt.Errorf(`the type of the list chunk must be "sdta", but was %q`, listType)
+		return nil, p.newError("LIST", fmt.Errorf(`the type of the list chunk must be "sdta", but was %q`, listType))
 	}
 	pos += 4
 
 	result := new(soundFontSampleData)
 
 	for pos < end {
+		position := r.position
+
 		var id string
 		id, err = readFourCC(r)
 		if err != nil {
-			return nil, err
+			return nil, p.newError("LIST", err)
 		}
 		pos += 4
+		p.offsets[id] = position
 
 		var size int32
 		err = binary.Read(r, binary.LittleEndian, &size)
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 		pos += 4
 
 		switch id {
 		case "smpl":
 			result.bitsPerSample = 16
+			data := make([]byte, size)
+			_, err = io.ReadFull(r, data)
 			result.samples = make([]int16, size/2)
-			err = binary.Read(r, binary.LittleEndian, result.samples)
-		case "sm24":
-			// 24 bit audio is not supported.
-			n, err = r.Read(make([]byte, size))
-			if n != int(size) {
-				return nil, errors.New("failed to read the 24 bit audio data")
+			for i := 0; i < len(result.samples); i++ {
+				result.samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+			}
+			if keepRawData {
+				result.data = data
 			}
+		case "sm24":
+			result.samples24 = make([]byte, size)
+			_, err = io.ReadFull(r, result.samples24)
 		default:
-			return nil, fmt.Errorf("the info list contains an unknown id %q", id)
+			err = p.skipUnknownChunk("sdta", id, size)
 		}
 		if err != nil {
-			return nil, err
+			return nil, p.newError(id, err)
 		}
 
 		pos += size
+
+		// The sub-chunks are padded to an even size.
+		// This is only the case for SF3, where the smpl sub-chunk contains Ogg Vorbis data.
+		if size%2 != 0 && pos < end {
+			_, err = io.ReadFull(r, make([]byte, 1))
+			if err != nil {
+				return nil, p.newError(id, err)
+			}
+			pos++
+		}
 	}
 
 	if result.samples == nil {
-		return nil, errors.New("no valid sample data was found")
+		return nil, p.newError("LIST", errors.New("no valid sample data was found"))
+	}
+
+	// The sm24 sub-chunk contains the lower 8 bits of each sample, padded to an even size.
+	// If the size does not match the smpl sub-chunk, it should be ignored.
+	if result.samples24 != nil {
+		if len(result.samples24) == len(result.samples) || len(result.samples24) == len(result.samples)+1 {
+			result.bitsPerSample = 24
+			result.samples24 = result.samples24[0:len(result.samples)]
+		} else {
+			p.warn("sm24", "the sm24 sub-chunk was ignored since its size does not match the smpl sub-chunk")
+			result.samples24 = nil
+		}
 	}
 
 	return result, nil
@@ -0,0 +1,86 @@
+package meltysynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func createSampleDataList(smpl []int16, sm24 []byte) []byte {
+	var body bytes.Buffer
+	body.WriteString("sdta")
+	body.WriteString("smpl")
+	binary.Write(&body, binary.LittleEndian, int32(2*len(smpl)))
+	binary.Write(&body, binary.LittleEndian, smpl)
+	if sm24 != nil {
+		body.WriteString("sm24")
+		binary.Write(&body, binary.LittleEndian, int32(len(sm24)))
+		body.Write(sm24)
+	}
+
+	var list bytes.Buffer
+	list.WriteString("LIST")
+	binary.Write(&list, binary.LittleEndian, int32(body.Len()))
+	list.Write(body.Bytes())
+	return list.Bytes()
+}
+
+func TestSoundFontSampleData_24Bit(t *testing.T) {
+	smpl := []int16{0, 1, -1}
+	sm24 := []byte{0x10, 0x20, 0x30, 0x00}
+
+	data, err := newSoundFontSampleData(newSoundFontParser(bytes.NewReader(createSampleDataList(smpl, sm24)), false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.bitsPerSample != 24 {
+		t.Errorf("expected 24 bits per sample, but got %d", data.bitsPerSample)
+	}
+	if len(data.samples24) != len(smpl) {
+		t.Fatalf("the padding byte of the sm24 sub-chunk was not removed")
+	}
+
+	o := &oscillator{data: data.samples, data24: data.samples24}
+	expected := []int64{0x10, 0x120, -256 + 0x30}
+	for i := 0; i < len(expected); i++ {
+		if o.getSample(int32(i)) != expected[i] {
+			t.Errorf("sample %d: expected %d, but got %d", i, expected[i], o.getSample(int32(i)))
+		}
+	}
+}
+
+func TestSoundFontSampleData_InvalidSm24(t *testing.T) {
+	smpl := []int16{0, 1, -1, 2, -2, 3}
+	sm24 := []byte{0x10, 0x20}
+
+	data, err := newSoundFontSampleData(newSoundFontParser(bytes.NewReader(createSampleDataList(smpl, sm24)), false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.bitsPerSample != 16 {
+		t.Errorf("expected 16 bits per sample, but got %d", data.bitsPerSample)
+	}
+	if data.samples24 != nil {
+		t.Error("the sm24 sub-chunk with the wrong size should be ignored")
+	}
+}
+
+func TestSoundFontSampleData_RawData(t *testing.T) {
+	smpl := []int16{0, 1, -1, 2}
+
+	data, err := newSoundFontSampleData(newSoundFontParser(bytes.NewReader(createSampleDataList(smpl, nil)), false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.data != nil {
+		t.Error("the raw bytes should not be kept for SF2")
+	}
+
+	data, err = newSoundFontSampleData(newSoundFontParser(bytes.NewReader(createSampleDataList(smpl, nil)), false), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data.data, samplesToBytes(smpl)) {
+		t.Error("the raw bytes should be kept for SF3")
+	}
+}
@@ -0,0 +1,141 @@
+package meltysynth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The SoundFonts of the synthesizer are stacked by priority.
+// The preset lookup falls through from the highest priority SoundFont to the lowest one.
+// The voices keep references to their own regions and wave data,
+// so the stack can be changed while the voices are playing.
+
+type presetEntry struct {
+	preset    *Preset
+	soundFont *SoundFont
+}
+
+// Adds the SoundFont with the highest priority.
+func (s *Synthesizer) AddSoundFont(sf *SoundFont) error {
+	if sf == nil {
+		return errors.New("the SoundFont must not be nil")
+	}
+
+	s.soundFonts = append([]*SoundFont{sf}, s.soundFonts...)
+	s.updatePresetLookup()
+
+	return nil
+}
+
+func (s *Synthesizer) RemoveSoundFont(sf *SoundFont) bool {
+	for i := 0; i < len(s.soundFonts); i++ {
+		if s.soundFonts[i] == sf {
+			s.soundFonts = append(s.soundFonts[0:i:i], s.soundFonts[i+1:]...)
+			s.updatePresetLookup()
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the SoundFonts from the highest priority to the lowest.
+func (s *Synthesizer) GetSoundFonts() []*SoundFont {
+	s.syncBaseSoundFont()
+	return append([]*SoundFont(nil), s.soundFonts...)
+}
+
+// Replaces the SoundFonts, which are ordered from the highest priority to the lowest.
+func (s *Synthesizer) SetSoundFonts(soundFonts []*SoundFont) error {
+	for i, sf := range soundFonts {
+		if sf == nil {
+			return fmt.Errorf("the SoundFont at %d must not be nil", i)
+		}
+	}
+
+	s.soundFonts = append([]*SoundFont(nil), soundFonts...)
+	s.updatePresetLookup()
+
+	return nil
+}
+
+// The SoundFont assigned to the SoundFont field directly replaces the base one, as SetSoundFont does.
+// This is checked at the note-on, so the voices of the old SoundFont are played until the end.
+func (s *Synthesizer) syncBaseSoundFont() {
+	if s.SoundFont == nil {
+		return
+	}
+	if len(s.soundFonts) == 0 || s.soundFonts[len(s.soundFonts)-1] != s.SoundFont {
+		s.SetSoundFont(s.SoundFont, false)
+	}
+}
+
+func (s *Synthesizer) updatePresetLookup() {
+	s.presetLookup = make(map[int32]presetEntry)
+	s.defaultPreset = presetEntry{}
+
+	// The SoundFont field is kept as the base one, which has the lowest priority.
+	s.SoundFont = nil
+	if len(s.soundFonts) > 0 {
+		s.SoundFont = s.soundFonts[len(s.soundFonts)-1]
+	}
+
+	minPresetId := int32(math.MaxInt32)
+	for i := len(s.soundFonts) - 1; i >= 0; i-- {
+		sf := s.soundFonts[i]
+
+		var defaultPreset *Preset
+		minSoundFontPresetId := int32(math.MaxInt32)
+		for j := 0; j < len(sf.Presets); j++ {
+			preset := sf.Presets[j]
+			// The preset ID is Int32, where the upper 16 bits represent the bank number
+			// and the lower 16 bits represent the patch number.
+			// This ID is used to search for presets by the combination of bank number
+			// and patch number.
+			presetId := (preset.BankNumber << 16) | preset.PatchNumber
+			s.presetLookup[presetId] = presetEntry{preset, sf}
+
+			// The preset with the minimum ID number will be default.
+			// If the SoundFont is GM compatible, the piano will be chosen.
+			if presetId < minSoundFontPresetId {
+				defaultPreset = preset
+				minSoundFontPresetId = presetId
+			}
+		}
+
+		// If the IDs are the same, the higher priority SoundFont is used.
+		if defaultPreset != nil && minSoundFontPresetId <= minPresetId {
+			s.defaultPreset = presetEntry{defaultPreset, sf}
+			minPresetId = minSoundFontPresetId
+		}
+	}
+}
+
+// Replaces the base SoundFont, which has the lowest priority.
+// The new SoundFont is used for the subsequent note-ons.
+// If fadeOut is true, the voices of the old SoundFont are faded out quickly.
+// Otherwise, they are played until the end.
+func (s *Synthesizer) SetSoundFont(sf *SoundFont, fadeOut bool) error {
+	if sf == nil {
+		return errors.New("the SoundFont must not be nil")
+	}
+
+	old := s.SoundFont
+	if len(s.soundFonts) > 0 {
+		s.soundFonts[len(s.soundFonts)-1] = sf
+	} else {
+		s.soundFonts = append(s.soundFonts, sf)
+	}
+	s.updatePresetLookup()
+
+	if fadeOut && old != nil && old != sf {
+		for i := 0; i < int(s.voices.activeVoiceCount); i++ {
+			voice := s.voices.voices[i]
+			if voice.soundFont == old {
+				voice.fadeOut()
+			}
+		}
+	}
+
+	return nil
+}
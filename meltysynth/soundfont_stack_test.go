@@ -0,0 +1,184 @@
+package meltysynth
+
+import "testing"
+
+func createStackTestSoundFont(t testing.TB, name string, ids ...int32) *SoundFont {
+	builder := NewSoundFontBuilder(name)
+	sample := builder.AddSampleFloat32(name, createSineWave(1000, 100), 44100, 60)
+	instrument := builder.AddInstrument(name)
+	region := instrument.AddRegion(sample)
+	region.SetGenerator(GeneratorSampleModes, int16(loop_Continuous))
+	for _, id := range ids {
+		preset := builder.AddPreset(name, id&0xFFFF, id>>16)
+		preset.AddRegion(instrument)
+	}
+	soundFont, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return soundFont
+}
+
+func checkPresetSource(t *testing.T, synthesizer *Synthesizer, presetId int32, expected *SoundFont) {
+	entry, found := synthesizer.presetLookup[presetId]
+	if !found {
+		t.Fatalf("the preset %d was not found", presetId)
+	}
+	if entry.soundFont != expected {
+		t.Errorf("the preset %d should come from %q, but came from %q", presetId, expected.Info.BankName, entry.soundFont.Info.BankName)
+	}
+}
+
+func TestSoundFontStack(t *testing.T) {
+	base := createStackTestSoundFont(t, "base", 0, 1, 128<<16)
+	drums := createStackTestSoundFont(t, "drums", 128<<16, 129<<16)
+	piano := createStackTestSoundFont(t, "piano", 0)
+
+	synthesizer, err := NewSynthesizer(base, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	synthesizer.AddSoundFont(drums)
+	synthesizer.AddSoundFont(piano)
+	if synthesizer.SoundFont != base {
+		t.Error("the base SoundFont should not be changed")
+	}
+	checkPresetSource(t, synthesizer, 0, piano)
+	checkPresetSource(t, synthesizer, 1, base)
+	checkPresetSource(t, synthesizer, 128<<16, drums)
+	checkPresetSource(t, synthesizer, 129<<16, drums)
+	if synthesizer.defaultPreset.soundFont != piano {
+		t.Error("the default preset should come from the highest priority SoundFont")
+	}
+
+	// The voices started before the change keep playing.
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.NoteOn(9, 36, 100)
+	if synthesizer.voices.activeVoiceCount != 2 {
+		t.Fatalf("expected 2 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+
+	if !synthesizer.RemoveSoundFont(piano) {
+		t.Error("the SoundFont should be removed")
+	}
+	if synthesizer.RemoveSoundFont(piano) {
+		t.Error("the SoundFont should already be removed")
+	}
+	checkPresetSource(t, synthesizer, 0, base)
+	if synthesizer.voices.activeVoiceCount != 2 {
+		t.Fatalf("expected 2 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+
+	left := make([]float32, 256)
+	right := make([]float32, 256)
+	synthesizer.Render(left, right)
+
+	synthesizer.SetSoundFonts([]*SoundFont{base, drums})
+	checkPresetSource(t, synthesizer, 128<<16, base)
+	checkPresetSource(t, synthesizer, 129<<16, drums)
+	if synthesizer.SoundFont != drums {
+		t.Error("the base SoundFont should be the lowest priority one")
+	}
+
+	soundFonts := synthesizer.GetSoundFonts()
+	if len(soundFonts) != 2 || soundFonts[0] != base || soundFonts[1] != drums {
+		t.Error("the SoundFonts are not in the expected order")
+	}
+
+	synthesizer.SetSoundFonts(nil)
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.Render(left, right)
+}
+
+func TestSoundFontStack_Nil(t *testing.T) {
+	base := createStackTestSoundFont(t, "base", 0)
+
+	synthesizer, err := NewSynthesizer(base, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if synthesizer.AddSoundFont(nil) == nil {
+		t.Error("the nil SoundFont was accepted")
+	}
+	if synthesizer.SetSoundFonts([]*SoundFont{base, nil}) == nil {
+		t.Error("the nil SoundFont in the list was accepted")
+	}
+
+	// The stack is not changed by the rejected calls.
+	soundFonts := synthesizer.GetSoundFonts()
+	if len(soundFonts) != 1 || soundFonts[0] != base {
+		t.Error("the SoundFonts were changed by the rejected calls")
+	}
+	checkPresetSource(t, synthesizer, 0, base)
+}
+
+func TestSynthesizer_SetSoundFont(t *testing.T) {
+	oldSoundFont := createStackTestSoundFont(t, "old", 0)
+	newSoundFont := createStackTestSoundFont(t, "new", 0)
+
+	synthesizer, err := NewSynthesizer(oldSoundFont, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	left := make([]float32, 4410)
+	right := make([]float32, 4410)
+
+	// The voices of the old SoundFont are played until the end.
+	synthesizer.NoteOn(0, 60, 100)
+	synthesizer.SetSoundFont(newSoundFont, false)
+	if synthesizer.SoundFont != newSoundFont {
+		t.Error("the SoundFont was not replaced")
+	}
+	checkPresetSource(t, synthesizer, 0, newSoundFont)
+	synthesizer.NoteOn(0, 64, 100)
+	synthesizer.Render(left, right)
+	if synthesizer.voices.activeVoiceCount != 2 {
+		t.Fatalf("expected 2 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+
+	if synthesizer.SetSoundFont(nil, true) == nil {
+		t.Error("the nil SoundFont was accepted")
+	}
+	if synthesizer.SoundFont != newSoundFont {
+		t.Error("the SoundFont was changed by the rejected call")
+	}
+
+	// The voices of the old SoundFont are faded out.
+	synthesizer.SetSoundFont(oldSoundFont, true)
+	synthesizer.NoteOn(0, 67, 100)
+	synthesizer.Render(left, right)
+	if synthesizer.voices.activeVoiceCount != 2 {
+		t.Fatalf("expected 2 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+	for i := 0; i < int(synthesizer.voices.activeVoiceCount); i++ {
+		if synthesizer.voices.voices[i].soundFont != oldSoundFont {
+			t.Error("the voice of the replaced SoundFont should be faded out")
+		}
+	}
+}
+
+func TestSynthesizer_SoundFontField(t *testing.T) {
+	oldSoundFont := createStackTestSoundFont(t, "old", 0)
+	newSoundFont := createStackTestSoundFont(t, "new", 0)
+	layer := createStackTestSoundFont(t, "layer", 1)
+	synthesizer, err := NewSynthesizer(oldSoundFont, NewSynthesizerSettings(44100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.AddSoundFont(layer)
+
+	// The SoundFont assigned directly is used for the next note-on.
+	synthesizer.SoundFont = newSoundFont
+	synthesizer.NoteOn(0, 60, 100)
+	voice := findActiveVoice(synthesizer, 0, 60)
+	if voice == nil || voice.soundFont != newSoundFont {
+		t.Fatal("the note should be played with the assigned SoundFont")
+	}
+	soundFonts := synthesizer.GetSoundFonts()
+	if len(soundFonts) != 2 || soundFonts[0] != layer || soundFonts[1] != newSoundFont {
+		t.Error("the assigned SoundFont should replace the base one")
+	}
+}
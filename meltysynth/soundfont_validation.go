@@ -0,0 +1,268 @@
+package meltysynth
+
+import (
+	"fmt"
+	"strings"
+)
+
+type FindingKind string
+
+const (
+	FindingEmptyPreset           FindingKind = "empty-preset"
+	FindingEmptyInstrument       FindingKind = "empty-instrument"
+	FindingEmptyRegion           FindingKind = "empty-region"
+	FindingOverlappingRegions    FindingKind = "overlapping-regions"
+	FindingSampleOutOfRange      FindingKind = "sample-out-of-range"
+	FindingLoopOutOfRange        FindingKind = "loop-out-of-range"
+	FindingSampleRate            FindingKind = "sample-rate"
+	FindingMissingGMPreset       FindingKind = "missing-gm-preset"
+	FindingUnreachableInstrument FindingKind = "unreachable-instrument"
+	FindingOrphanedSample        FindingKind = "orphaned-sample"
+	FindingMissingSample         FindingKind = "missing-sample"
+)
+
+type FindingSeverity int32
+
+const (
+	SeverityInfo FindingSeverity = iota
+	SeverityWarning
+	SeverityError // The SoundFont will not be played correctly.
+)
+
+func (severity FindingSeverity) String() string {
+	switch severity {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int32(severity))
+	}
+}
+
+// The problem found by the validation.
+// The preset, instrument and sample are set if the problem is related to them.
+type ValidationFinding struct {
+	Kind       FindingKind
+	Severity   FindingSeverity
+	Preset     *Preset
+	Instrument *Instrument
+	Sample     *SampleHeader
+	Message    string
+}
+
+func (finding ValidationFinding) String() string {
+	return fmt.Sprintf("%v: %s: %s", finding.Severity, finding.Kind, finding.Message)
+}
+
+type soundFontValidator struct {
+	soundFont *SoundFont
+	findings  []ValidationFinding
+}
+
+// Checks the SoundFont for the problems which make it sound wrong or indicate a broken file.
+// The findings are ordered by the presets, instruments and samples.
+func (soundFont *SoundFont) Validate() []ValidationFinding {
+	validator := &soundFontValidator{soundFont: soundFont}
+	validator.checkPresets()
+	validator.checkGMPresets()
+	validator.checkInstruments()
+	validator.checkSamples()
+	return validator.findings
+}
+
+func (validator *soundFontValidator) add(finding ValidationFinding, format string, a ...interface{}) {
+	finding.Message = fmt.Sprintf(format, a...)
+	validator.findings = append(validator.findings, finding)
+}
+
+func (validator *soundFontValidator) checkPresets() {
+	for _, preset := range validator.soundFont.Presets {
+		if len(preset.Regions) == 0 {
+			validator.add(ValidationFinding{Kind: FindingEmptyPreset, Severity: SeverityWarning, Preset: preset},
+				"the preset %q has no region", preset.Name)
+			continue
+		}
+
+		for i, region := range preset.Regions {
+			if region.GetKeyRangeStart() > region.GetKeyRangeEnd() || region.GetVelocityRangeStart() > region.GetVelocityRangeEnd() {
+				validator.add(ValidationFinding{Kind: FindingEmptyRegion, Severity: SeverityWarning, Preset: preset},
+					"the region %d of the preset %q has an empty key or velocity range", i, preset.Name)
+			}
+
+			for j := 0; j < i; j++ {
+				other := preset.Regions[j]
+				if other.Instrument != region.Instrument {
+					// Different instruments are often layered intentionally.
+					continue
+				}
+				if rangesOverlap(region.gs[gen_KeyRange], other.gs[gen_KeyRange]) && rangesOverlap(region.gs[gen_VelocityRange], other.gs[gen_VelocityRange]) {
+					validator.add(ValidationFinding{Kind: FindingOverlappingRegions, Severity: SeverityWarning, Preset: preset},
+						"the regions %d and %d of the preset %q overlap", j, i, preset.Name)
+				}
+			}
+		}
+	}
+}
+
+// Reports the GM melodic presets which are missing in the bank 0, and the missing standard drum kit.
+// They are reported as a single finding, since most of them are missing in the SoundFonts which are not for GM.
+func (validator *soundFontValidator) checkGMPresets() {
+	found := make(map[int32]bool)
+	for _, preset := range validator.soundFont.Presets {
+		found[(preset.BankNumber<<16)|preset.PatchNumber] = true
+	}
+
+	// The consecutive patches are shown as a range.
+	var missing []string
+	for patch := int32(0); patch < 128; patch++ {
+		if found[patch] {
+			continue
+		}
+		start := patch
+		for patch+1 < 128 && !found[patch+1] {
+			patch++
+		}
+		if start == patch {
+			missing = append(missing, fmt.Sprint(start))
+		} else {
+			missing = append(missing, fmt.Sprintf("%d-%d", start, patch))
+		}
+	}
+	if !found[128<<16] {
+		missing = append(missing, "the drum kit (bank 128, patch 0)")
+	}
+
+	if len(missing) > 0 {
+		validator.add(ValidationFinding{Kind: FindingMissingGMPreset, Severity: SeverityInfo},
+			"the GM presets are missing: %s", strings.Join(missing, ", "))
+	}
+}
+
+func (validator *soundFontValidator) checkInstruments() {
+	used := make(map[*Instrument]bool)
+	for _, preset := range validator.soundFont.Presets {
+		for _, region := range preset.Regions {
+			used[region.Instrument] = true
+		}
+	}
+
+	for _, instrument := range validator.soundFont.Instruments {
+		if !used[instrument] {
+			validator.add(ValidationFinding{Kind: FindingUnreachableInstrument, Severity: SeverityWarning, Instrument: instrument},
+				"the instrument %q is not used by any preset", instrument.Name)
+		}
+
+		if len(instrument.Regions) == 0 {
+			validator.add(ValidationFinding{Kind: FindingEmptyInstrument, Severity: SeverityWarning, Instrument: instrument},
+				"the instrument %q has no region", instrument.Name)
+			continue
+		}
+
+		for i, region := range instrument.Regions {
+			if region.Sample == nil {
+				validator.add(ValidationFinding{Kind: FindingMissingSample, Severity: SeverityError, Instrument: instrument},
+					"the region %d of the instrument %q has no sample", i, instrument.Name)
+				continue
+			}
+
+			if region.GetKeyRangeStart() > region.GetKeyRangeEnd() || region.GetVelocityRangeStart() > region.GetVelocityRangeEnd() ||
+				region.Sample.Start >= region.Sample.End {
+				validator.add(ValidationFinding{Kind: FindingEmptyRegion, Severity: SeverityWarning, Instrument: instrument, Sample: region.Sample},
+					"the region %d of the instrument %q has an empty key range, velocity range or sample", i, instrument.Name)
+			}
+
+			// The partially overlapping regions are often used for the crossfades and layers,
+			// so only the regions with the same ranges are reported.
+			for j := 0; j < i; j++ {
+				other := instrument.Regions[j]
+				if other.Sample == nil || isStereoPair(validator.soundFont.SampleHeaders, region.Sample, other.Sample) {
+					continue
+				}
+				if region.gs[gen_KeyRange] == other.gs[gen_KeyRange] && region.gs[gen_VelocityRange] == other.gs[gen_VelocityRange] {
+					validator.add(ValidationFinding{Kind: FindingOverlappingRegions, Severity: SeverityWarning, Instrument: instrument},
+						"the regions %d and %d of the instrument %q have the same key and velocity ranges", j, i, instrument.Name)
+				}
+			}
+		}
+	}
+}
+
+func (validator *soundFontValidator) checkSamples() {
+	soundFont := validator.soundFont
+	sampleCount, _ := soundFont.getSampleCount()
+
+	used := make(map[*SampleHeader]bool)
+	looped := make(map[*SampleHeader]bool)
+	for _, instrument := range soundFont.Instruments {
+		for _, region := range instrument.Regions {
+			if region.Sample == nil {
+				continue
+			}
+
+			used[region.Sample] = true
+			if region.GetSampleModes() != loop_NoLoop {
+				looped[region.Sample] = true
+			}
+
+			// The linked sample is played together with the used one.
+			link := int(region.Sample.Link)
+			if region.Sample.SampleType&(sampleType_Left|sampleType_Right|sampleType_Linked) != 0 && link < len(soundFont.SampleHeaders) {
+				used[soundFont.SampleHeaders[link]] = true
+			}
+		}
+	}
+
+	for _, sample := range soundFont.SampleHeaders {
+		if !used[sample] {
+			validator.add(ValidationFinding{Kind: FindingOrphanedSample, Severity: SeverityInfo, Sample: sample},
+				"the sample %q is not used by any instrument", sample.Name)
+		}
+
+		// The ROM samples do not refer to the wave data.
+		if sample.SampleType&sampleType_Rom != 0 {
+			continue
+		}
+
+		if sample.Start < 0 || sample.End > sampleCount || sample.Start > sample.End {
+			validator.add(ValidationFinding{Kind: FindingSampleOutOfRange, Severity: SeverityError, Sample: sample},
+				"the sample %q (%d-%d) is out of the wave data (%d samples)", sample.Name, sample.Start, sample.End, sampleCount)
+		}
+
+		if !(sample.Start <= sample.StartLoop && sample.StartLoop < sample.EndLoop && sample.EndLoop <= sample.End) {
+			// The loop points do not matter unless the sample is looped.
+			severity := SeverityInfo
+			if looped[sample] {
+				severity = SeverityError
+			}
+			validator.add(ValidationFinding{Kind: FindingLoopOutOfRange, Severity: severity, Sample: sample},
+				"the loop of the sample %q (%d-%d) is outside the sample (%d-%d)", sample.Name, sample.StartLoop, sample.EndLoop, sample.Start, sample.End)
+		}
+
+		if sample.SampleRate <= 0 {
+			validator.add(ValidationFinding{Kind: FindingSampleRate, Severity: SeverityError, Sample: sample},
+				"the sample %q has an invalid sample rate %d", sample.Name, sample.SampleRate)
+		} else if sample.SampleRate < 8000 || sample.SampleRate > 192000 {
+			validator.add(ValidationFinding{Kind: FindingSampleRate, Severity: SeverityWarning, Sample: sample},
+				"the sample %q has an unusual sample rate %d", sample.Name, sample.SampleRate)
+		}
+	}
+}
+
+func rangesOverlap(x int16, y int16) bool {
+	xStart, xEnd := int32(x)&0xFF, (int32(x)>>8)&0xFF
+	yStart, yEnd := int32(y)&0xFF, (int32(y)>>8)&0xFF
+	return xStart <= yEnd && yStart <= xEnd
+}
+
+// The samples are the left and right halves which refer to each other by the links.
+func isStereoPair(samples []*SampleHeader, x *SampleHeader, y *SampleHeader) bool {
+	if !((x.SampleType&sampleType_Left != 0 && y.SampleType&sampleType_Right != 0) ||
+		(x.SampleType&sampleType_Right != 0 && y.SampleType&sampleType_Left != 0)) {
+		return false
+	}
+	return int(x.Link) < len(samples) && samples[x.Link] == y &&
+		int(y.Link) < len(samples) && samples[y.Link] == x
+}
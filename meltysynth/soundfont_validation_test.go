@@ -0,0 +1,91 @@
+package meltysynth
+
+import "testing"
+
+func countFindings(findings []ValidationFinding, kind FindingKind, severity FindingSeverity) int {
+	count := 0
+	for _, finding := range findings {
+		if finding.Kind == kind && finding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSoundFontValidation(t *testing.T) {
+	soundFont := createTestSoundFont()
+
+	findings := soundFont.Validate()
+	if countFindings(findings, FindingEmptyPreset, SeverityWarning) != 1 {
+		t.Errorf("the empty preset was not found: %v", findings)
+	}
+	if countFindings(findings, FindingMissingGMPreset, SeverityInfo) != 1 {
+		t.Errorf("the missing GM presets should be reported as a single finding")
+	}
+	for _, finding := range findings {
+		if finding.Kind == FindingMissingGMPreset && finding.Message != "the GM presets are missing: 0-4, 6-127" {
+			t.Errorf("unexpected message: %s", finding.Message)
+		}
+	}
+	for _, finding := range findings {
+		if finding.Kind != FindingEmptyPreset && finding.Kind != FindingMissingGMPreset {
+			t.Errorf("unexpected finding: %v", finding)
+		}
+	}
+
+	sample := soundFont.SampleHeaders[0]
+	sample.EndLoop = 120
+	sample.SampleRate = 0
+
+	orphan := &SampleHeader{Name: "orphan", Start: 0, End: 200, StartLoop: 0, EndLoop: 10, SampleRate: 44100, SampleType: sampleType_Mono}
+	soundFont.SampleHeaders = append(soundFont.SampleHeaders, orphan)
+
+	instrument := soundFont.Instruments[0]
+	overlapping := NewInstrumentRegion(sample)
+	overlapping.SetKeyRange(0, 60)
+	instrument.Regions = append(instrument.Regions, overlapping)
+
+	// The partial overlap is not reported.
+	crossfade := NewInstrumentRegion(sample)
+	crossfade.SetKeyRange(60, 70)
+	instrument.Regions = append(instrument.Regions, crossfade)
+
+	instrument.Regions = append(instrument.Regions, NewInstrumentRegion(nil))
+
+	unused := &Instrument{Name: "unused", Regions: []*InstrumentRegion{NewInstrumentRegion(sample)}}
+	soundFont.Instruments = append(soundFont.Instruments, unused)
+
+	findings = soundFont.Validate()
+	expected := []struct {
+		kind     FindingKind
+		severity FindingSeverity
+		count    int
+	}{
+		{FindingOverlappingRegions, SeverityWarning, 1},
+		{FindingMissingSample, SeverityError, 1},
+		{FindingUnreachableInstrument, SeverityWarning, 1},
+		{FindingOrphanedSample, SeverityInfo, 1},
+		{FindingSampleOutOfRange, SeverityError, 1},
+		{FindingLoopOutOfRange, SeverityError, 1},
+		{FindingSampleRate, SeverityError, 1},
+	}
+	for _, e := range expected {
+		count := countFindings(findings, e.kind, e.severity)
+		if count != e.count {
+			t.Errorf("expected %d findings of %s (%v), but got %d", e.count, e.kind, e.severity, count)
+		}
+	}
+}
+
+func TestSoundFontValidation_StereoPair(t *testing.T) {
+	soundFont := createStereoTestSoundFont(t, true)
+	if countFindings(soundFont.Validate(), FindingOverlappingRegions, SeverityWarning) != 0 {
+		t.Error("the halves of the stereo pair should not be reported")
+	}
+
+	// The samples of the left and right types which are not linked to each other are not a pair.
+	soundFont.SampleHeaders[1].Link = 1
+	if countFindings(soundFont.Validate(), FindingOverlappingRegions, SeverityWarning) != 1 {
+		t.Error("the samples which are not linked should be reported")
+	}
+}
@@ -0,0 +1,410 @@
+package meltysynth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The zones are written without the global zone,
+// since the generators and modulators of the regions already include the global ones.
+
+func (soundFont *SoundFont) Write(w io.Writer) error {
+	var err error
+
+	var info bytes.Buffer
+	err = writeSoundFontInfo(&info, soundFont.Info)
+	if err != nil {
+		return err
+	}
+
+	var parameters bytes.Buffer
+	err = writeSoundFontParameters(&parameters, soundFont)
+	if err != nil {
+		return err
+	}
+
+	sampleDataSize := soundFont.getSampleDataSize()
+
+	size := 4 + (8 + int64(info.Len())) + (8 + sampleDataSize) + (8 + int64(parameters.Len()))
+	if size > math.MaxInt32 {
+		return errors.New("the SoundFont is too large")
+	}
+
+	err = writeChunkHeader(w, "RIFF", int32(size))
+	if err != nil {
+		return err
+	}
+	err = writeFourCC(w, "sfbk")
+	if err != nil {
+		return err
+	}
+
+	err = writeChunkHeader(w, "LIST", int32(info.Len()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(info.Bytes())
+	if err != nil {
+		return err
+	}
+
+	err = writeChunkHeader(w, "LIST", int32(sampleDataSize))
+	if err != nil {
+		return err
+	}
+	err = soundFont.writeSampleData(w)
+	if err != nil {
+		return err
+	}
+
+	err = writeChunkHeader(w, "LIST", int32(parameters.Len()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(parameters.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeSoundFontInfo(w io.Writer, info *SoundFontInfo) error {
+	if info == nil {
+		info = new(SoundFontInfo)
+	}
+
+	err := writeFourCC(w, "INFO")
+	if err != nil {
+		return err
+	}
+
+	// The samples are always written uncompressed, so the version of SF3 must not be kept.
+	version := info.Version
+	if version.Major != 2 {
+		version = SoundFontVersion{Major: 2, Minor: 1}
+	}
+	err = writeChunkHeader(w, "ifil", 4)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, version)
+	if err != nil {
+		return err
+	}
+
+	// The isng and INAM sub-chunks are mandatory.
+	targetSoundEngine := info.TargetSoundEngine
+	if targetSoundEngine == "" {
+		targetSoundEngine = "EMU8000"
+	}
+	err = writeStringChunk(w, "isng", targetSoundEngine)
+	if err != nil {
+		return err
+	}
+	err = writeStringChunk(w, "INAM", info.BankName)
+	if err != nil {
+		return err
+	}
+
+	if info.RomName != "" {
+		err = writeStringChunk(w, "irom", info.RomName)
+		if err != nil {
+			return err
+		}
+		err = writeChunkHeader(w, "iver", 4)
+		if err != nil {
+			return err
+		}
+		err = binary.Write(w, binary.LittleEndian, info.RomVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	optionals := []struct {
+		id    string
+		value string
+	}{
+		{"ICRD", info.CreationDate},
+		{"IENG", info.Auther},
+		{"IPRD", info.TargetProduct},
+		{"ICOP", info.Copyright},
+		{"ICMT", info.Comments},
+		{"ISFT", info.Tools},
+	}
+	for _, optional := range optionals {
+		if optional.value == "" {
+			continue
+		}
+		err = writeStringChunk(w, optional.id, optional.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (soundFont *SoundFont) getSampleCount() (int32, bool) {
+	if soundFont.lazyData != nil {
+		return soundFont.lazyData.count, soundFont.lazyData.has24
+	}
+	return int32(len(soundFont.WaveData)), soundFont.WaveData24 != nil
+}
+
+func (soundFont *SoundFont) getSampleDataSize() int64 {
+	count, has24 := soundFont.getSampleCount()
+	size := 4 + 8 + 2*int64(count)
+	if has24 {
+		size += 8 + int64(count) + int64(count%2)
+	}
+	return size
+}
+
+func (soundFont *SoundFont) writeSampleData(w io.Writer) error {
+	count, has24 := soundFont.getSampleCount()
+
+	err := writeFourCC(w, "sdta")
+	if err != nil {
+		return err
+	}
+
+	err = writeChunkHeader(w, "smpl", 2*count)
+	if err != nil {
+		return err
+	}
+	if soundFont.lazyData != nil {
+		err = soundFont.lazyData.writeTo(w, false)
+	} else {
+		err = binary.Write(w, binary.LittleEndian, soundFont.WaveData)
+	}
+	if err != nil {
+		return err
+	}
+
+	if has24 {
+		// The sm24 sub-chunk is padded to an even size.
+		err = writeChunkHeader(w, "sm24", count+count%2)
+		if err != nil {
+			return err
+		}
+		if soundFont.lazyData != nil {
+			err = soundFont.lazyData.writeTo(w, true)
+		} else {
+			_, err = w.Write(soundFont.WaveData24)
+		}
+		if err != nil {
+			return err
+		}
+		if count%2 != 0 {
+			_, err = w.Write([]byte{0})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeSoundFontParameters(w io.Writer, soundFont *SoundFont) error {
+	sampleIds := make(map[*SampleHeader]int, len(soundFont.SampleHeaders))
+	for i, sample := range soundFont.SampleHeaders {
+		sampleIds[sample] = i
+	}
+
+	instrumentIds := make(map[*Instrument]int, len(soundFont.Instruments))
+	for i, instrument := range soundFont.Instruments {
+		instrumentIds[instrument] = i
+	}
+
+	var presetDefaults [61]int16
+	setDefaultPresetGenerators(&presetDefaults)
+	var presetList zoneListWriter
+	var phdr bytes.Buffer
+	for _, preset := range soundFont.Presets {
+		writeFixedLengthString(&phdr, preset.Name, 20)
+		binary.Write(&phdr, binary.LittleEndian, uint16(preset.PatchNumber))
+		binary.Write(&phdr, binary.LittleEndian, uint16(preset.BankNumber))
+		binary.Write(&phdr, binary.LittleEndian, uint16(len(presetList.zones)))
+		binary.Write(&phdr, binary.LittleEndian, preset.Library)
+		binary.Write(&phdr, binary.LittleEndian, preset.Genre)
+		binary.Write(&phdr, binary.LittleEndian, preset.Morphology)
+
+		// A preset without regions is written as a single empty global zone.
+		if len(preset.Regions) == 0 {
+			presetList.addZone(nil, nil)
+		}
+
+		for _, region := range preset.Regions {
+			id, found := instrumentIds[region.Instrument]
+			if !found {
+				return fmt.Errorf("the preset %q refers to an instrument not in the SoundFont", preset.Name)
+			}
+			generators := createZoneGenerators(&region.gs, &presetDefaults, gen_Instrument, uint16(id))
+			presetList.addZone(generators, region.Modulators)
+		}
+	}
+	writeFixedLengthString(&phdr, "EOP", 20)
+	binary.Write(&phdr, binary.LittleEndian, [3]uint16{0, 0, uint16(len(presetList.zones))})
+	binary.Write(&phdr, binary.LittleEndian, [3]int32{})
+
+	var instrumentDefaults [61]int16
+	setDefaultInstrumentGenerators(&instrumentDefaults)
+	var instrumentList zoneListWriter
+	var inst bytes.Buffer
+	for _, instrument := range soundFont.Instruments {
+		writeFixedLengthString(&inst, instrument.Name, 20)
+		binary.Write(&inst, binary.LittleEndian, uint16(len(instrumentList.zones)))
+
+		// An instrument without regions is written as a single empty global zone.
+		if len(instrument.Regions) == 0 {
+			instrumentList.addZone(nil, nil)
+		}
+
+		for _, region := range instrument.Regions {
+			id, found := sampleIds[region.Sample]
+			if !found {
+				return fmt.Errorf("the instrument %q refers to a sample not in the SoundFont", instrument.Name)
+			}
+			generators := createZoneGenerators(&region.gs, &instrumentDefaults, gen_SampleID, uint16(id))
+			instrumentList.addZone(generators, region.Modulators)
+		}
+	}
+	writeFixedLengthString(&inst, "EOI", 20)
+	binary.Write(&inst, binary.LittleEndian, uint16(len(instrumentList.zones)))
+
+	var shdr bytes.Buffer
+	for _, sample := range soundFont.SampleHeaders {
+		writeFixedLengthString(&shdr, sample.Name, 20)
+		binary.Write(&shdr, binary.LittleEndian, sample.Start)
+		binary.Write(&shdr, binary.LittleEndian, sample.End)
+		binary.Write(&shdr, binary.LittleEndian, sample.StartLoop)
+		binary.Write(&shdr, binary.LittleEndian, sample.EndLoop)
+		binary.Write(&shdr, binary.LittleEndian, sample.SampleRate)
+		binary.Write(&shdr, binary.LittleEndian, sample.OriginalPitch)
+		binary.Write(&shdr, binary.LittleEndian, sample.PitchCorrection)
+		binary.Write(&shdr, binary.LittleEndian, sample.Link)
+		binary.Write(&shdr, binary.LittleEndian, sample.SampleType)
+	}
+	writeFixedLengthString(&shdr, "EOS", 46)
+
+	if !presetList.isValid() || !instrumentList.isValid() {
+		return errors.New("the SoundFont has too many zones, generators or modulators")
+	}
+
+	err := writeFourCC(w, "pdta")
+	if err != nil {
+		return err
+	}
+
+	chunks := []struct {
+		id   string
+		data []byte
+	}{
+		{"phdr", phdr.Bytes()},
+		{"pbag", presetList.bag()},
+		{"pmod", presetList.mod()},
+		{"pgen", presetList.gen()},
+		{"inst", inst.Bytes()},
+		{"ibag", instrumentList.bag()},
+		{"imod", instrumentList.mod()},
+		{"igen", instrumentList.gen()},
+		{"shdr", shdr.Bytes()},
+	}
+	for _, chunk := range chunks {
+		err = writeChunkHeader(w, chunk.id, int32(len(chunk.data)))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(chunk.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates the generator list of the zone in the order required by the SoundFont spec.
+// The key range comes first, the velocity range second, and the instrument or sample ID last.
+func createZoneGenerators(gs *[61]int16, defaults *[61]int16, lastType uint16, lastValue uint16) []generator {
+	var generators []generator
+
+	if gs[gen_KeyRange] != defaults[gen_KeyRange] {
+		generators = append(generators, generator{gen_KeyRange, uint16(gs[gen_KeyRange])})
+	}
+	if gs[gen_VelocityRange] != defaults[gen_VelocityRange] {
+		generators = append(generators, generator{gen_VelocityRange, uint16(gs[gen_VelocityRange])})
+	}
+
+	for i := 0; i < len(gs); i++ {
+		t := uint16(i)
+		switch t {
+		case gen_KeyRange, gen_VelocityRange, gen_Instrument, gen_SampleID:
+			continue
+		}
+		if gs[i] != defaults[i] {
+			generators = append(generators, generator{t, uint16(gs[i])})
+		}
+	}
+
+	generators = append(generators, generator{lastType, lastValue})
+
+	return generators
+}
+
+type zoneListWriter struct {
+	zones      []zoneInfo
+	generators []generator
+	modulators []Modulator
+}
+
+func (list *zoneListWriter) addZone(generators []generator, modulators []Modulator) {
+	list.zones = append(list.zones, zoneInfo{
+		generatorIndex: int32(len(list.generators)),
+		modulatorIndex: int32(len(list.modulators)),
+	})
+	list.generators = append(list.generators, generators...)
+	list.modulators = append(list.modulators, modulators...)
+}
+
+// The indices are stored as 16-bit values.
+func (list *zoneListWriter) isValid() bool {
+	return len(list.zones) <= math.MaxUint16 &&
+		len(list.generators) <= math.MaxUint16 &&
+		len(list.modulators) <= math.MaxUint16
+}
+
+func (list *zoneListWriter) bag() []byte {
+	var buf bytes.Buffer
+	for _, zone := range list.zones {
+		binary.Write(&buf, binary.LittleEndian, uint16(zone.generatorIndex))
+		binary.Write(&buf, binary.LittleEndian, uint16(zone.modulatorIndex))
+	}
+	binary.Write(&buf, binary.LittleEndian, uint16(len(list.generators)))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(list.modulators)))
+	return buf.Bytes()
+}
+
+func (list *zoneListWriter) mod() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, list.modulators)
+	binary.Write(&buf, binary.LittleEndian, Modulator{})
+	return buf.Bytes()
+}
+
+func (list *zoneListWriter) gen() []byte {
+	var buf bytes.Buffer
+	for _, gen := range list.generators {
+		binary.Write(&buf, binary.LittleEndian, gen.generatorType)
+		binary.Write(&buf, binary.LittleEndian, gen.value)
+	}
+	binary.Write(&buf, binary.LittleEndian, [2]uint16{})
+	return buf.Bytes()
+}
@@ -0,0 +1,178 @@
+package meltysynth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func createTestSoundFont() *SoundFont {
+	waveData := make([]int16, 100+46)
+	waveData24 := make([]byte, len(waveData))
+	for i := 0; i < 100; i++ {
+		waveData[i] = int16(100 * i)
+		waveData24[i] = byte(i)
+	}
+
+	sample := &SampleHeader{Name: "sample", Start: 0, End: 100, StartLoop: 10, EndLoop: 90, SampleRate: 22050, OriginalPitch: 60, PitchCorrection: -3, SampleType: 1}
+
+	region1 := new(InstrumentRegion)
+	setDefaultInstrumentGenerators(&region1.gs)
+	region1.Sample = sample
+	region1.gs[gen_KeyRange] = 0x3C00
+	region1.gs[gen_SampleModes] = 1
+	region1.gs[gen_InitialAttenuation] = -100
+	region1.Modulators = []Modulator{{0x0081, gen_VibratoLfoToPitch, 50, 0, 0}}
+
+	region2 := new(InstrumentRegion)
+	setDefaultInstrumentGenerators(&region2.gs)
+	region2.Sample = sample
+	region2.gs[gen_KeyRange] = 0x7F3D
+	region2.gs[gen_VelocityRange] = 0x4000
+
+	instrument := &Instrument{Name: "instrument", Regions: []*InstrumentRegion{region1, region2}}
+
+	presetRegion := new(PresetRegion)
+	setDefaultPresetGenerators(&presetRegion.gs)
+	presetRegion.Instrument = instrument
+	presetRegion.gs[gen_CoarseTune] = 12
+
+	preset1 := &Preset{Name: "preset", PatchNumber: 5, BankNumber: 0, Regions: []*PresetRegion{presetRegion}}
+	preset2 := &Preset{Name: "empty", PatchNumber: 0, BankNumber: 128}
+
+	return &SoundFont{
+		Info:          &SoundFontInfo{Version: SoundFontVersion{2, 4}, TargetSoundEngine: "EMU8000", BankName: "test", Copyright: "none"},
+		BitsPerSample: 24,
+		WaveData:      waveData,
+		WaveData24:    waveData24,
+		SampleHeaders: []*SampleHeader{sample},
+		Presets:       []*Preset{preset1, preset2},
+		Instruments:   []*Instrument{instrument},
+	}
+}
+
+func writeAndReadSoundFont(t *testing.T, soundFont *SoundFont) *SoundFont {
+	var buf bytes.Buffer
+	err := soundFont.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewSoundFont(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func checkSameSoundFont(t *testing.T, expected *SoundFont, actual *SoundFont) {
+	if *expected.Info != *actual.Info {
+		t.Errorf("the info was not preserved: %+v", *actual.Info)
+	}
+	if expected.BitsPerSample != actual.BitsPerSample {
+		t.Errorf("expected %d bits per sample, but got %d", expected.BitsPerSample, actual.BitsPerSample)
+	}
+	if !bytes.Equal(expected.WaveData24, actual.WaveData24) || len(expected.WaveData) != len(actual.WaveData) {
+		t.Fatal("the wave data was not preserved")
+	}
+	for i := 0; i < len(expected.WaveData); i++ {
+		if expected.WaveData[i] != actual.WaveData[i] {
+			t.Fatal("the wave data was not preserved")
+		}
+	}
+
+	if len(expected.SampleHeaders) != len(actual.SampleHeaders) {
+		t.Fatal("the sample headers were not preserved")
+	}
+	for i := 0; i < len(expected.SampleHeaders); i++ {
+		if *expected.SampleHeaders[i] != *actual.SampleHeaders[i] {
+			t.Errorf("the sample header %d was not preserved", i)
+		}
+	}
+
+	if len(expected.Instruments) != len(actual.Instruments) {
+		t.Fatal("the instruments were not preserved")
+	}
+	for i, instrument := range expected.Instruments {
+		other := actual.Instruments[i]
+		if instrument.Name != other.Name || len(instrument.Regions) != len(other.Regions) {
+			t.Fatalf("the instrument %q was not preserved", instrument.Name)
+		}
+		for j, region := range instrument.Regions {
+			if region.gs != other.Regions[j].gs || !equalModulators(region.Modulators, other.Regions[j].Modulators) {
+				t.Errorf("the region %d of the instrument %q was not preserved", j, instrument.Name)
+			}
+		}
+	}
+
+	if len(expected.Presets) != len(actual.Presets) {
+		t.Fatal("the presets were not preserved")
+	}
+	for i, preset := range expected.Presets {
+		other := actual.Presets[i]
+		if preset.Name != other.Name || preset.PatchNumber != other.PatchNumber || preset.BankNumber != other.BankNumber ||
+			preset.Library != other.Library || preset.Genre != other.Genre || preset.Morphology != other.Morphology ||
+			len(preset.Regions) != len(other.Regions) {
+			t.Fatalf("the preset %q was not preserved", preset.Name)
+		}
+		for j, region := range preset.Regions {
+			if region.gs != other.Regions[j].gs || !equalModulators(region.Modulators, other.Regions[j].Modulators) {
+				t.Errorf("the region %d of the preset %q was not preserved", j, preset.Name)
+			}
+		}
+	}
+}
+
+func equalModulators(x []Modulator, y []Modulator) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := 0; i < len(x); i++ {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSoundFontWriter(t *testing.T) {
+	soundFont := createTestSoundFont()
+	result := writeAndReadSoundFont(t, soundFont)
+	checkSameSoundFont(t, soundFont, result)
+
+	if result.Presets[0].Regions[0].Instrument != result.Instruments[0] {
+		t.Error("the instrument reference was not preserved")
+	}
+	if result.Instruments[0].Regions[1].Sample != result.SampleHeaders[0] {
+		t.Error("the sample reference was not preserved")
+	}
+}
+
+func TestSoundFontWriter_InvalidReference(t *testing.T) {
+	soundFont := createTestSoundFont()
+	soundFont.Instruments[0].Regions[0].Sample = &SampleHeader{Name: "unknown"}
+
+	var buf bytes.Buffer
+	err := soundFont.Write(&buf)
+	if err == nil {
+		t.Error("the sample not in the SoundFont was accepted")
+	}
+}
+
+func TestSoundFontWriter_Version(t *testing.T) {
+	soundFont := createTestSoundFont()
+	soundFont.Info.Version = SoundFontVersion{3, 1}
+
+	result := writeAndReadSoundFont(t, soundFont)
+	if result.Info.Version.Major != 2 {
+		t.Errorf("expected version 2, but got %d", result.Info.Version.Major)
+	}
+}
+
+func TestTimGM6mb_SoundFontWriter(t *testing.T) {
+	soundFont := loadGM(t)
+	checkSameSoundFont(t, soundFont, writeAndReadSoundFont(t, soundFont))
+}
+
+func TestMuseScore_SoundFontWriter(t *testing.T) {
+	soundFont := loadGS(t)
+	checkSameSoundFont(t, soundFont, writeAndReadSoundFont(t, soundFont))
+}
@@ -10,19 +10,35 @@ const (
 )
 
 type Synthesizer struct {
-	SoundFont             *SoundFont
+	SoundFont             *SoundFont // The base SoundFont with the lowest priority, which can be replaced by assigning a new one.
 	SampleRate            int32
 	BlockSize             int32
 	MaximumPolyphony      int32
 	EnableReverbAndChorus bool
+	Interpolation         InterpolationMode
+	RenderWorkerCount     int32
+	VoiceStealingPolicy   VoiceStealingPolicy
+
+	EnableDefaultModulators bool
 
 	minimumVoiceDuration int32
 
-	presetLookup  map[int32]*Preset
-	defaultPreset *Preset
+	channelVoiceLimits       [synth_channelCount]int32
+	percussionReservedVoices int32
+
+	soundFonts    []*SoundFont // From the highest priority to the lowest.
+	presetLookup  map[int32]presetEntry
+	defaultPreset presetEntry
 
 	channels []*channel
 
+	channelTunings [synth_channelCount]*Tuning // Set by SetChannelTuning, which are kept after the reset.
+	tuningPrograms map[int32]*Tuning           // The tuning programs of the MIDI Tuning Standard.
+
+	// The numbers of the member channels of the MPE zones, where 0 means the zone is disabled.
+	mpeLowerMembers int32
+	mpeUpperMembers int32
+
 	voices *voiceCollection
 
 	blockLeft  []float32
@@ -32,8 +48,19 @@ type Synthesizer struct {
 
 	blockRead int32
 
+	// The block is split at the scheduled messages, while the following blocks are kept aligned
+	// to the multiples of the block size, so that the rendering without the messages is not affected.
+	blockLength   int32
+	blockPosition int32
+
+	scheduledMessages []scheduledMessage // Sorted by the offset.
+
+	commands chan scheduledMessage
+
 	MasterVolume float32
 
+	sysExVolume float32 // The master volume set by the SysEx messages, which is applied in addition to MasterVolume.
+
 	reverb            *reverb
 	reverbInput       []float32
 	reverbOutputLeft  []float32
@@ -59,28 +86,19 @@ func NewSynthesizer(sf *SoundFont, settings *SynthesizerSettings) (*Synthesizer,
 	result.BlockSize = settings.BlockSize
 	result.MaximumPolyphony = settings.MaximumPolyphony
 	result.EnableReverbAndChorus = settings.EnableReverbAndChorus
+	result.Interpolation = settings.Interpolation
+	result.RenderWorkerCount = settings.RenderWorkerCount
+	result.VoiceStealingPolicy = settings.VoiceStealingPolicy
+	result.EnableDefaultModulators = settings.EnableDefaultModulators
+	result.channelVoiceLimits = settings.ChannelVoiceLimits
+	result.percussionReservedVoices = settings.PercussionReservedVoices
 
 	result.minimumVoiceDuration = settings.SampleRate / 500
 
-	result.presetLookup = make(map[int32]*Preset)
-
-	minPresetId := int32(math.MaxInt32)
-	for i := 0; i < len(sf.Presets); i++ {
-		preset := sf.Presets[i]
-		// The preset ID is Int32, where the upper 16 bits represent the bank number
-		// and the lower 16 bits represent the patch number.
-		// This ID is used to search for presets by the combination of bank number
-		// and patch number.
-		presetId := (preset.BankNumber << 16) | preset.PatchNumber
-		result.presetLookup[presetId] = preset
-
-		// The preset with the minimum ID number will be default.
-		// If the SoundFont is GM compatible, the piano will be chosen.
-		if presetId < minPresetId {
-			result.defaultPreset = preset
-			minPresetId = presetId
-		}
-	}
+	result.soundFonts = []*SoundFont{sf}
+	result.updatePresetLookup()
+
+	result.tuningPrograms = make(map[int32]*Tuning)
 
 	result.channels = make([]*channel, synth_channelCount)
 	for i := int32(0); int(i) < len(result.channels); i++ {
@@ -95,8 +113,12 @@ func NewSynthesizer(sf *SoundFont, settings *SynthesizerSettings) (*Synthesizer,
 	result.inverseBlockSize = 1 / float32(result.BlockSize)
 
 	result.blockRead = result.BlockSize
+	result.blockLength = result.BlockSize
+
+	result.commands = make(chan scheduledMessage, settings.CommandQueueSize)
 
 	result.MasterVolume = 0.5
+	result.sysExVolume = 1
 
 	if settings.EnableReverbAndChorus {
 		result.reverb = newReverb(settings.SampleRate)
@@ -114,6 +136,9 @@ func NewSynthesizer(sf *SoundFont, settings *SynthesizerSettings) (*Synthesizer,
 	return result, nil
 }
 
+// Processes the MIDI message immediately.
+// Note that the soft pedal only affects the notes started while it is pressed,
+// and pressing or releasing it does not change the notes already sounding.
 func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int32, data2 int32) {
 	if !(0 <= channel && int(channel) < len(s.channels)) {
 		return
@@ -129,6 +154,8 @@ func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int
 		s.NoteOn(channel, data1, data2)
 
 	case 0xB0: // Controller
+		channelInfo.setControllerValue(data1, data2)
+
 		switch data1 {
 		case 0x00: // Bank Selection
 			channelInfo.setBank(data2)
@@ -136,14 +163,21 @@ func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int
 		case 0x01: // Modulation Coarse
 			channelInfo.setModulationCoarse(data2)
 
+		case 0x05: // Portamento Time Coarse
+			channelInfo.setPortamentoTimeCoarse(data2)
+
+		case 0x25: // Portamento Time Fine
+			channelInfo.setPortamentoTimeFine(data2)
+
 		case 0x21: // Modulation Fine
 			channelInfo.setModulationFine(data2)
 
 		case 0x06: // Data Entry Coarse
-			channelInfo.dataEntryCoarse(data2)
+			s.dataEntryCoarse(channel, data2)
 
 		case 0x26: // Data Entry Fine
 			channelInfo.dataEntryFine(data2)
+			s.shareMpeBendRange(channel)
 
 		case 0x07: // Channel Volume Coarse
 			channelInfo.setVolumeCoarse(data2)
@@ -166,6 +200,18 @@ func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int
 		case 0x40: // Hold Pedal
 			channelInfo.setHoldPedal(data2)
 
+		case 0x41: // Portamento
+			channelInfo.setPortamento(data2)
+
+		case 0x42: // Sostenuto
+			s.setSostenuto(channel, data2)
+
+		case 0x43: // Soft Pedal
+			channelInfo.setSoftPedal(data2)
+
+		case 0x54: // Portamento Control
+			channelInfo.setPortamentoControl(data2)
+
 		case 0x5B: // Reverb Send
 			channelInfo.setReverbSend(data2)
 
@@ -178,6 +224,18 @@ func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int
 		case 0x64: // RPN Fine
 			channelInfo.setRpnFine(data2)
 
+		case 0x63: // NRPN Coarse
+			channelInfo.setNrpnCoarse(data2)
+
+		case 0x62: // NRPN Fine
+			channelInfo.setNrpnFine(data2)
+
+		case 0x60: // Data Increment
+			s.dataIncrement(channel, 1)
+
+		case 0x61: // Data Decrement
+			s.dataIncrement(channel, -1)
+
 		case 0x78: // All Sound Off
 			s.NoteOffAllChannel(channel, true)
 
@@ -186,11 +244,25 @@ func (s *Synthesizer) ProcessMidiMessage(channel int32, command int32, data1 int
 
 		case 0x7B: // All Note Off
 			s.NoteOffAllChannel(channel, false)
+
+		case 0x7E: // Mono Mode On
+			s.NoteOffAllChannel(channel, false)
+			channelInfo.setMonoMode(true)
+
+		case 0x7F: // Poly Mode On
+			s.NoteOffAllChannel(channel, false)
+			channelInfo.setMonoMode(false)
 		}
 
+	case 0xA0: // Poly Pressure
+		channelInfo.setPolyPressure(data1, data2)
+
 	case 0xC0: // Program Change
 		channelInfo.setPatch(data1)
 
+	case 0xD0: // Channel Pressure
+		channelInfo.setChannelPressure(data1)
+
 	case 0xE0: // Pitch Bend
 		channelInfo.setPitchBend(data1, data2)
 	}
@@ -201,6 +273,17 @@ func (s *Synthesizer) NoteOff(channel int32, key int32) {
 		return
 	}
 
+	// In the mono mode, releasing the sounding key returns to the last key still held.
+	channelInfo := s.channels[channel]
+	if channelInfo.monoMode {
+		channelInfo.removeHeldKey(key)
+		if len(channelInfo.heldKeys) > 0 && channelInfo.lastKey == key {
+			if s.legato(channel, channelInfo.heldKeys[len(channelInfo.heldKeys)-1], 0) {
+				return
+			}
+		}
+	}
+
 	for i := int32(0); i < s.voices.activeVoiceCount; i++ {
 		voice := s.voices.voices[i]
 		if voice.channel == channel && voice.key == key {
@@ -220,40 +303,93 @@ func (s *Synthesizer) NoteOn(channel int32, key int32, velocity int32) {
 	}
 
 	channelInfo := s.channels[channel]
-	presetId := (channelInfo.bankNumber << 16) | channelInfo.patchNumber
 
-	preset, found := s.presetLookup[presetId]
+	// The pressure of the previous note on the same key is not carried over.
+	channelInfo.setPolyPressure(key, 0)
+
+	// In the mono mode, the note played while another one is sounding is connected to it.
+	if channelInfo.monoMode {
+		channelInfo.pushHeldKey(key)
+		if s.legato(channel, key, velocity) {
+			return
+		}
+	}
+
+	s.startNote(channel, key, velocity)
+}
+
+// Starts the voices for the note, which glide from the key given by the portamento.
+func (s *Synthesizer) startNote(channel int32, key int32, velocity int32) {
+	s.syncBaseSoundFont()
+
+	channelInfo := s.channels[channel]
+
+	// The notes on the MPE member channels are played with the preset of the master channel.
+	presetChannel := channelInfo
+	if channelInfo.mpeMaster != -1 {
+		presetChannel = s.channels[channelInfo.mpeMaster]
+	}
+	presetId := (presetChannel.bankNumber << 16) | presetChannel.patchNumber
+
+	glideSource := channelInfo.takePortamentoSource()
+	channelInfo.lastKey = key
+
+	entry, found := s.presetLookup[presetId]
 	if !found {
 		// Try fallback to the GM sound set.
 		// Normally, the given patch number + the bank number 0 will work.
 		// For drums (bank number >= 128), it seems to be better to select the standard set (128:0).
 		var gmPresetId int32
-		if channelInfo.bankNumber < 128 {
-			gmPresetId = channelInfo.patchNumber
+		if presetChannel.bankNumber < 128 {
+			gmPresetId = presetChannel.patchNumber
 		} else {
 			gmPresetId = 128 << 16
 		}
 
-		preset, found = s.presetLookup[gmPresetId]
+		entry, found = s.presetLookup[gmPresetId]
 		if !found {
 			// No corresponding preset was found. Use the default one...
-			preset = s.defaultPreset
+			entry = s.defaultPreset
 		}
 	}
 
+	preset := entry.preset
+	if preset == nil {
+		// No SoundFont is loaded.
+		return
+	}
+
 	presetCount := len(preset.Regions)
 	for i := 0; i < presetCount; i++ {
 		presetRegion := preset.Regions[i]
 		if presetRegion.contains(key, velocity) {
-			instrumentCount := len(presetRegion.Instrument.Regions)
+			instrument := presetRegion.Instrument
+			instrumentCount := len(instrument.Regions)
 			for j := 0; j < instrumentCount; j++ {
-				instrumentRegion := presetRegion.Instrument.Regions[j]
+				instrumentRegion := instrument.Regions[j]
 				if instrumentRegion.contains(key, velocity) {
+					// The left and right samples of a stereo pair are played by a single voice.
+					// The latter region of the pair is skipped, since it has been played with the former one.
+					linked := instrument.findLinkedRegion(entry.soundFont.SampleHeaders, j, key, velocity)
+					if linked != -1 && linked < j {
+						continue
+					}
+
 					regionPair := newRegionPair(presetRegion, instrumentRegion)
 
-					voice := s.voices.requestNew(instrumentRegion, channel)
+					voice := s.voices.requestNew(instrumentRegion, channel, key)
 					if voice != nil {
-						voice.start(regionPair, channel, key, velocity)
+						// If the sample data cannot be read, the region is skipped.
+						err := voice.start(regionPair, entry.soundFont, channel, key, velocity)
+						if err != nil {
+							continue
+						}
+						if glideSource >= 0 {
+							voice.glide(channelInfo.getKeyPitch(glideSource), channelInfo.getPortamentoTime())
+						}
+						if linked != -1 {
+							voice.startLinked(newRegionPair(presetRegion, instrument.Regions[linked]), entry.soundFont)
+						}
 					}
 				}
 			}
@@ -262,6 +398,10 @@ func (s *Synthesizer) NoteOn(channel int32, key int32, velocity int32) {
 }
 
 func (s *Synthesizer) NoteOffAll(immediate bool) {
+	for _, channelInfo := range s.channels {
+		channelInfo.clearHeldKeys()
+	}
+
 	if immediate {
 		s.voices.clear()
 	} else {
@@ -272,6 +412,10 @@ func (s *Synthesizer) NoteOffAll(immediate bool) {
 }
 
 func (s *Synthesizer) NoteOffAllChannel(channel int32, immediate bool) {
+	if 0 <= channel && int(channel) < len(s.channels) {
+		s.channels[channel].clearHeldKeys()
+	}
+
 	if immediate {
 		for i := 0; i < int(s.voices.activeVoiceCount); i++ {
 			if s.voices.voices[i].channel == channel {
@@ -303,12 +447,7 @@ func (s *Synthesizer) ResetAllControllersChannel(channel int32) {
 }
 
 func (s *Synthesizer) Reset() {
-	s.voices.clear()
-
-	channelCount := len(s.channels)
-	for i := 0; i < channelCount; i++ {
-		s.channels[i].reset()
-	}
+	s.resetSystem()
 
 	if s.EnableReverbAndChorus {
 		s.reverb.mute()
@@ -316,18 +455,32 @@ func (s *Synthesizer) Reset() {
 	}
 
 	s.blockRead = s.BlockSize
+	s.blockLength = s.BlockSize
+	s.blockPosition = 0
+	s.scheduledMessages = s.scheduledMessages[:0]
 }
 
 func (s *Synthesizer) Render(left []float32, right []float32) {
+	s.processCommands()
+
 	var wrote int32
 	length := int32(len(left))
 	for wrote < length {
-		if s.blockRead == s.BlockSize {
+		if s.blockRead == s.blockLength {
+			s.processScheduledMessages(wrote)
+			s.blockPosition = (s.blockPosition + s.blockLength) % s.BlockSize
+			s.blockLength = s.BlockSize - s.blockPosition
+			if len(s.scheduledMessages) > 0 {
+				next := s.scheduledMessages[0].offset - wrote
+				if next < s.blockLength {
+					s.blockLength = next
+				}
+			}
 			s.renderBlock()
 			s.blockRead = 0
 		}
 
-		srcRem := s.BlockSize - s.blockRead
+		srcRem := s.blockLength - s.blockRead
 		dstRem := int32(length - wrote)
 		rem := int32(math.Min(float64(srcRem), float64(dstRem)))
 
@@ -339,61 +492,101 @@ func (s *Synthesizer) Render(left []float32, right []float32) {
 		s.blockRead += rem
 		wrote += rem
 	}
+
+	// The messages not reached yet are carried over to the next call.
+	for i := range s.scheduledMessages {
+		s.scheduledMessages[i].offset -= length
+	}
 }
 
 func (s *Synthesizer) renderBlock() {
-	blockSize := int(s.BlockSize)
+	// The block can be shorter than the block size if it is split at a scheduled message.
+	blockSize := int(s.blockLength)
 	activeVoiceCount := int(s.voices.activeVoiceCount)
 
+	masterVolume := s.MasterVolume * s.sysExVolume
+
+	blockLeft := s.blockLeft[:blockSize]
+	blockRight := s.blockRight[:blockSize]
+
 	s.voices.process()
 
 	for i := 0; i < blockSize; i++ {
-		s.blockLeft[i] = 0
-		s.blockRight[i] = 0
+		blockLeft[i] = 0
+		blockRight[i] = 0
 	}
 
 	for i := 0; i < activeVoiceCount; i++ {
 		voice := s.voices.voices[i]
-		previousGainLeft := s.MasterVolume * voice.previousMixGainLeft
-		currentGainLeft := s.MasterVolume * voice.currentMixGainLeft
-		s.writeBlock(previousGainLeft, currentGainLeft, voice.block, s.blockLeft)
-		var previousGainRight = s.MasterVolume * voice.previousMixGainRight
-		var currentGainRight = s.MasterVolume * voice.currentMixGainRight
-		s.writeBlock(previousGainRight, currentGainRight, voice.block, s.blockRight)
+		previousGainLeft := masterVolume * voice.previousMixGainLeft
+		currentGainLeft := masterVolume * voice.currentMixGainLeft
+		s.writeBlock(previousGainLeft, currentGainLeft, voice.block, blockLeft)
+		var previousGainRight = masterVolume * voice.previousMixGainRight
+		var currentGainRight = masterVolume * voice.currentMixGainRight
+		s.writeBlock(previousGainRight, currentGainRight, voice.block, blockRight)
+		if voice.linked {
+			previousGainLeft = masterVolume * voice.previousLinkedGainLeft
+			currentGainLeft = masterVolume * voice.currentLinkedGainLeft
+			s.writeBlock(previousGainLeft, currentGainLeft, voice.linkedBlock, blockLeft)
+			previousGainRight = masterVolume * voice.previousLinkedGainRight
+			currentGainRight = masterVolume * voice.currentLinkedGainRight
+			s.writeBlock(previousGainRight, currentGainRight, voice.linkedBlock, blockRight)
+		}
 	}
 
 	if s.EnableReverbAndChorus {
+		chorusInputLeft := s.chorusInputLeft[:blockSize]
+		chorusInputRight := s.chorusInputRight[:blockSize]
+		chorusOutputLeft := s.chorusOutputLeft[:blockSize]
+		chorusOutputRight := s.chorusOutputRight[:blockSize]
+		reverbInput := s.reverbInput[:blockSize]
+		reverbOutputLeft := s.reverbOutputLeft[:blockSize]
+		reverbOutputRight := s.reverbOutputRight[:blockSize]
+
 		for i := 0; i < blockSize; i++ {
-			s.chorusInputLeft[i] = 0
+			chorusInputLeft[i] = 0
 		}
 		for i := 0; i < blockSize; i++ {
-			s.chorusInputRight[i] = 0
+			chorusInputRight[i] = 0
 		}
 		for i := 0; i < activeVoiceCount; i++ {
 			voice := s.voices.voices[i]
 			previousGainLeft := voice.previousChorusSend * voice.previousMixGainLeft
 			currentGainLeft := voice.currentChorusSend * voice.currentMixGainLeft
-			s.writeBlock(previousGainLeft, currentGainLeft, voice.block, s.chorusInputLeft)
+			s.writeBlock(previousGainLeft, currentGainLeft, voice.block, chorusInputLeft)
 			previousGainRight := voice.previousChorusSend * voice.previousMixGainRight
 			currentGainRight := voice.currentChorusSend * voice.currentMixGainRight
-			s.writeBlock(previousGainRight, currentGainRight, voice.block, s.chorusInputRight)
+			s.writeBlock(previousGainRight, currentGainRight, voice.block, chorusInputRight)
+			if voice.linked {
+				previousGainLeft = voice.previousChorusSend * voice.previousLinkedGainLeft
+				currentGainLeft = voice.currentChorusSend * voice.currentLinkedGainLeft
+				s.writeBlock(previousGainLeft, currentGainLeft, voice.linkedBlock, chorusInputLeft)
+				previousGainRight = voice.previousChorusSend * voice.previousLinkedGainRight
+				currentGainRight = voice.currentChorusSend * voice.currentLinkedGainRight
+				s.writeBlock(previousGainRight, currentGainRight, voice.linkedBlock, chorusInputRight)
+			}
 		}
-		s.chorus.process(s.chorusInputLeft, s.chorusInputRight, s.chorusOutputLeft, s.chorusOutputRight)
-		arrayMultiplyAdd(s.MasterVolume, s.chorusOutputLeft, s.blockLeft)
-		arrayMultiplyAdd(s.MasterVolume, s.chorusOutputRight, s.blockRight)
+		s.chorus.process(chorusInputLeft, chorusInputRight, chorusOutputLeft, chorusOutputRight)
+		arrayMultiplyAdd(masterVolume, chorusOutputLeft, blockLeft)
+		arrayMultiplyAdd(masterVolume, chorusOutputRight, blockRight)
 
 		for i := 0; i < blockSize; i++ {
-			s.reverbInput[i] = 0
+			reverbInput[i] = 0
 		}
 		for i := 0; i < activeVoiceCount; i++ {
 			voice := s.voices.voices[i]
 			previousGain := s.reverb.getInputGain() * voice.previousReverbSend * (voice.previousMixGainLeft + voice.previousMixGainRight)
 			currentGain := s.reverb.getInputGain() * voice.currentReverbSend * (voice.currentMixGainLeft + voice.currentMixGainRight)
-			s.writeBlock(previousGain, currentGain, voice.block, s.reverbInput)
+			s.writeBlock(previousGain, currentGain, voice.block, reverbInput)
+			if voice.linked {
+				previousGain = s.reverb.getInputGain() * voice.previousReverbSend * (voice.previousLinkedGainLeft + voice.previousLinkedGainRight)
+				currentGain = s.reverb.getInputGain() * voice.currentReverbSend * (voice.currentLinkedGainLeft + voice.currentLinkedGainRight)
+				s.writeBlock(previousGain, currentGain, voice.linkedBlock, reverbInput)
+			}
 		}
-		s.reverb.process(s.reverbInput, s.reverbOutputLeft, s.reverbOutputRight)
-		arrayMultiplyAdd(s.MasterVolume, s.reverbOutputLeft, s.blockLeft)
-		arrayMultiplyAdd(s.MasterVolume, s.reverbOutputRight, s.blockRight)
+		s.reverb.process(reverbInput, reverbOutputLeft, reverbOutputRight)
+		arrayMultiplyAdd(masterVolume, reverbOutputLeft, blockLeft)
+		arrayMultiplyAdd(masterVolume, reverbOutputRight, blockRight)
 	}
 }
 
@@ -405,7 +598,11 @@ func (s *Synthesizer) writeBlock(previousGain float32, currentGain float32, sour
 	if math.Abs(float64(currentGain-previousGain)) < 1.0e-3 {
 		arrayMultiplyAdd(currentGain, source, destination)
 	} else {
-		step := s.inverseBlockSize * (currentGain - previousGain)
+		inverseLength := s.inverseBlockSize
+		if len(destination) != int(s.BlockSize) {
+			inverseLength = 1 / float32(len(destination))
+		}
+		step := inverseLength * (currentGain - previousGain)
 		arrayMultiplyAddSlope(previousGain, step, source, destination)
 	}
 }
@@ -3,9 +3,13 @@ package meltysynth
 import "errors"
 
 const (
-	synth_DefaultBlockSize             int32 = 64
-	synth_DefaultMaximumPolyphony      int32 = 64
-	synth_DefaultEnableReverbAndChorus bool  = true
+	synth_DefaultBlockSize               int32 = 64
+	synth_DefaultMaximumPolyphony        int32 = 64
+	synth_DefaultEnableReverbAndChorus   bool  = true
+	synth_DefaultInterpolation                 = InterpolationLinear
+	synth_DefaultCommandQueueSize        int32 = 1024
+	synth_DefaultRenderWorkerCount       int32 = 1
+	synth_DefaultEnableDefaultModulators bool  = true
 )
 
 type SynthesizerSettings struct {
@@ -13,6 +17,17 @@ type SynthesizerSettings struct {
 	BlockSize             int32
 	MaximumPolyphony      int32
 	EnableReverbAndChorus bool
+	Interpolation         InterpolationMode
+	CommandQueueSize      int32
+	RenderWorkerCount     int32 // The number of goroutines to process the voices. 1 means the serial rendering.
+
+	// Whether the default modulators of the SoundFont spec which are not built into the synthesizer,
+	// such as the velocity to the filter cutoff and the pressure to the vibrato, are applied to every voice.
+	EnableDefaultModulators bool
+
+	VoiceStealingPolicy      VoiceStealingPolicy
+	ChannelVoiceLimits       [synth_channelCount]int32 // The maximum number of voices for each channel. 0 means no limit.
+	PercussionReservedVoices int32                     // The number of voices which only the percussion channels can use.
 }
 
 func NewSynthesizerSettings(sampleRate int32) *SynthesizerSettings {
@@ -22,6 +37,10 @@ func NewSynthesizerSettings(sampleRate int32) *SynthesizerSettings {
 	result.BlockSize = synth_DefaultBlockSize
 	result.MaximumPolyphony = synth_DefaultMaximumPolyphony
 	result.EnableReverbAndChorus = synth_DefaultEnableReverbAndChorus
+	result.Interpolation = synth_DefaultInterpolation
+	result.CommandQueueSize = synth_DefaultCommandQueueSize
+	result.RenderWorkerCount = synth_DefaultRenderWorkerCount
+	result.EnableDefaultModulators = synth_DefaultEnableDefaultModulators
 
 	return result
 }
@@ -39,5 +58,31 @@ func (settings *SynthesizerSettings) validate() error {
 		return errors.New("the maximum number of polyphony must be between 8 and 256")
 	}
 
+	if !(InterpolationLinear <= settings.Interpolation && settings.Interpolation <= InterpolationSinc) {
+		return errors.New("the interpolation mode is invalid")
+	}
+
+	if !(16 <= settings.CommandQueueSize && settings.CommandQueueSize <= 65536) {
+		return errors.New("the command queue size must be between 16 and 65536")
+	}
+
+	if !(1 <= settings.RenderWorkerCount && settings.RenderWorkerCount <= 256) {
+		return errors.New("the number of render workers must be between 1 and 256")
+	}
+
+	if !(VoiceStealingPriority <= settings.VoiceStealingPolicy && settings.VoiceStealingPolicy <= VoiceStealingSameKeyFirst) {
+		return errors.New("the voice stealing policy is invalid")
+	}
+
+	for _, limit := range settings.ChannelVoiceLimits {
+		if !(0 <= limit && limit <= settings.MaximumPolyphony) {
+			return errors.New("the voice limit of each channel must be between 0 and the maximum number of polyphony")
+		}
+	}
+
+	if !(0 <= settings.PercussionReservedVoices && settings.PercussionReservedVoices < settings.MaximumPolyphony) {
+		return errors.New("the number of reserved voices must be less than the maximum number of polyphony")
+	}
+
 	return nil
 }
@@ -0,0 +1,132 @@
+package meltysynth
+
+const (
+	sysEx_NonRealtime byte = 0x7E
+	sysEx_Realtime    byte = 0x7F
+	sysEx_Roland      byte = 0x41
+	sysEx_Yamaha      byte = 0x43
+)
+
+// Processes the System Exclusive message.
+// The data may or may not contain the leading 0xF0 and the trailing 0xF7.
+// The following messages are supported, and the others are ignored:
+//   - GM System On, GM System Off, GM2 System On
+//   - Master Volume (universal, GS and XG)
+//   - GS Reset and XG System On
+//   - GS Use for Rhythm Part and XG Part Mode, which switch the channel to a drum channel
+//   - MIDI Tuning Standard (bulk dumps, single note tuning changes and scale/octave tunings)
+func (s *Synthesizer) ProcessSysEx(data []byte) {
+	if len(data) > 0 && data[0] == 0xF0 {
+		data = data[1:]
+	}
+	if len(data) > 0 && data[len(data)-1] == 0xF7 {
+		data = data[:len(data)-1]
+	}
+	if len(data) < 4 {
+		return
+	}
+
+	// The device ID is ignored, since the synthesizer responds to all the devices.
+	switch data[0] {
+	case sysEx_NonRealtime:
+		switch data[2] {
+		case 0x08: // MIDI Tuning Standard
+			s.processTuningSysEx(data)
+		case 0x09: // General MIDI
+			if data[3] == 0x01 || data[3] == 0x02 || data[3] == 0x03 {
+				s.resetSystem()
+			}
+		}
+
+	case sysEx_Realtime:
+		switch data[2] {
+		case 0x04: // Device Control
+			if data[3] == 0x01 && len(data) >= 6 {
+				s.sysExVolume = float32(int32(data[4])|(int32(data[5])<<7)) / 16383
+			}
+		case 0x08: // MIDI Tuning Standard
+			s.processTuningSysEx(data)
+		}
+
+	case sysEx_Roland:
+		s.processRolandSysEx(data)
+
+	case sysEx_Yamaha:
+		s.processYamahaSysEx(data)
+	}
+}
+
+// F0 41 dev 42 12 a1 a2 a3 value... checksum F7
+// The checksum is not verified, since it is often wrong in the MIDI files.
+func (s *Synthesizer) processRolandSysEx(data []byte) {
+	if len(data) < 9 || data[2] != 0x42 || data[3] != 0x12 {
+		return
+	}
+
+	address := (int32(data[4]) << 16) | (int32(data[5]) << 8) | int32(data[6])
+	value := int32(data[7])
+
+	switch {
+	case address == 0x40007F || address == 0x00007F: // GS Reset or System Mode Set
+		s.resetSystem()
+
+	case address == 0x400004: // Master Volume
+		s.sysExVolume = float32(value) / 127
+
+	case address&0xFFF0FF == 0x401015: // Use for Rhythm Part
+		// The parts are numbered from 1 to 16, where the part 10 comes first.
+		part := (address >> 8) & 0x0F
+		var channel int32
+		switch {
+		case part == 0:
+			channel = 9
+		case part <= 9:
+			channel = part - 1
+		default:
+			channel = part
+		}
+		s.channels[channel].setPercussionChannel(value != 0)
+	}
+}
+
+// F0 43 1n 4C a1 a2 a3 value F7
+func (s *Synthesizer) processYamahaSysEx(data []byte) {
+	if len(data) < 7 || data[1]&0xF0 != 0x10 || data[2] != 0x4C {
+		return
+	}
+
+	address := (int32(data[3]) << 16) | (int32(data[4]) << 8) | int32(data[5])
+	value := int32(data[6])
+
+	switch {
+	case address == 0x00007E || address == 0x00007F: // XG System On or All Parameter Reset
+		s.resetSystem()
+
+	case address == 0x000004: // Master Volume
+		s.sysExVolume = float32(value) / 127
+
+	case address&0xFF00FF == 0x080007: // Part Mode
+		channel := (address >> 8) & 0xFF
+		if channel < synth_channelCount {
+			s.channels[channel].setPercussionChannel(value != 0)
+		}
+	}
+}
+
+// Resets the sound and the channels, while the scheduled messages are kept unlike Reset.
+func (s *Synthesizer) resetSystem() {
+	// Fade out the sounding voices to avoid clicks.
+	for i := 0; i < int(s.voices.activeVoiceCount); i++ {
+		s.voices.voices[i].fadeOut()
+	}
+
+	for i, ch := range s.channels {
+		ch.isPercussionChannel = int32(i) == synth_percussionChannel
+		ch.reset()
+		ch.tuning = s.channelTunings[i]
+	}
+
+	s.mpeLowerMembers = 0
+	s.mpeUpperMembers = 0
+	s.sysExVolume = 1
+}
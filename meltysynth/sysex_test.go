@@ -0,0 +1,140 @@
+package meltysynth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSynthesizer_ProcessSysEx_DrumPart(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0, 128<<16)
+
+	// GS: use the part 2 (channel 1) for the rhythm part.
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x12, 0x15, 0x01, 0x18, 0xF7})
+	// XG: set the part mode of channel 3 to drum.
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x43, 0x10, 0x4C, 0x08, 0x03, 0x07, 0x02, 0xF7})
+	// GS: use the part 10 (channel 9) as a normal part.
+	synthesizer.ProcessSysEx([]byte{0x41, 0x10, 0x42, 0x12, 0x40, 0x10, 0x15, 0x00, 0x1B})
+
+	for i, ch := range synthesizer.channels {
+		expected := i == 1 || i == 3
+		if ch.isPercussionChannel != expected {
+			t.Errorf("channel %d: expected the percussion channel to be %v", i, expected)
+		}
+	}
+
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x00, 0)
+	if synthesizer.channels[1].bankNumber != 128 {
+		t.Errorf("expected the bank 128 on the drum channel, but got %d", synthesizer.channels[1].bankNumber)
+	}
+
+	// GS Reset restores the default drum channel.
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7})
+	for i, ch := range synthesizer.channels {
+		expected := int32(i) == synth_percussionChannel
+		if ch.isPercussionChannel != expected {
+			t.Errorf("channel %d: the percussion channel should be reset", i)
+		}
+	}
+}
+
+func TestSynthesizer_ProcessSysEx_Reset(t *testing.T) {
+	messages := [][]byte{
+		{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7},                               // GM System On
+		{0xF0, 0x7E, 0x7F, 0x09, 0x03, 0xF7},                               // GM2 System On
+		{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7}, // GS Reset
+		{0xF0, 0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00, 0xF7},             // XG System On
+	}
+
+	for _, msg := range messages {
+		synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0, 128<<16)
+		synthesizer.ProcessMidiMessage(0, 0xB0, 0x07, 10)
+		synthesizer.NoteOn(0, 60, 100)
+		synthesizer.ProcessSysEx(msg)
+		if synthesizer.voices.activeVoiceCount != 1 || synthesizer.voices.voices[0].voiceState != voice_Released {
+			t.Errorf("% X: the voices should be faded out instead of being cut", msg)
+		}
+		if synthesizer.channels[0].volume != 100<<7 {
+			t.Errorf("% X: the channel should be reset", msg)
+		}
+		left := make([]float32, 4096)
+		right := make([]float32, 4096)
+		synthesizer.Render(left, right)
+		if synthesizer.voices.activeVoiceCount != 0 {
+			t.Errorf("% X: the voices should be stopped", msg)
+		}
+	}
+}
+
+func TestSynthesizer_ProcessSysEx_MasterVolume(t *testing.T) {
+	render := func(msg []byte) float32 {
+		synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0, 128<<16)
+		synthesizer.ProcessSysEx(msg)
+		synthesizer.NoteOn(0, 60, 100)
+		left := make([]float32, 1024)
+		right := make([]float32, 1024)
+		synthesizer.Render(left, right)
+		var peak float32
+		for _, value := range left {
+			if value > peak {
+				peak = value
+			}
+		}
+		return peak
+	}
+
+	reference := render(nil)
+	checks := []struct {
+		msg    []byte
+		volume float32
+	}{
+		{[]byte{0xF0, 0x7F, 0x7F, 0x04, 0x01, 0x7F, 0x3F, 0xF7}, 8191.0 / 16383},
+		{[]byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x04, 0x20, 0x1C, 0xF7}, 32.0 / 127},
+		{[]byte{0xF0, 0x43, 0x10, 0x4C, 0x00, 0x00, 0x04, 0x00, 0xF7}, 0},
+	}
+	for _, check := range checks {
+		peak := render(check.msg)
+		expected := reference * check.volume
+		if peak < expected-1.0e-5 || peak > expected+1.0e-5 {
+			t.Errorf("% X: expected the peak %f, but got %f", check.msg, expected, peak)
+		}
+	}
+}
+
+func TestMidiFile_SysEx(t *testing.T) {
+	track := []byte{
+		0x00, 0xF0, 0x05, 0x7E, 0x7F, 0x09, 0x01, 0xF7, // Complete message.
+		0x00, 0xF0, 0x03, 0x43, 0x10, 0x4C, // Split into the packets.
+		0x10, 0xF7, 0x05, 0x00, 0x00, 0x7E, 0x00, 0xF7,
+		0x00, 0xF7, 0x02, 0xF8, 0xF7, // Escape, which is not a SysEx message.
+		0x00, 0x90, 0x3C, 0x64,
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	var data bytes.Buffer
+	data.Write([]byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96})
+	data.Write([]byte{'M', 'T', 'r', 'k', 0, 0, 0, byte(len(track))})
+	data.Write(track)
+
+	mf, err := NewMidiFile(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]byte{
+		{0x7E, 0x7F, 0x09, 0x01, 0xF7},
+		{0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00, 0xF7},
+	}
+	var count int
+	for _, msg := range mf.messages {
+		if msg.getMessageType() != msg_SysEx {
+			continue
+		}
+		sysEx := mf.sysExData[msg.getSysExIndex()]
+		if count >= len(expected) || !bytes.Equal(sysEx, expected[count]) {
+			t.Fatalf("unexpected SysEx data % X", sysEx)
+		}
+		count++
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d SysEx messages, but got %d", len(expected), count)
+	}
+}
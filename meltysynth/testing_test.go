@@ -7,11 +7,13 @@ import (
 )
 
 const (
-	envGS = "MELTYSYNTH_GS"
-	envGM = "MELTYSYNTH_GM"
+	envGS  = "MELTYSYNTH_GS"
+	envGM  = "MELTYSYNTH_GM"
+	envSF3 = "MELTYSYNTH_SF3"
 
-	defaultPathGS = "GeneralUser GS MuseScore v1.442.sf2"
-	defaultPathGM = "TimGM6mb.sf2"
+	defaultPathGS  = "GeneralUser GS MuseScore v1.442.sf2"
+	defaultPathGM  = "TimGM6mb.sf2"
+	defaultPathSF3 = "MuseScore_General.sf3"
 )
 
 func loadGS(t *testing.T) *SoundFont {
@@ -22,6 +24,10 @@ func loadGM(t *testing.T) *SoundFont {
 	return loadSoundFont(t, envGM, defaultPathGM)
 }
 
+func loadSF3(t *testing.T) *SoundFont {
+	return loadSoundFont(t, envSF3, defaultPathSF3)
+}
+
 func loadSoundFont(t *testing.T, env, defaultPath string) *SoundFont {
 	var useDefault bool
 	p := os.Getenv(env)
@@ -48,3 +54,50 @@ func loadSoundFont(t *testing.T, env, defaultPath string) *SoundFont {
 
 	return sf
 }
+
+// Creates the synthesizer which plays the presets of the given IDs, whose upper 16 bits are the bank number.
+// The settings can be changed by configure before the synthesizer is created.
+func createTestSynthesizer(t testing.TB, configure func(settings *SynthesizerSettings), ids ...int32) *Synthesizer {
+	settings := NewSynthesizerSettings(44100)
+	if configure != nil {
+		configure(settings)
+	}
+	synthesizer, err := NewSynthesizer(createStackTestSoundFont(t, "test", ids...), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return synthesizer
+}
+
+func disableReverbAndChorus(settings *SynthesizerSettings) {
+	settings.EnableReverbAndChorus = false
+}
+
+// Returns the active voice of the key, or nil if not found.
+func findActiveVoice(synthesizer *Synthesizer, channel int32, key int32) *voice {
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		if voice.channel == channel && voice.key == key {
+			return voice
+		}
+	}
+	return nil
+}
+
+// Returns the only voice playing on the channel.
+func findPlayingVoice(t *testing.T, synthesizer *Synthesizer, channel int32) *voice {
+	var found *voice
+	for i := int32(0); i < synthesizer.voices.activeVoiceCount; i++ {
+		voice := synthesizer.voices.voices[i]
+		if voice.channel == channel && voice.voiceState == voice_Playing {
+			if found != nil {
+				t.Fatal("only one voice should be playing")
+			}
+			found = voice
+		}
+	}
+	if found == nil {
+		t.Fatal("no voice is playing")
+	}
+	return found
+}
@@ -0,0 +1,320 @@
+package meltysynth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Maps each key to the pitch, which is used instead of the equal temperament.
+type Tuning struct {
+	Keys [128]float32 // The pitch of each key in semitones, where 69 is 440 Hz.
+}
+
+// Creates a tuning of the 12-tone equal temperament, which can be modified key by key.
+func NewTuning() *Tuning {
+	result := new(Tuning)
+	for i := range result.Keys {
+		result.Keys[i] = float32(i)
+	}
+	return result
+}
+
+// The keyboard mapping of Scala, which is used if the .kbm file is not given.
+// The middle C is mapped to the first degree of the scale with its usual frequency.
+var tuning_DefaultMapping = scalaMapping{
+	firstKey:     0,
+	lastKey:      127,
+	middleKey:    60,
+	referenceKey: 60,
+	frequency:    261.6255653005986,
+	octave:       -1,
+}
+
+type scalaMapping struct {
+	firstKey     int32
+	lastKey      int32
+	middleKey    int32
+	referenceKey int32
+	frequency    float64
+	octave       int32   // The scale degree of the formal octave. -1 means the size of the scale.
+	degrees      []int32 // The scale degree of each key in the mapping. -1 means the key is not mapped.
+}
+
+// Reads the Scala scale file (.scl) and the optional keyboard mapping file (.kbm).
+// If kbm is nil, the first degree of the scale is mapped to the middle C without changing its frequency.
+// The keys which are not mapped keep the pitch of the equal temperament.
+func NewTuningFromScala(scl io.Reader, kbm io.Reader) (*Tuning, error) {
+	scale, err := readScalaScale(scl)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := tuning_DefaultMapping
+	if kbm != nil {
+		mapping, err = readScalaMapping(kbm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mapping.octave == -1 {
+		mapping.octave = int32(len(scale))
+	}
+
+	// The pitch of the reference key is fixed to the frequency, and the other keys follow the scale.
+	referenceDegree, mapped := mapping.getDegree(mapping.referenceKey)
+	if !mapped {
+		return nil, errors.New("the reference key of the keyboard mapping is not mapped")
+	}
+	base := 69 + 12*math.Log2(mapping.frequency/440) - getScaleCents(scale, referenceDegree)/100
+
+	result := NewTuning()
+	for key := mapping.firstKey; key <= mapping.lastKey; key++ {
+		if !(0 <= key && int(key) < len(result.Keys)) {
+			continue
+		}
+		degree, mapped := mapping.getDegree(key)
+		if mapped {
+			result.Keys[key] = float32(base + getScaleCents(scale, degree)/100)
+		}
+	}
+
+	return result, nil
+}
+
+// Returns the scale degree of the key counted from the middle key, which can exceed the size of the scale.
+func (mapping *scalaMapping) getDegree(key int32) (int32, bool) {
+	distance := key - mapping.middleKey
+	if len(mapping.degrees) == 0 {
+		return distance, true
+	}
+
+	size := int32(len(mapping.degrees))
+	octave := floorDiv(distance, size)
+	degree := mapping.degrees[distance-octave*size]
+	if degree < 0 {
+		return 0, false
+	}
+	return octave*mapping.octave + degree, true
+}
+
+// The scale contains the pitches in cents of the degrees from 1, where the last one is the period.
+func getScaleCents(scale []float64, degree int32) float64 {
+	size := int32(len(scale))
+	period := floorDiv(degree, size)
+	index := degree - period*size
+	cents := float64(period) * scale[size-1]
+	if index > 0 {
+		cents += scale[index-1]
+	}
+	return cents
+}
+
+func floorDiv(a int32, b int32) int32 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// Returns the lines except the comments, where the blank lines are kept since the description can be empty.
+func readScalaLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func readScalaScale(r io.Reader) ([]float64, error) {
+	lines, err := readScalaLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, errors.New("the scala file has no scale")
+	}
+
+	// The first line is the description.
+	count, err := strconv.Atoi(getFirstField(lines[1]))
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("the number of the notes %q is invalid", lines[1])
+	}
+
+	scale := make([]float64, 0, count)
+	for _, line := range lines[2:] {
+		if len(scale) == count {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		cents, err := parseScalaPitch(getFirstField(line))
+		if err != nil {
+			return nil, err
+		}
+		scale = append(scale, cents)
+	}
+	if len(scale) != count {
+		return nil, fmt.Errorf("expected %d notes in the scale, but got %d", count, len(scale))
+	}
+
+	return scale, nil
+}
+
+// The pitch is given in cents if it contains a period, or as a ratio otherwise.
+func parseScalaPitch(value string) (float64, error) {
+	if strings.Contains(value, ".") {
+		cents, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("the pitch %q is invalid", value)
+		}
+		return cents, nil
+	}
+
+	numerator := value
+	denominator := "1"
+	index := strings.Index(value, "/")
+	if index != -1 {
+		numerator = value[:index]
+		denominator = value[index+1:]
+	}
+	n, err1 := strconv.ParseUint(numerator, 10, 64)
+	d, err2 := strconv.ParseUint(denominator, 10, 64)
+	if err1 != nil || err2 != nil || n == 0 || d == 0 {
+		return 0, fmt.Errorf("the pitch %q is invalid", value)
+	}
+	return 1200 * math.Log2(float64(n)/float64(d)), nil
+}
+
+func readScalaMapping(r io.Reader) (scalaMapping, error) {
+	var mapping scalaMapping
+
+	lines, err := readScalaLines(r)
+	if err != nil {
+		return mapping, err
+	}
+
+	var fields []string
+	for _, line := range lines {
+		if line != "" {
+			fields = append(fields, getFirstField(line))
+		}
+	}
+	if len(fields) < 7 {
+		return mapping, errors.New("the keyboard mapping file is incomplete")
+	}
+
+	var values [7]float64
+	for i := 0; i < 7; i++ {
+		values[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return mapping, fmt.Errorf("the value %q of the keyboard mapping is invalid", fields[i])
+		}
+	}
+
+	size := int32(values[0])
+	mapping.firstKey = int32(values[1])
+	mapping.lastKey = int32(values[2])
+	mapping.middleKey = int32(values[3])
+	mapping.referenceKey = int32(values[4])
+	mapping.frequency = values[5]
+	mapping.octave = int32(values[6])
+	if size < 0 || mapping.frequency <= 0 {
+		return mapping, errors.New("the keyboard mapping has invalid values")
+	}
+	// The formal octave is not used by the linear mapping whose size is 0.
+	if size > 0 && mapping.octave <= 0 {
+		return mapping, fmt.Errorf("the octave degree %q of the keyboard mapping is invalid", fields[6])
+	}
+
+	// The missing entries at the end are not mapped.
+	mapping.degrees = make([]int32, size)
+	for i := range mapping.degrees {
+		mapping.degrees[i] = -1
+		if 7+i < len(fields) && fields[7+i] != "x" && fields[7+i] != "X" {
+			degree, err := strconv.Atoi(fields[7+i])
+			if err != nil || degree < 0 {
+				return mapping, fmt.Errorf("the degree %q of the keyboard mapping is invalid", fields[7+i])
+			}
+			mapping.degrees[i] = int32(degree)
+		}
+	}
+
+	return mapping, nil
+}
+
+func getFirstField(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// Sets the tuning of the channel, which is kept even after the reset.
+// If tuning is nil, the channel returns to the equal temperament.
+// The tuning is shared, so the changes to it affect the notes already playing.
+func (s *Synthesizer) SetChannelTuning(channel int32, tuning *Tuning) {
+	if !(0 <= channel && int(channel) < len(s.channels)) {
+		return
+	}
+
+	s.channelTunings[channel] = tuning
+	s.channels[channel].tuning = tuning
+	s.channels[channel].tuningSelected = false
+}
+
+// Registers the tuning as the tuning program of the MIDI Tuning Standard,
+// which is selected by the RPN 3 (program) and 4 (bank).
+func (s *Synthesizer) SetTuningProgram(bank int32, program int32, tuning *Tuning) {
+	if tuning == nil {
+		delete(s.tuningPrograms, (bank<<7)|program)
+	} else {
+		s.tuningPrograms[(bank<<7)|program] = tuning
+	}
+	s.updateChannelTunings()
+}
+
+func (ch *channel) setTuningProgram(value int32) {
+	ch.tuningProgram = value
+	ch.selectTuningProgram()
+}
+
+func (ch *channel) setTuningBank(value int32) {
+	ch.tuningBank = value
+	ch.selectTuningProgram()
+}
+
+// If the tuning program is not registered, the channel uses the equal temperament.
+func (ch *channel) selectTuningProgram() {
+	ch.tuning = ch.synthesizer.tuningPrograms[(ch.tuningBank<<7)|ch.tuningProgram]
+	ch.tuningSelected = true
+}
+
+// Returns the pitch of the key with the tuning and the scale/octave tuning.
+func (ch *channel) getKeyPitch(key int32) float32 {
+	if !(0 <= key && key < 128) {
+		return float32(key)
+	}
+
+	pitch := float32(key)
+	if ch.tuning != nil {
+		pitch = ch.tuning.Keys[key]
+	}
+	return pitch + ch.scaleTuning[key%12]
+}
@@ -0,0 +1,186 @@
+package meltysynth
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const tuningTestJustScale = `! just.scl
+!
+5-limit just intonation
+ 12
+!
+ 16/15
+ 9/8
+ 6/5
+ 5/4
+ 4/3
+ 45/32
+ 3/2
+ 8/5
+ 5/3
+ 9/5
+ 15/8
+ 2/1
+`
+
+func checkKeyPitch(t *testing.T, tuning *Tuning, key int32, expected float64) {
+	if math.Abs(float64(tuning.Keys[key])-expected) > 1.0e-4 {
+		t.Errorf("expected the pitch %f for the key %d, but got %f", expected, key, tuning.Keys[key])
+	}
+}
+
+func TestNewTuningFromScala(t *testing.T) {
+	tuning, err := NewTuningFromScala(strings.NewReader(tuningTestJustScale), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeyPitch(t, tuning, 60, 60)
+	checkKeyPitch(t, tuning, 67, 60+12*math.Log2(1.5))
+	checkKeyPitch(t, tuning, 76, 72+12*math.Log2(1.25))
+	checkKeyPitch(t, tuning, 59, 48+12*math.Log2(15.0/8))
+
+	// The 19 equal divisions of the octave in cents.
+	var edo strings.Builder
+	edo.WriteString("19-EDO\n19\n")
+	for i := 1; i <= 19; i++ {
+		edo.WriteString(strconv.FormatFloat(1200*float64(i)/19, 'f', 6, 64) + "\n")
+	}
+	tuning, err = NewTuningFromScala(strings.NewReader(edo.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeyPitch(t, tuning, 61, 60+12.0/19)
+	checkKeyPitch(t, tuning, 79, 72)
+}
+
+func TestNewTuningFromScala_KeyboardMapping(t *testing.T) {
+	// The white keys are mapped to the 7-note scale, and A4 is tuned to 432 Hz.
+	kbm := `! white.kbm
+12
+0
+127
+60
+69
+432.0
+7
+! Mapping.
+0
+x
+1
+x
+2
+3
+x
+4
+x
+5
+x
+6
+`
+	scale := "C major\n7\n9/8\n5/4\n4/3\n3/2\n5/3\n15/8\n2/1\n"
+	tuning, err := NewTuningFromScala(strings.NewReader(scale), strings.NewReader(kbm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a4 := 69 + 12*math.Log2(432.0/440)
+	checkKeyPitch(t, tuning, 69, a4)
+	checkKeyPitch(t, tuning, 60, a4-12*math.Log2(5.0/3))
+	checkKeyPitch(t, tuning, 81, a4+12)
+	checkKeyPitch(t, tuning, 61, 61)
+
+	_, err = NewTuningFromScala(strings.NewReader("broken\n3\n9/8\n"), nil)
+	if err == nil {
+		t.Error("the incomplete scale should be rejected")
+	}
+
+	_, err = NewTuningFromScala(strings.NewReader(scale), strings.NewReader(strings.Replace(kbm, "\n7\n", "\n0\n", 1)))
+	if err == nil {
+		t.Error("the mapping without the formal octave should be rejected")
+	}
+}
+
+func TestSynthesizer_SetChannelTuning(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	tuning := NewTuning()
+	tuning.Keys[60] = 62.5
+	synthesizer.SetChannelTuning(0, tuning)
+	synthesizer.Reset()
+	synthesizer.NoteOn(0, 60, 100)
+	voice := findPlayingVoice(t, synthesizer, 0)
+	if voice.getGlidingKey() != 62.5 {
+		t.Errorf("expected the pitch 62.5, but got %f", voice.getGlidingKey())
+	}
+
+	// The change affects the note playing.
+	tuning.Keys[60] = 59
+	if voice.getGlidingKey() != 59 {
+		t.Errorf("expected the pitch 59, but got %f", voice.getGlidingKey())
+	}
+
+	synthesizer.SetChannelTuning(0, nil)
+	if voice.getGlidingKey() != 60 {
+		t.Error("the channel should return to the equal temperament")
+	}
+}
+
+func TestSynthesizer_MidiTuningStandard(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, disableReverbAndChorus, 0)
+
+	// Bulk dump of the tuning program 3, which raises all the keys by a quarter tone.
+	dump := []byte{0xF0, 0x7E, 0x7F, 0x08, 0x01, 0x03}
+	dump = append(dump, []byte("quarter tone    ")...)
+	for key := 0; key < 128; key++ {
+		dump = append(dump, byte(key), 0x40, 0x00)
+	}
+	dump = append(dump, 0x00, 0xF7)
+	synthesizer.ProcessSysEx(dump)
+
+	// Select the tuning program by the RPN 3.
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x65, 0)
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x64, 3)
+	synthesizer.ProcessMidiMessage(1, 0xB0, 0x06, 3)
+	if pitch := synthesizer.channels[1].getKeyPitch(64); pitch != 64.5 {
+		t.Errorf("expected the pitch 64.5 from the bulk dump, but got %f", pitch)
+	}
+
+	// The single note tuning change affects the note playing.
+	synthesizer.NoteOn(1, 60, 100)
+	voice := findPlayingVoice(t, synthesizer, 1)
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x7F, 0x7F, 0x08, 0x02, 0x03, 0x01, 0x3C, 0x3D, 0x60, 0x00, 0xF7})
+	if voice.getGlidingKey() != 61.75 {
+		t.Errorf("expected the pitch 61.75 from the single note change, but got %f", voice.getGlidingKey())
+	}
+	if pitch := synthesizer.channels[0].getKeyPitch(60); pitch != 60 {
+		t.Errorf("the channel without the tuning program should not be affected, but got %f", pitch)
+	}
+
+	// The tuning given by the caller is not modified by the messages.
+	tuning := NewTuning()
+	synthesizer.SetTuningProgram(0, 5, tuning)
+	synthesizer.ProcessSysEx([]byte{0xF0, 0x7F, 0x7F, 0x08, 0x02, 0x05, 0x01, 0x3C, 0x3D, 0x60, 0x00, 0xF7})
+	if tuning.Keys[60] != 60 {
+		t.Errorf("the registered tuning should not be modified, but got %f", tuning.Keys[60])
+	}
+	if pitch := synthesizer.tuningPrograms[5].Keys[60]; pitch != 61.75 {
+		t.Errorf("expected the pitch 61.75 for the tuning program, but got %f", pitch)
+	}
+
+	// Scale/octave tuning (1-byte form) for the channels 1 and 3, which raises C by 50 cents.
+	scale := []byte{0xF0, 0x7E, 0x7F, 0x08, 0x08, 0x00, 0x00, 0x05}
+	scale = append(scale, 114, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 64, 0xF7)
+	synthesizer.ProcessSysEx(scale)
+	if pitch := synthesizer.channels[0].getKeyPitch(48); pitch != 48.5 {
+		t.Errorf("expected the pitch 48.5 from the scale/octave tuning, but got %f", pitch)
+	}
+	if pitch := synthesizer.channels[2].getKeyPitch(48); pitch != 48.5 {
+		t.Errorf("expected the pitch 48.5 from the scale/octave tuning, but got %f", pitch)
+	}
+	if pitch := synthesizer.channels[1].getKeyPitch(50); pitch != 50.5 {
+		t.Errorf("the other pitch classes should not be affected, but got %f", pitch)
+	}
+}
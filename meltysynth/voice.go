@@ -1,13 +1,14 @@
 package meltysynth
 
-import "math"
-
 const (
 	voice_Playing          int32 = 0
 	voice_ReleaseRequested int32 = 1
 	voice_Released         int32 = 2
 )
 
+// The release time in seconds used to fade out the voices.
+const voice_FadeOutTime float32 = 0.02
+
 type voice struct {
 	synthesizer *Synthesizer
 
@@ -22,6 +23,14 @@ type voice struct {
 
 	block []float32
 
+	// The other half of the linked stereo sample, which is rendered in lock-step with the main one.
+	// The pitch, envelopes and filter settings are shared, while the pan is taken from its own region.
+	linked           bool
+	linkedOscillator *oscillator
+	linkedFilter     *biQuadFilter
+	linkedBlock      []float32
+	linkedPan        float32
+
 	// A sudden change in the mix gain will cause pop noise.
 	// To avoid this, we save the mix gain of the previous block,
 	// and smooth out the gain if the gap between the current and previous gain is too large.
@@ -32,6 +41,11 @@ type voice struct {
 	currentMixGainLeft   float32
 	currentMixGainRight  float32
 
+	previousLinkedGainLeft  float32
+	previousLinkedGainRight float32
+	currentLinkedGainLeft   float32
+	currentLinkedGainRight  float32
+
 	previousReverbSend float32
 	previousChorusSend float32
 	currentReverbSend  float32
@@ -39,11 +53,16 @@ type voice struct {
 
 	exclusiveClass int32
 	channel        int32
+	master         *channel // The master channel of the MPE zone, or nil if the voice is not on a member channel.
 	key            int32
 	velocity       int32
 
 	noteGain float32
 
+	// The pitch offset in semitones for the portamento, which approaches zero by the rate per sample.
+	glideOffset float32
+	glideRate   float32
+
 	cutoff    float32
 	resonance float32
 
@@ -66,8 +85,26 @@ type voice struct {
 	// This is used to smooth out the cutoff frequency.
 	smoothedCutoff float32
 
+	// The modulators which depend on the MIDI controllers are evaluated again when the channel is changed.
+	// The others are evaluated only once at the note-on.
+	modulators       []Modulator
+	modulatorOffsets [61]float32
+	modulatorSerial  uint32 // The serial of the channel when the modulators were evaluated.
+	startOffsets     [61]float32
+	builtins         uint16
+
 	voiceState  int32
 	voiceLength int32
+
+	sostenuto bool // Whether the voice was caught by the sostenuto pedal.
+
+	// The result of the last process call on the parallel rendering.
+	playing bool
+
+	// The SoundFont and the regions which the voice was started from.
+	soundFont        *SoundFont
+	presetRegion     *PresetRegion
+	instrumentRegion *InstrumentRegion
 }
 
 func newVoice(s *Synthesizer) *voice {
@@ -80,21 +117,49 @@ func newVoice(s *Synthesizer) *voice {
 		oscillator:  newOscillator(s),
 		filter:      newBiQuadFilter(s),
 		block:       make([]float32, s.BlockSize),
+
+		linkedOscillator: newOscillator(s),
+		linkedFilter:     newBiQuadFilter(s),
+		linkedBlock:      make([]float32, s.BlockSize),
 	}
 }
 
-func (v *voice) start(region regionPair, channel int32, key int32, velocity int32) {
+func (v *voice) start(region regionPair, soundFont *SoundFont, channel int32, key int32, velocity int32) error {
 	v.exclusiveClass = region.GetExclusiveClass()
 	v.channel = channel
 	v.key = key
 	v.velocity = velocity
+	v.soundFont = soundFont
+	v.presetRegion = region.preset
+	v.instrumentRegion = region.instrument
+
+	v.master = nil
+	if mpeMaster := v.synthesizer.channels[channel].mpeMaster; mpeMaster != -1 {
+		v.master = v.synthesizer.channels[mpeMaster]
+	}
+
+	v.setupModulators(region, v.synthesizer.channels[channel])
+	v.synthesizer.channels[channel].applyNrpnOffsets(&v.startOffsets, key)
+	v.synthesizer.channels[channel].applySoftPedal(&v.startOffsets)
+	region.modulation = &v.startOffsets
+
+	// The sample window depends on the address offsets modulated at the note-on.
+	window, err := soundFont.getWaveWindow(region)
+	if err != nil {
+		v.kill()
+		return err
+	}
 
 	if velocity > 0 {
 		// According to the Polyphone's implementation, the initial attenuation should be reduced to 40%.
 		// I'm not sure why, but this indeed improves the loudness variability.
 		sampleAttenuation := 0.4 * region.GetInitialAttenuation()
 		filterAttenuation := 0.5 * region.GetInitialFilterQ()
-		decibels := 2*calcLinearToDecibels(float32(velocity)/float32(127)) - sampleAttenuation - filterAttenuation
+		var velocityDecibels float32
+		if v.builtins&builtin_NoteOnVelocity != 0 {
+			velocityDecibels = 2 * calcLinearToDecibels(float32(velocity)/float32(127))
+		}
+		decibels := velocityDecibels - sampleAttenuation - filterAttenuation
 		v.noteGain = calcDecibelsToLinear(decibels)
 	} else {
 		v.noteGain = 0
@@ -109,10 +174,14 @@ func (v *voice) start(region regionPair, channel int32, key int32, velocity int3
 
 	v.modLfoToCutoff = region.GetModulationLfoToFilterCutoffFrequency()
 	v.modEnvToCutoff = region.GetModulationEnvelopeToFilterCutoffFrequency()
-	v.dynamicCutoff = v.modLfoToCutoff != 0 || v.modEnvToCutoff != 0
+	v.dynamicCutoff = v.modLfoToCutoff != 0 || v.modEnvToCutoff != 0 ||
+		v.hasModulator(gen_InitialFilterCutoffFrequency) ||
+		v.hasModulator(gen_InitialFilterQ) ||
+		v.hasModulator(gen_ModulationLfoToFilterCutoffFrequency) ||
+		v.hasModulator(gen_ModulationEnvelopeToFilterCutoffFrequency)
 
 	v.modLfoToVolume = region.GetModulationLfoToVolume()
-	v.dynamicVolume = v.modLfoToVolume > 0.05
+	v.dynamicVolume = v.modLfoToVolume > 0.05 || v.hasModulator(gen_ModulationLfoToVolume)
 
 	v.instrumentPan = calcClamp(region.GetPan(), -50, 50)
 	v.instrumentReverb = 0.01 * region.GetReverbEffectsSend()
@@ -122,14 +191,41 @@ func (v *voice) start(region regionPair, channel int32, key int32, velocity int3
 	v.modEnv.startByRegion(region, key, velocity)
 	v.vibLfo.startVibrato(region, key, velocity)
 	v.modLfo.startModulation(region, key, velocity)
-	v.oscillator.startByRegion(v.synthesizer.SoundFont.WaveData, region)
+	v.oscillator.startByRegion(window, region)
 	v.filter.clearBuffer()
 	v.filter.setLowPassFilter(v.cutoff, v.resonance)
 
 	v.smoothedCutoff = v.cutoff
 
+	v.linked = false
+
+	v.glideOffset = 0
+	v.glideRate = 0
+
 	v.voiceState = voice_Playing
 	v.voiceLength = 0
+	v.sostenuto = false
+
+	return nil
+}
+
+// Adds the other half of the stereo pair to the voice started by the start method.
+// If the sample data cannot be read, the voice plays only the first half.
+func (v *voice) startLinked(region regionPair, soundFont *SoundFont) {
+	region.modulation = &v.startOffsets
+
+	window, err := soundFont.getWaveWindow(region)
+	if err != nil {
+		return
+	}
+
+	v.linkedPan = calcClamp(region.GetPan(), -50, 50)
+
+	v.linkedOscillator.startByRegion(window, region)
+	v.linkedFilter.clearBuffer()
+	v.linkedFilter.setLowPassFilter(v.cutoff, v.resonance)
+
+	v.linked = true
 }
 
 func (v *voice) end() {
@@ -138,6 +234,17 @@ func (v *voice) end() {
 	}
 }
 
+// Releases the voice quickly, regardless of the hold pedal.
+func (v *voice) fadeOut() {
+	if v.voiceState != voice_Released {
+		v.modEnv.release()
+		v.oscillator.release()
+		v.linkedOscillator.release()
+		v.voiceState = voice_Released
+	}
+	v.volEnv.fadeOut(voice_FadeOutTime)
+}
+
 func (v *voice) kill() {
 	v.noteGain = 0
 }
@@ -151,24 +258,55 @@ func (v *voice) process() bool {
 
 	v.releaseIfNecessary(channelInfo)
 
-	if !v.volEnv.process(v.synthesizer.BlockSize) {
+	blockLength := v.synthesizer.blockLength
+
+	if !v.volEnv.process(blockLength) {
 		return false
 	}
 
-	v.modEnv.process(v.synthesizer.BlockSize)
+	v.modEnv.process(blockLength)
 	v.vibLfo.process()
 	v.modLfo.process()
 
-	vibPitchChange := (0.01*channelInfo.getModulation() + v.vibLfoToPitch) * v.vibLfo.value
-	modPitchChange := v.modLfoToPitch*v.modLfo.value + v.modEnvToPitch*v.modEnv.value
-	channelPitchChange := channelInfo.getTune() + channelInfo.getPitchBend()
-	pitch := float32(v.key) + vibPitchChange + modPitchChange + channelPitchChange
-	if !v.oscillator.process(v.block, pitch) {
+	if len(v.modulators) > 0 && v.modulatorSerial != channelInfo.modulatorSerial {
+		v.updateModulators(channelInfo)
+	}
+	offsets := &v.modulatorOffsets
+
+	vibLfoToPitch := v.vibLfoToPitch + 0.01*offsets[gen_VibratoLfoToPitch]
+	if v.builtins&builtin_Modulation != 0 {
+		vibLfoToPitch += 0.01 * channelInfo.getModulation()
+	}
+	modLfoToPitch := v.modLfoToPitch + 0.01*offsets[gen_ModulationLfoToPitch]
+	modEnvToPitch := v.modEnvToPitch + 0.01*offsets[gen_ModulationEnvelopeToPitch]
+
+	vibPitchChange := vibLfoToPitch * v.vibLfo.value
+	modPitchChange := modLfoToPitch*v.modLfo.value + modEnvToPitch*v.modEnv.value
+	channelPitchChange := channelInfo.getTune()
+	if v.builtins&builtin_PitchWheel != 0 {
+		channelPitchChange += channelInfo.getPitchBend()
+		if v.master != nil {
+			channelPitchChange += v.master.getPitchBend()
+		}
+	}
+	modulatorPitchChange := offsets[gen_CoarseTune] + 0.01*(offsets[gen_FineTune]+offsets[mod_InitialPitch])
+	pitch := v.getGlidingKey() + vibPitchChange + modPitchChange + channelPitchChange + modulatorPitchChange
+	if v.linked {
+		if !v.processLinked(pitch, blockLength) {
+			return false
+		}
+	} else if !v.oscillator.process(v.block[:blockLength], pitch) {
 		return false
 	}
 
+	if v.glideOffset != 0 {
+		v.updateGlide(blockLength)
+	}
+
 	if v.dynamicCutoff {
-		cents := float32(v.modLfoToCutoff)*v.modLfo.value + float32(v.modEnvToCutoff)*v.modEnv.value
+		modLfoToCutoff := float32(v.modLfoToCutoff) + offsets[gen_ModulationLfoToFilterCutoffFrequency]
+		modEnvToCutoff := float32(v.modEnvToCutoff) + offsets[gen_ModulationEnvelopeToFilterCutoffFrequency]
+		cents := modLfoToCutoff*v.modLfo.value + modEnvToCutoff*v.modEnv.value + offsets[gen_InitialFilterCutoffFrequency]
 		factor := calcCentsToMultiplyingFactor(cents)
 		newCutoff := factor * v.cutoff
 
@@ -183,62 +321,202 @@ func (v *voice) process() bool {
 			v.smoothedCutoff = newCutoff
 		}
 
-		v.filter.setLowPassFilter(v.smoothedCutoff, v.resonance)
+		resonance := v.resonance
+		if offsets[gen_InitialFilterQ] != 0 {
+			resonance *= calcDecibelsToLinear(0.1 * offsets[gen_InitialFilterQ])
+		}
+
+		v.filter.setLowPassFilter(v.smoothedCutoff, resonance)
+		if v.linked {
+			v.linkedFilter.setLowPassFilter(v.smoothedCutoff, resonance)
+		}
+	}
+	v.filter.process(v.block[:blockLength])
+	if v.linked {
+		v.linkedFilter.process(v.linkedBlock[:blockLength])
 	}
-	v.filter.process(v.block)
 
 	v.previousMixGainLeft = v.currentMixGainLeft
 	v.previousMixGainRight = v.currentMixGainRight
 	v.previousReverbSend = v.currentReverbSend
 	v.previousChorusSend = v.currentChorusSend
+	v.previousLinkedGainLeft = v.currentLinkedGainLeft
+	v.previousLinkedGainRight = v.currentLinkedGainRight
 
 	// According to the GM spec, the following value should be squared.
-	ve := channelInfo.getVolume() * channelInfo.getExpression()
+	// The volume of the MPE zone is controlled by the master channel.
+	volumeChannel := channelInfo
+	if v.master != nil {
+		volumeChannel = v.master
+	}
+	ve := float32(1)
+	if v.builtins&builtin_Volume != 0 {
+		ve *= volumeChannel.getVolume()
+	}
+	if v.builtins&builtin_Expression != 0 {
+		ve *= volumeChannel.getExpression()
+	}
 	channelGain := ve * ve
 
 	mixGain := v.noteGain * channelGain * v.volEnv.value
 	if v.dynamicVolume {
-		decibels := v.modLfoToVolume * v.modLfo.value
+		decibels := (v.modLfoToVolume + 0.1*offsets[gen_ModulationLfoToVolume]) * v.modLfo.value
 		mixGain *= calcDecibelsToLinear(decibels)
 	}
+	if offsets[gen_InitialAttenuation] != 0 || offsets[gen_InitialFilterQ] != 0 {
+		// The same scaling as the note gain is applied.
+		sampleAttenuation := 0.4 * 0.1 * offsets[gen_InitialAttenuation]
+		filterAttenuation := 0.5 * 0.1 * offsets[gen_InitialFilterQ]
+		mixGain *= calcDecibelsToLinear(-sampleAttenuation - filterAttenuation)
+	}
 
-	angle := float32(math.Pi/200) * (channelInfo.getPan() + v.instrumentPan + 50)
-	switch {
-	case angle <= 0:
-		v.currentMixGainLeft = mixGain
-		v.currentMixGainRight = 0
-	case angle >= halfPi:
-		v.currentMixGainLeft = 0
-		v.currentMixGainRight = mixGain
-	default:
-		v.currentMixGainLeft = mixGain * float32(math.Cos(float64(angle)))
-		v.currentMixGainRight = mixGain * float32(math.Sin(float64(angle)))
+	panOffset := 0.1 * offsets[gen_Pan]
+	if v.builtins&builtin_Pan != 0 {
+		panOffset += channelInfo.getPan()
+	}
+	v.currentMixGainLeft, v.currentMixGainRight = calcPanGains(mixGain, v.instrumentPan+panOffset)
+	if v.linked {
+		v.currentLinkedGainLeft, v.currentLinkedGainRight = calcPanGains(mixGain, v.linkedPan+panOffset)
 	}
 
-	v.currentReverbSend = calcClamp(channelInfo.getReverbSend()+v.instrumentReverb, 0, 1)
-	v.currentChorusSend = calcClamp(channelInfo.getChorusSend()+v.instrumentChorus, 0, 1)
+	reverbSend := v.instrumentReverb + 0.001*offsets[gen_ReverbEffectsSend]
+	if v.builtins&builtin_ReverbSend != 0 {
+		reverbSend += channelInfo.getReverbSend()
+	}
+	chorusSend := v.instrumentChorus + 0.001*offsets[gen_ChorusEffectsSend]
+	if v.builtins&builtin_ChorusSend != 0 {
+		chorusSend += channelInfo.getChorusSend()
+	}
+	v.currentReverbSend = calcClamp(reverbSend, 0, 1)
+	v.currentChorusSend = calcClamp(chorusSend, 0, 1)
 
 	if v.voiceLength == 0 {
 		v.previousMixGainLeft = v.currentMixGainLeft
 		v.previousMixGainRight = v.currentMixGainRight
 		v.previousReverbSend = v.currentReverbSend
 		v.previousChorusSend = v.currentChorusSend
+		v.previousLinkedGainLeft = v.currentLinkedGainLeft
+		v.previousLinkedGainRight = v.currentLinkedGainRight
 	}
 
-	v.voiceLength += v.synthesizer.BlockSize
+	v.voiceLength += blockLength
 
 	return true
 }
 
+// Renders both halves of the stereo pair with the same pitch, so that they never drift apart.
+// Each half has its own pitch ratio, since the root key, tuning and sample rate may differ.
+// The voice continues until both halves reach the end.
+func (v *voice) processLinked(pitch float32, blockLength int32) bool {
+	mainPlaying := v.oscillator.process(v.block[:blockLength], pitch)
+	linkedPlaying := v.linkedOscillator.process(v.linkedBlock[:blockLength], pitch)
+	if !mainPlaying && !linkedPlaying {
+		return false
+	}
+	if !mainPlaying {
+		clearBlock(v.block[:blockLength])
+	}
+	if !linkedPlaying {
+		clearBlock(v.linkedBlock[:blockLength])
+	}
+	return true
+}
+
+func clearBlock(block []float32) {
+	for i := range block {
+		block[i] = 0
+	}
+}
+
+func (v *voice) setupModulators(region regionPair, channelInfo *channel) {
+	v.modulators = v.modulators[:0]
+	v.builtins = 0
+	for i := 0; i < len(v.startOffsets); i++ {
+		v.startOffsets[i] = 0
+		v.modulatorOffsets[i] = 0
+	}
+
+	// The instrument modulators supersede the identical default ones,
+	// while the preset modulators are added to them.
+	for _, def := range defaultModulators {
+		if containsIdenticalModulator(region.instrument.Modulators, def.modulator) {
+			continue
+		}
+		if def.builtin != 0 {
+			v.builtins |= def.builtin
+			continue
+		}
+		if v.synthesizer.EnableDefaultModulators {
+			v.addModulator(def.modulator, channelInfo)
+		}
+	}
+	for _, mod := range region.instrument.Modulators {
+		v.addModulator(mod, channelInfo)
+	}
+	for _, mod := range region.preset.Modulators {
+		v.addModulator(mod, channelInfo)
+	}
+	if v.master != nil {
+		v.addModulator(mpe_TimbreModulator, channelInfo)
+	}
+	v.modulatorSerial = channelInfo.modulatorSerial
+}
+
+func (v *voice) addModulator(mod Modulator, channelInfo *channel) {
+	destination := mod.DestinationGenerator
+	if int(destination) >= len(v.startOffsets) {
+		return
+	}
+
+	value := mod.getValue(v, channelInfo)
+
+	if mod.isStatic() {
+		v.startOffsets[destination] += value
+		return
+	}
+
+	// The non-real-time generators can be modulated only at the note-on.
+	if isRealTimeGenerator(destination) {
+		v.modulators = append(v.modulators, mod)
+		v.modulatorOffsets[destination] += value
+	} else {
+		v.startOffsets[destination] += value
+	}
+}
+
+func (v *voice) updateModulators(channelInfo *channel) {
+	v.modulatorSerial = channelInfo.modulatorSerial
+	for _, mod := range v.modulators {
+		v.modulatorOffsets[mod.DestinationGenerator] = 0
+	}
+	for _, mod := range v.modulators {
+		v.modulatorOffsets[mod.DestinationGenerator] += mod.getValue(v, channelInfo)
+	}
+}
+
+func (v *voice) hasModulator(destination uint16) bool {
+	for _, mod := range v.modulators {
+		if mod.DestinationGenerator == destination {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *voice) releaseIfNecessary(channelInfo *channel) {
 	if v.voiceLength < v.synthesizer.minimumVoiceDuration {
 		return
 	}
 
-	if v.voiceState == voice_ReleaseRequested && !channelInfo.holdPedal {
+	sustained := channelInfo.holdPedal || (channelInfo.sostenuto && v.sostenuto)
+	if v.master != nil && v.master.holdPedal {
+		sustained = true
+	}
+	if v.voiceState == voice_ReleaseRequested && !sustained {
 		v.volEnv.release()
 		v.modEnv.release()
 		v.oscillator.release()
+		v.linkedOscillator.release()
 
 		v.voiceState = voice_Released
 	}
@@ -1,11 +1,14 @@
 package meltysynth
 
-import "math"
+import "runtime"
 
 type voiceCollection struct {
 	synthesizer      *Synthesizer
 	voices           []*voice
 	activeVoiceCount int32
+
+	// Started on the first parallel block.
+	workers *renderWorkerPool
 }
 
 func newVoiceCollection(s *Synthesizer, maxActiveVoiceCount int32) *voiceCollection {
@@ -21,7 +24,7 @@ func newVoiceCollection(s *Synthesizer, maxActiveVoiceCount int32) *voiceCollect
 	return result
 }
 
-func (vc *voiceCollection) requestNew(region *InstrumentRegion, channel int32) *voice {
+func (vc *voiceCollection) requestNew(region *InstrumentRegion, channel int32, key int32) *voice {
 	// If an exclusive class is assigned to the region, find a voice with the same class.
 	// If found, reuse it to avoid playing multiple voices with the same class at a time.
 	exclusiveClass := region.GetExclusiveClass()
@@ -34,6 +37,19 @@ func (vc *voiceCollection) requestNew(region *InstrumentRegion, channel int32) *
 		}
 	}
 
+	// If the channel has reached its limit, one of its own voices is reused.
+	limit := vc.synthesizer.channelVoiceLimits[channel]
+	if limit > 0 && vc.countVoices(stealScope_Channel, channel) >= limit {
+		return vc.findVictim(stealScope_Channel, channel, key)
+	}
+
+	// The reserved voices can only be used by the percussion channels.
+	reserved := vc.synthesizer.percussionReservedVoices
+	if reserved > 0 && !vc.synthesizer.channels[channel].isPercussionChannel &&
+		vc.countVoices(stealScope_NonPercussion, channel) >= int32(len(vc.voices))-reserved {
+		return vc.findVictim(stealScope_NonPercussion, channel, key)
+	}
+
 	// If the number of active voices is less than the limit, use a free one.
 	if int(vc.activeVoiceCount) < len(vc.voices) {
 		free := vc.voices[vc.activeVoiceCount]
@@ -42,27 +58,17 @@ func (vc *voiceCollection) requestNew(region *InstrumentRegion, channel int32) *
 	}
 
 	// Too many active voices...
-	// Find one which has the lowest priority.
-	var candidate *voice = nil
-	var lowestPriority float32 = math.MaxFloat32
-	for i := int32(0); i < vc.activeVoiceCount; i++ {
-		voice := vc.voices[i]
-		priority := voice.getPriority()
-		if priority < lowestPriority {
-			lowestPriority = priority
-			candidate = voice
-		} else if priority == lowestPriority {
-			// Same priority...
-			// The older one should be more suitable for reuse.
-			if voice.voiceLength > candidate.voiceLength {
-				candidate = voice
-			}
-		}
-	}
-	return candidate
+	// Find one according to the policy.
+	return vc.findVictim(stealScope_All, channel, key)
 }
 
 func (vc *voiceCollection) process() {
+	workerCount := int(vc.synthesizer.RenderWorkerCount)
+	if workerCount > 1 && vc.activeVoiceCount > 1 {
+		vc.processParallel(workerCount)
+		return
+	}
+
 	var i int32
 
 	for {
@@ -82,6 +88,92 @@ func (vc *voiceCollection) process() {
 	}
 }
 
+// Processes the voices on multiple goroutines.
+// Since each voice only reads the shared states, the voices are processed independently,
+// and then the finished ones are removed in the same order as the serial path.
+// The mixing is done serially by the synthesizer, so the output is identical to the serial rendering.
+func (vc *voiceCollection) processParallel(workerCount int) {
+	if vc.workers == nil || vc.workers.workerCount != workerCount {
+		if vc.workers != nil {
+			vc.workers.stop()
+		}
+		vc.workers = newRenderWorkerPool(workerCount)
+	}
+
+	vc.workers.process(vc.voices[0:vc.activeVoiceCount])
+
+	var i int32
+
+	for i < vc.activeVoiceCount {
+		if vc.voices[i].playing {
+			i++
+		} else {
+			vc.activeVoiceCount--
+
+			tmp := vc.voices[i]
+			vc.voices[i] = vc.voices[vc.activeVoiceCount]
+			vc.voices[vc.activeVoiceCount] = tmp
+		}
+	}
+}
+
 func (vc *voiceCollection) clear() {
 	vc.activeVoiceCount = 0
 }
+
+// The goroutines which are kept running to process the voices of each block.
+// The calling goroutine also processes a part of the voices, so workerCount - 1 goroutines are started.
+// The workers only hold the channels, so they are stopped when the pool is garbage collected.
+type renderWorkerPool struct {
+	workerCount int
+	jobs        chan []*voice
+	done        chan struct{}
+}
+
+func newRenderWorkerPool(workerCount int) *renderWorkerPool {
+	result := &renderWorkerPool{
+		workerCount: workerCount,
+		jobs:        make(chan []*voice, workerCount),
+		done:        make(chan struct{}, workerCount),
+	}
+	for i := 1; i < workerCount; i++ {
+		go runRenderWorker(result.jobs, result.done)
+	}
+	runtime.SetFinalizer(result, (*renderWorkerPool).stop)
+
+	return result
+}
+
+func runRenderWorker(jobs <-chan []*voice, done chan<- struct{}) {
+	for voices := range jobs {
+		processVoices(voices)
+		done <- struct{}{}
+	}
+}
+
+func processVoices(voices []*voice) {
+	for _, voice := range voices {
+		voice.playing = voice.process()
+	}
+}
+
+func (pool *renderWorkerPool) process(voices []*voice) {
+	count := len(voices)
+	workerCount := pool.workerCount
+	if workerCount > count {
+		workerCount = count
+	}
+
+	for w := 1; w < workerCount; w++ {
+		pool.jobs <- voices[count*w/workerCount : count*(w+1)/workerCount]
+	}
+	processVoices(voices[0 : count/workerCount])
+	for w := 1; w < workerCount; w++ {
+		<-pool.done
+	}
+}
+
+func (pool *renderWorkerPool) stop() {
+	runtime.SetFinalizer(pool, nil)
+	close(pool.jobs)
+}
@@ -0,0 +1,111 @@
+package meltysynth
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func renderParallelTest(t *testing.T, workerCount int32) []float32 {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.MaximumPolyphony = 128
+		settings.RenderWorkerCount = workerCount
+	}, 0, 128<<16)
+
+	left := make([]float32, 44100)
+	right := make([]float32, 44100)
+	for i := int32(0); i < 100; i++ {
+		channel := i % 16
+		synthesizer.ProcessMidiMessageAt(i*400, channel, 0x90, 30+i%60, 40+i%80)
+		synthesizer.ProcessMidiMessageAt(i*400+300, channel, 0xB0, 0x0A, i%128)
+		if i%3 == 0 {
+			// Some voices finish in the middle to change the order of the voices.
+			synthesizer.ProcessMidiMessageAt(i*400+1000, channel, 0x80, 30+i%60, 0)
+		}
+	}
+	synthesizer.Render(left, right)
+
+	return append(left, right...)
+}
+
+func TestVoiceCollection_Parallel(t *testing.T) {
+	expected := renderParallelTest(t, 1)
+	for _, workerCount := range []int32{2, 3, 8} {
+		actual := renderParallelTest(t, workerCount)
+		for i := range expected {
+			if math.Float32bits(actual[i]) != math.Float32bits(expected[i]) {
+				t.Fatalf("the output with %d workers differs at %d", workerCount, i)
+			}
+		}
+	}
+}
+
+// Waits for the finalizers of the unreachable worker pools, until the number of goroutines stops decreasing.
+func countGoroutinesAfterGC() int {
+	count := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		next := runtime.NumGoroutine()
+		if next == count {
+			break
+		}
+		count = next
+	}
+	return count
+}
+
+func TestVoiceCollection_WorkerPool(t *testing.T) {
+	before := countGoroutinesAfterGC()
+
+	func() {
+		synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+			settings.RenderWorkerCount = 4
+		}, 0)
+		for i := int32(0); i < 8; i++ {
+			synthesizer.NoteOn(0, 60+i, 100)
+		}
+
+		// The workers are started once and reused for every block.
+		left := make([]float32, 4096)
+		right := make([]float32, 4096)
+		synthesizer.Render(left, right)
+		if count := runtime.NumGoroutine(); count != before+3 {
+			t.Errorf("expected %d goroutines, but got %d", before+3, count)
+		}
+		synthesizer.Render(left, right)
+		if count := runtime.NumGoroutine(); count != before+3 {
+			t.Errorf("expected %d goroutines, but got %d", before+3, count)
+		}
+	}()
+
+	// The workers are stopped when the synthesizer is no longer used.
+	if count := countGoroutinesAfterGC(); count > before {
+		t.Errorf("the workers were not stopped: %d goroutines remain", count-before)
+	}
+}
+
+func benchmarkVoiceCollection(b *testing.B, workerCount int32) {
+	synthesizer := createTestSynthesizer(b, func(settings *SynthesizerSettings) {
+		settings.MaximumPolyphony = 128
+		settings.RenderWorkerCount = workerCount
+	}, 0)
+	for i := int32(0); i < 128; i++ {
+		synthesizer.NoteOn(i%16, i, 100)
+	}
+	left := make([]float32, 1024)
+	right := make([]float32, 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		synthesizer.Render(left, right)
+	}
+}
+
+func BenchmarkVoiceCollection_Serial(b *testing.B) {
+	benchmarkVoiceCollection(b, 1)
+}
+
+func BenchmarkVoiceCollection_Parallel(b *testing.B) {
+	benchmarkVoiceCollection(b, 4)
+}
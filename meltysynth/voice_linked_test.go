@@ -0,0 +1,128 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+func createStereoTestSoundFont(t *testing.T, link bool) *SoundFont {
+	builder := NewSoundFontBuilder("stereo")
+	left := builder.AddSampleFloat32("left", createSineWave(1000, 100), 44100, 60)
+	right := builder.AddSampleFloat32("right", createSineWave(1000, 50), 44100, 60)
+	if link {
+		if err := builder.LinkSamples(left, right); err != nil {
+			t.Fatal(err)
+		}
+	}
+	instrument := builder.AddInstrument("stereo")
+	for _, sample := range []*SampleHeader{left, right} {
+		region := instrument.AddRegion(sample)
+		region.SetGenerator(GeneratorSampleModes, int16(loop_Continuous))
+	}
+	instrument.Regions[0].SetGenerator(GeneratorPan, -500)
+	instrument.Regions[1].SetGenerator(GeneratorPan, 500)
+	preset := builder.AddPreset("stereo", 0, 0)
+	preset.AddRegion(instrument)
+	soundFont, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return soundFont
+}
+
+func TestVoice_LinkedStereoSample(t *testing.T) {
+	settings := NewSynthesizerSettings(44100)
+	settings.EnableReverbAndChorus = false
+
+	unlinked, err := NewSynthesizer(createStereoTestSoundFont(t, false), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlinked.NoteOn(0, 60, 100)
+	if unlinked.voices.activeVoiceCount != 2 {
+		t.Fatalf("expected 2 voices for the unlinked samples, but got %d", unlinked.voices.activeVoiceCount)
+	}
+
+	synthesizer, err := NewSynthesizer(createStereoTestSoundFont(t, true), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesizer.NoteOn(0, 60, 100)
+	if synthesizer.voices.activeVoiceCount != 1 {
+		t.Fatalf("expected 1 voice for the linked samples, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+	if !synthesizer.voices.voices[0].linked {
+		t.Fatal("the voice should play both halves of the stereo sample")
+	}
+
+	// Each half keeps its own pan, so the result should be the same as the unlinked voices.
+	expectedLeft := make([]float32, 4096)
+	expectedRight := make([]float32, 4096)
+	unlinked.Render(expectedLeft, expectedRight)
+	left := make([]float32, 4096)
+	right := make([]float32, 4096)
+	synthesizer.Render(left, right)
+	for i := 0; i < len(left); i++ {
+		if math.Abs(float64(left[i]-expectedLeft[i])) > 1.0e-6 || math.Abs(float64(right[i]-expectedRight[i])) > 1.0e-6 {
+			t.Fatalf("the output differs at %d", i)
+		}
+	}
+
+	// Both halves are stopped together.
+	synthesizer.NoteOffAll(true)
+	synthesizer.Render(left, right)
+	if synthesizer.voices.activeVoiceCount != 0 {
+		t.Errorf("expected no active voice, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+}
+
+func TestSoundFontBuilder_LinkSamples(t *testing.T) {
+	soundFont := createStereoTestSoundFont(t, true)
+	left := soundFont.SampleHeaders[0]
+	right := soundFont.SampleHeaders[1]
+	if left.SampleType != sampleType_Left || right.SampleType != sampleType_Right {
+		t.Error("the sample types should be set")
+	}
+	if left.Link != 1 || right.Link != 0 {
+		t.Error("the samples should refer to each other")
+	}
+
+	builder := NewSoundFontBuilder("invalid")
+	sample := builder.AddSampleFloat32("short", createSineWave(100, 100), 44100, 60)
+	other := builder.AddSampleFloat32("long", createSineWave(200, 100), 44100, 60)
+	if builder.LinkSamples(sample, other) == nil {
+		t.Error("the samples with different lengths should not be linked")
+	}
+}
+
+func TestVoice_LinkedStereoSample_Tuning(t *testing.T) {
+	settings := NewSynthesizerSettings(44100)
+	settings.EnableReverbAndChorus = false
+
+	// The halves of the pair have different sample rates and tunings.
+	render := func(link bool) ([]float32, []float32) {
+		soundFont := createStereoTestSoundFont(t, link)
+		sample := soundFont.SampleHeaders[1]
+		sample.SampleRate = 22050
+		sample.OriginalPitch = 48
+		sample.PitchCorrection = 30
+
+		synthesizer, err := NewSynthesizer(soundFont, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		synthesizer.NoteOn(0, 60, 100)
+		left := make([]float32, 4096)
+		right := make([]float32, 4096)
+		synthesizer.Render(left, right)
+		return left, right
+	}
+
+	expectedLeft, expectedRight := render(false)
+	left, right := render(true)
+	for i := 0; i < len(left); i++ {
+		if math.Abs(float64(left[i]-expectedLeft[i])) > 1.0e-6 || math.Abs(float64(right[i]-expectedRight[i])) > 1.0e-6 {
+			t.Fatalf("the linked half is out of tune at %d", i)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package meltysynth
+
+import "math"
+
+// Specifies which voice is reused when no free voice is available.
+type VoiceStealingPolicy int32
+
+const (
+	VoiceStealingPriority      VoiceStealingPolicy = 0 // The voice in the latest envelope stage, preferring the older one.
+	VoiceStealingOldest        VoiceStealingPolicy = 1
+	VoiceStealingQuietest      VoiceStealingPolicy = 2
+	VoiceStealingReleasedFirst VoiceStealingPolicy = 3 // The voices whose keys are released are taken first, then the same as VoiceStealingPriority.
+	VoiceStealingSameKeyFirst  VoiceStealingPolicy = 4 // The voice playing the same key on the same channel is taken first.
+)
+
+func (policy VoiceStealingPolicy) String() string {
+	switch policy {
+	case VoiceStealingPriority:
+		return "priority"
+	case VoiceStealingOldest:
+		return "oldest"
+	case VoiceStealingQuietest:
+		return "quietest"
+	case VoiceStealingReleasedFirst:
+		return "released-first"
+	case VoiceStealingSameKeyFirst:
+		return "same-key-first"
+	default:
+		return "unknown"
+	}
+}
+
+// The voices which can be stolen by a new voice.
+const (
+	stealScope_All           int32 = 0
+	stealScope_Channel       int32 = 1 // Only the voices of the same channel, for the per-channel limit.
+	stealScope_NonPercussion int32 = 2 // Only the voices of the non-percussion channels, for the reserved voices.
+)
+
+func (vc *voiceCollection) isInScope(voice *voice, scope int32, channel int32) bool {
+	switch scope {
+	case stealScope_Channel:
+		return voice.channel == channel
+	case stealScope_NonPercussion:
+		return !vc.synthesizer.channels[voice.channel].isPercussionChannel
+	default:
+		return true
+	}
+}
+
+func (vc *voiceCollection) countVoices(scope int32, channel int32) int32 {
+	var count int32
+	for i := int32(0); i < vc.activeVoiceCount; i++ {
+		if vc.isInScope(vc.voices[i], scope, channel) {
+			count++
+		}
+	}
+	return count
+}
+
+// Finds the voice to be stolen according to the policy, or returns nil if no voice is in the scope.
+func (vc *voiceCollection) findVictim(scope int32, channel int32, key int32) *voice {
+	switch vc.synthesizer.VoiceStealingPolicy {
+	case VoiceStealingOldest:
+		return vc.findVictimBy(scope, channel, func(v *voice) float32 { return -float32(v.voiceLength) })
+	case VoiceStealingQuietest:
+		return vc.findVictimBy(scope, channel, getLoudness)
+	case VoiceStealingReleasedFirst:
+		// The voices whose keys have been released are taken, even if they are held by the pedal.
+		candidate := vc.findVictimBy(scope, channel, func(v *voice) float32 {
+			if v.voiceState == voice_Playing {
+				return math.MaxFloat32
+			}
+			return v.getPriority()
+		})
+		if candidate != nil && candidate.voiceState != voice_Playing {
+			return candidate
+		}
+	case VoiceStealingSameKeyFirst:
+		candidate := vc.findVictimBy(scope, channel, func(v *voice) float32 {
+			if v.channel != channel || v.key != key {
+				return math.MaxFloat32
+			}
+			return -float32(v.voiceLength)
+		})
+		if candidate != nil && candidate.channel == channel && candidate.key == key {
+			return candidate
+		}
+	}
+
+	return vc.findVictimBy(scope, channel, (*voice).getPriority)
+}
+
+// Finds the voice with the lowest score. If the scores are the same, the older one is taken.
+func (vc *voiceCollection) findVictimBy(scope int32, channel int32, score func(v *voice) float32) *voice {
+	var candidate *voice = nil
+	var lowestScore float32 = math.MaxFloat32
+	for i := int32(0); i < vc.activeVoiceCount; i++ {
+		voice := vc.voices[i]
+		if !vc.isInScope(voice, scope, channel) {
+			continue
+		}
+		value := score(voice)
+		if candidate == nil || value < lowestScore {
+			lowestScore = value
+			candidate = voice
+		} else if value == lowestScore {
+			if voice.voiceLength > candidate.voiceLength {
+				candidate = voice
+			}
+		}
+	}
+	return candidate
+}
+
+// The voices just started have not been rendered yet, so they are protected from being stolen as the quietest.
+func getLoudness(v *voice) float32 {
+	if v.voiceLength == 0 {
+		return math.MaxFloat32
+	}
+	return v.noteGain * v.volEnv.value
+}
@@ -0,0 +1,90 @@
+package meltysynth
+
+import "testing"
+
+// Plays the keys one by one, so that the earlier ones become older.
+func playStealingTestNotes(synthesizer *Synthesizer, channel int32, keys ...int32) {
+	left := make([]float32, 64)
+	right := make([]float32, 64)
+	for _, key := range keys {
+		synthesizer.NoteOn(channel, key, 100)
+		synthesizer.Render(left, right)
+	}
+}
+
+func TestVoiceStealing_Policies(t *testing.T) {
+	tests := []struct {
+		policy  VoiceStealingPolicy
+		prepare func(synthesizer *Synthesizer)
+		stolen  int32
+	}{
+		{VoiceStealingOldest, func(s *Synthesizer) {}, 40},
+		{VoiceStealingSameKeyFirst, func(s *Synthesizer) {}, 43},
+		{VoiceStealingReleasedFirst, func(s *Synthesizer) {
+			s.NoteOff(0, 45)
+		}, 45},
+		{VoiceStealingQuietest, func(s *Synthesizer) {
+			for i := int32(0); i < s.voices.activeVoiceCount; i++ {
+				if s.voices.voices[i].key == 46 {
+					s.voices.voices[i].noteGain *= 0.1
+				}
+			}
+		}, 46},
+	}
+
+	for _, test := range tests {
+		synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+			settings.MaximumPolyphony = 8
+			settings.VoiceStealingPolicy = test.policy
+		}, 0, 128<<16)
+		playStealingTestNotes(synthesizer, 0, 40, 41, 42, 43, 44, 45, 46, 47)
+		test.prepare(synthesizer)
+		synthesizer.NoteOn(0, 43, 100)
+
+		if synthesizer.voices.activeVoiceCount != 8 {
+			t.Fatalf("%v: expected 8 active voices, but got %d", test.policy, synthesizer.voices.activeVoiceCount)
+		}
+		for key := int32(40); key < 48; key++ {
+			if (findActiveVoice(synthesizer, 0, key) != nil) == (key == test.stolen && key != 43) {
+				t.Errorf("%v: the voice of the key %d should be stolen", test.policy, test.stolen)
+				break
+			}
+		}
+	}
+}
+
+func TestVoiceStealing_ChannelLimit(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.MaximumPolyphony = 8
+		settings.ChannelVoiceLimits[0] = 2
+	}, 0, 128<<16)
+	playStealingTestNotes(synthesizer, 0, 40, 41, 42, 43)
+	playStealingTestNotes(synthesizer, 1, 40)
+	if synthesizer.voices.countVoices(stealScope_Channel, 0) != 2 {
+		t.Errorf("expected 2 voices on the channel 0, but got %d", synthesizer.voices.countVoices(stealScope_Channel, 0))
+	}
+	if findActiveVoice(synthesizer, 0, 43) == nil || findActiveVoice(synthesizer, 0, 40) != nil {
+		t.Error("the older voices of the channel should be stolen")
+	}
+	if findActiveVoice(synthesizer, 1, 40) == nil {
+		t.Error("the other channels should not be affected")
+	}
+}
+
+func TestVoiceStealing_PercussionReservedVoices(t *testing.T) {
+	synthesizer := createTestSynthesizer(t, func(settings *SynthesizerSettings) {
+		settings.MaximumPolyphony = 8
+		settings.PercussionReservedVoices = 2
+	}, 0, 128<<16)
+	playStealingTestNotes(synthesizer, 0, 40, 41, 42, 43, 44, 45, 46, 47)
+	if synthesizer.voices.activeVoiceCount != 6 {
+		t.Fatalf("expected 6 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+	playStealingTestNotes(synthesizer, synth_percussionChannel, 36, 38)
+	if synthesizer.voices.activeVoiceCount != 8 {
+		t.Fatalf("expected 8 active voices, but got %d", synthesizer.voices.activeVoiceCount)
+	}
+	if findActiveVoice(synthesizer, synth_percussionChannel, 36) == nil || findActiveVoice(synthesizer, synth_percussionChannel, 38) == nil {
+		t.Error("the percussion channel should use the reserved voices")
+	}
+}
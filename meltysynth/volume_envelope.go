@@ -51,6 +51,13 @@ func (env *volumeEnvelope) release() {
 	env.releaseLevel = env.value
 }
 
+// Restarts the release from the current level with the given time,
+// unless the release of the region is faster.
+func (env *volumeEnvelope) fadeOut(time float32) {
+	env.releaseSlope = math.Min(env.releaseSlope, -9.226/float64(time))
+	env.release()
+}
+
 func (env *volumeEnvelope) process(sampleCount int32) bool {
 	env.processedSampleCount += sampleCount
 
@@ -0,0 +1,85 @@
+package meltysynth
+
+// The Vorbis packets are packed from the least significant bit of each byte.
+// Reading beyond the end of the packet is not an error in the Vorbis spec,
+// so the reader returns zeros and sets the end-of-packet flag instead.
+
+type vorbisBitReader struct {
+	data     []byte
+	position int
+	buffer   uint64
+	bitCount uint
+	eop      bool
+}
+
+func newVorbisBitReader(data []byte) *vorbisBitReader {
+	result := new(vorbisBitReader)
+	result.data = data
+	return result
+}
+
+func (br *vorbisBitReader) fill() {
+	for br.bitCount <= 56 && br.position < len(br.data) {
+		br.buffer |= uint64(br.data[br.position]) << br.bitCount
+		br.position++
+		br.bitCount += 8
+	}
+}
+
+func (br *vorbisBitReader) readBits(count uint) uint32 {
+	if count == 0 {
+		return 0
+	}
+
+	if br.bitCount < count {
+		br.fill()
+		if br.bitCount < count {
+			br.eop = true
+			br.buffer = 0
+			br.bitCount = 0
+			return 0
+		}
+	}
+
+	value := uint32(br.buffer & (1<<count - 1))
+	br.buffer >>= count
+	br.bitCount -= count
+
+	return value
+}
+
+func (br *vorbisBitReader) readFlag() bool {
+	return br.readBits(1) != 0
+}
+
+// Returns the next bits without consuming them, and the number of the available bits.
+func (br *vorbisBitReader) peekBits(count uint) (uint32, uint) {
+	if br.bitCount < count {
+		br.fill()
+	}
+
+	available := count
+	if br.bitCount < available {
+		available = br.bitCount
+	}
+
+	return uint32(br.buffer & (1<<count - 1)), available
+}
+
+func (br *vorbisBitReader) remainingBits() int64 {
+	return 8*int64(len(br.data)-br.position) + int64(br.bitCount)
+}
+
+func (br *vorbisBitReader) skipBits(count uint) {
+	br.buffer >>= count
+	br.bitCount -= count
+}
+
+func ilog(x int32) uint {
+	var result uint
+	for x > 0 {
+		result++
+		x >>= 1
+	}
+	return result
+}
@@ -0,0 +1,295 @@
+package meltysynth
+
+import (
+	"errors"
+	"math"
+)
+
+const vorbis_CodebookTableBits uint = 10
+
+type vorbisCodebook struct {
+	dimensions int32
+	entries    int32
+
+	// The short codewords are decoded by table lookup,
+	// and the long ones are decoded by walking the tree.
+	tableEntries []int32
+	tableLengths []uint8
+	tree         []int32
+
+	// The VQ vectors of all the entries, or nil if the codebook has no lookup table.
+	vectors []float32
+}
+
+func readVorbisCodebook(br *vorbisBitReader) (*vorbisCodebook, error) {
+	if br.readBits(24) != 0x564342 {
+		return nil, errors.New("the vorbis codebook has an invalid sync pattern")
+	}
+
+	result := new(vorbisCodebook)
+	result.dimensions = int32(br.readBits(16))
+	result.entries = int32(br.readBits(24))
+
+	lengths := make([]uint8, result.entries)
+
+	if br.readFlag() {
+		// Ordered.
+		currentLength := uint8(br.readBits(5) + 1)
+		currentEntry := int32(0)
+		for currentEntry < result.entries {
+			number := int32(br.readBits(ilog(result.entries - currentEntry)))
+			if br.eop {
+				return nil, errors.New("the vorbis codebook is truncated")
+			}
+			if currentEntry+number > result.entries {
+				return nil, errors.New("the vorbis codebook has too many entries")
+			}
+			for i := currentEntry; i < currentEntry+number; i++ {
+				lengths[i] = currentLength
+			}
+			currentEntry += number
+			currentLength++
+		}
+	} else {
+		sparse := br.readFlag()
+		for i := int32(0); i < result.entries; i++ {
+			if !sparse || br.readFlag() {
+				lengths[i] = uint8(br.readBits(5) + 1)
+			}
+		}
+	}
+
+	lookupType := br.readBits(4)
+	switch lookupType {
+	case 0:
+	case 1, 2:
+		if result.dimensions == 0 || int64(result.entries)*int64(result.dimensions) > math.MaxInt32 {
+			return nil, errors.New("the vorbis codebook has an invalid dimension")
+		}
+
+		minimum := unpackVorbisFloat(br.readBits(32))
+		delta := unpackVorbisFloat(br.readBits(32))
+		valueBits := uint(br.readBits(4) + 1)
+		sequenceP := br.readFlag()
+
+		var lookupValues int32
+		if lookupType == 1 {
+			lookupValues = calcLookup1Values(result.entries, result.dimensions)
+		} else {
+			lookupValues = result.entries * result.dimensions
+		}
+		if int64(lookupValues)*int64(valueBits) > br.remainingBits() {
+			return nil, errors.New("the vorbis codebook is truncated")
+		}
+
+		multiplicands := make([]uint32, lookupValues)
+		for i := int32(0); i < lookupValues; i++ {
+			multiplicands[i] = br.readBits(valueBits)
+		}
+
+		result.vectors = make([]float32, result.entries*result.dimensions)
+		for entry := int32(0); entry < result.entries; entry++ {
+			last := float32(0)
+			indexDivisor := int32(1)
+			for i := int32(0); i < result.dimensions; i++ {
+				var offset int32
+				if lookupType == 1 {
+					offset = (entry / indexDivisor) % lookupValues
+					indexDivisor *= lookupValues
+				} else {
+					offset = entry*result.dimensions + i
+				}
+				value := float32(multiplicands[offset])*delta + minimum + last
+				if sequenceP {
+					last = value
+				}
+				result.vectors[entry*result.dimensions+i] = value
+			}
+		}
+	default:
+		return nil, errors.New("the vorbis codebook has an invalid lookup type")
+	}
+
+	if br.eop {
+		return nil, errors.New("the vorbis codebook is truncated")
+	}
+
+	err := result.buildHuffman(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (cb *vorbisCodebook) buildHuffman(lengths []uint8) error {
+	cb.tableEntries = make([]int32, 1<<vorbis_CodebookTableBits)
+	cb.tableLengths = make([]uint8, 1<<vorbis_CodebookTableBits)
+	cb.tree = make([]int32, 2)
+
+	used := 0
+	last := 0
+	for i := 0; i < len(lengths); i++ {
+		if lengths[i] > 0 {
+			used++
+			last = i
+		}
+	}
+
+	if used == 0 {
+		return nil
+	}
+
+	// A codebook with a single entry is allowed.
+	// In this case, any bit decodes the entry.
+	if used == 1 {
+		cb.tree[0] = -int32(last) - 1
+		cb.tree[1] = -int32(last) - 1
+		for i := 0; i < len(cb.tableEntries); i++ {
+			cb.tableEntries[i] = int32(last)
+			cb.tableLengths[i] = 1
+		}
+		return nil
+	}
+
+	// The codewords are assigned in the entry order, using the lowest available leaf.
+	var available [33]uint32
+	first := true
+	for entry := 0; entry < len(lengths); entry++ {
+		length := int(lengths[entry])
+		if length == 0 {
+			continue
+		}
+		if length > 32 {
+			return errors.New("the vorbis codebook has too long codeword")
+		}
+
+		var code uint32
+		if first {
+			code = 0
+			for i := 1; i <= length; i++ {
+				available[i] = 1 << (32 - i)
+			}
+			first = false
+		} else {
+			z := length
+			for z > 0 && available[z] == 0 {
+				z--
+			}
+			if z == 0 {
+				return errors.New("the vorbis codebook is overspecified")
+			}
+			code = available[z]
+			available[z] = 0
+			for y := length; y > z; y-- {
+				available[y] = code + (1 << (32 - y))
+			}
+		}
+
+		cb.addCodeword(int32(entry), code>>(32-length), length)
+	}
+
+	return nil
+}
+
+func (cb *vorbisCodebook) addCodeword(entry int32, code uint32, length int) {
+	// The first bit of the codeword is read first, which is the least significant bit in the stream.
+	var reversed uint32
+	for i := 0; i < length; i++ {
+		reversed |= ((code >> (length - 1 - i)) & 1) << i
+	}
+
+	if length <= int(vorbis_CodebookTableBits) {
+		for i := reversed; i < uint32(len(cb.tableEntries)); i += 1 << length {
+			cb.tableEntries[i] = entry
+			cb.tableLengths[i] = uint8(length)
+		}
+	}
+
+	node := int32(0)
+	for i := 0; i < length; i++ {
+		bit := int32((reversed >> i) & 1)
+		if i == length-1 {
+			cb.tree[node+bit] = -entry - 1
+		} else {
+			next := cb.tree[node+bit]
+			if next <= 0 {
+				next = int32(len(cb.tree))
+				cb.tree = append(cb.tree, 0, 0)
+				cb.tree[node+bit] = next
+			}
+			node = next
+		}
+	}
+}
+
+// Returns the entry number, or -1 if the end of the packet is reached.
+func (cb *vorbisCodebook) decodeScalar(br *vorbisBitReader) int32 {
+	bits, available := br.peekBits(vorbis_CodebookTableBits)
+	length := uint(cb.tableLengths[bits])
+	if length != 0 && length <= available {
+		br.skipBits(length)
+		return cb.tableEntries[bits]
+	}
+
+	node := int32(0)
+	for {
+		bit := int32(br.readBits(1))
+		if br.eop {
+			return -1
+		}
+		next := cb.tree[node+bit]
+		if next < 0 {
+			return -next - 1
+		}
+		if next == 0 {
+			// Undefined codeword.
+			br.eop = true
+			return -1
+		}
+		node = next
+	}
+}
+
+// Returns the VQ vector of the decoded entry, or nil if the end of the packet is reached.
+func (cb *vorbisCodebook) decodeVector(br *vorbisBitReader) []float32 {
+	entry := cb.decodeScalar(br)
+	if entry < 0 || cb.vectors == nil {
+		return nil
+	}
+	return cb.vectors[entry*cb.dimensions : (entry+1)*cb.dimensions]
+}
+
+func unpackVorbisFloat(x uint32) float32 {
+	mantissa := float64(x & 0x1FFFFF)
+	exponent := int((x & 0x7FE00000) >> 21)
+	if x&0x80000000 != 0 {
+		mantissa = -mantissa
+	}
+	return float32(math.Ldexp(mantissa, exponent-788))
+}
+
+func calcLookup1Values(entries int32, dimensions int32) int32 {
+	result := int32(math.Floor(math.Pow(float64(entries), 1/float64(dimensions))))
+
+	// Correct the floating-point error.
+	for calcPow(result+1, dimensions) <= int64(entries) {
+		result++
+	}
+	for result > 0 && calcPow(result, dimensions) > int64(entries) {
+		result--
+	}
+
+	return result
+}
+
+func calcPow(x int32, y int32) int64 {
+	result := int64(1)
+	for i := int32(0); i < y; i++ {
+		result *= int64(x)
+		if result > math.MaxInt32 {
+			return result
+		}
+	}
+	return result
+}
@@ -0,0 +1,425 @@
+package meltysynth
+
+import (
+	"errors"
+	"math"
+)
+
+type vorbisMapping struct {
+	submapCount    int32
+	magnitudes     []int32
+	angles         []int32
+	mux            []int32
+	submapFloors   []int32
+	submapResidues []int32
+}
+
+type vorbisMode struct {
+	blockFlag bool
+	mapping   int32
+}
+
+type vorbisDecoder struct {
+	channels   int32
+	sampleRate int32
+	blockSizes [2]int32
+
+	codebooks []*vorbisCodebook
+	floors    []*vorbisFloor
+	residues  []*vorbisResidue
+	mappings  []*vorbisMapping
+	modes     []*vorbisMode
+
+	mdcts   [2]*vorbisMdct
+	windows [2][]float32
+
+	// The windowed output of the previous block, which is overlapped with the next block.
+	previous     [][]float32
+	previousSize int32
+}
+
+// Decodes the Ogg Vorbis data and returns the samples of the first channel.
+func decodeVorbis(data []byte) ([]float32, int32, error) {
+	packets, granule, err := readOggPackets(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(packets) < 3 {
+		return nil, 0, errors.New("the vorbis headers were not found")
+	}
+
+	decoder := new(vorbisDecoder)
+
+	err = decoder.readIdentificationHeader(packets[0])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(packets[1]) < 7 || packets[1][0] != 3 || string(packets[1][1:7]) != "vorbis" {
+		return nil, 0, errors.New("the vorbis comment header was not found")
+	}
+
+	err = decoder.readSetupHeader(packets[2])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var samples []float32
+	for _, packet := range packets[3:] {
+		samples, err = decoder.decodePacket(packet, samples)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The granule position of the last page gives the exact length of the stream.
+	if granule >= 0 && granule < int64(len(samples)) {
+		samples = samples[0:granule]
+	}
+
+	return samples, decoder.sampleRate, nil
+}
+
+func (decoder *vorbisDecoder) readIdentificationHeader(packet []byte) error {
+	if len(packet) < 30 || packet[0] != 1 || string(packet[1:7]) != "vorbis" {
+		return errors.New("the vorbis identification header was not found")
+	}
+
+	br := newVorbisBitReader(packet[7:])
+	if br.readBits(32) != 0 {
+		return errors.New("the vorbis version is not supported")
+	}
+	decoder.channels = int32(br.readBits(8))
+	decoder.sampleRate = int32(br.readBits(32))
+	br.readBits(32)
+	br.readBits(32)
+	br.readBits(32)
+	decoder.blockSizes[0] = 1 << br.readBits(4)
+	decoder.blockSizes[1] = 1 << br.readBits(4)
+
+	if decoder.channels == 0 || decoder.sampleRate == 0 {
+		return errors.New("the vorbis identification header is invalid")
+	}
+	if decoder.blockSizes[0] < 64 || decoder.blockSizes[0] > decoder.blockSizes[1] || decoder.blockSizes[1] > 8192 {
+		return errors.New("the vorbis block size is invalid")
+	}
+
+	for i := 0; i < 2; i++ {
+		size := decoder.blockSizes[i]
+		decoder.mdcts[i] = newVorbisMdct(int(size))
+		decoder.windows[i] = createVorbisWindowSlope(size / 2)
+	}
+
+	return nil
+}
+
+func (decoder *vorbisDecoder) readSetupHeader(packet []byte) error {
+	if len(packet) < 7 || packet[0] != 5 || string(packet[1:7]) != "vorbis" {
+		return errors.New("the vorbis setup header was not found")
+	}
+
+	br := newVorbisBitReader(packet[7:])
+
+	codebookCount := br.readBits(8) + 1
+	decoder.codebooks = make([]*vorbisCodebook, codebookCount)
+	for i := uint32(0); i < codebookCount; i++ {
+		codebook, err := readVorbisCodebook(br)
+		if err != nil {
+			return err
+		}
+		decoder.codebooks[i] = codebook
+	}
+
+	// The time domain transforms are placeholders.
+	timeCount := br.readBits(6) + 1
+	for i := uint32(0); i < timeCount; i++ {
+		if br.readBits(16) != 0 {
+			return errors.New("the vorbis time domain transform is invalid")
+		}
+	}
+
+	floorCount := br.readBits(6) + 1
+	decoder.floors = make([]*vorbisFloor, floorCount)
+	for i := uint32(0); i < floorCount; i++ {
+		floor, err := readVorbisFloor(br, decoder.codebooks)
+		if err != nil {
+			return err
+		}
+		decoder.floors[i] = floor
+	}
+
+	residueCount := br.readBits(6) + 1
+	decoder.residues = make([]*vorbisResidue, residueCount)
+	for i := uint32(0); i < residueCount; i++ {
+		residue, err := readVorbisResidue(br, decoder.codebooks)
+		if err != nil {
+			return err
+		}
+		decoder.residues[i] = residue
+	}
+
+	mappingCount := br.readBits(6) + 1
+	decoder.mappings = make([]*vorbisMapping, mappingCount)
+	for i := uint32(0); i < mappingCount; i++ {
+		mapping, err := decoder.readMapping(br)
+		if err != nil {
+			return err
+		}
+		decoder.mappings[i] = mapping
+	}
+
+	modeCount := br.readBits(6) + 1
+	decoder.modes = make([]*vorbisMode, modeCount)
+	for i := uint32(0); i < modeCount; i++ {
+		mode := new(vorbisMode)
+		mode.blockFlag = br.readFlag()
+		windowType := br.readBits(16)
+		transformType := br.readBits(16)
+		mode.mapping = int32(br.readBits(8))
+		if windowType != 0 || transformType != 0 || int(mode.mapping) >= len(decoder.mappings) {
+			return errors.New("the vorbis mode is invalid")
+		}
+		decoder.modes[i] = mode
+	}
+
+	if !br.readFlag() || br.eop {
+		return errors.New("the vorbis setup header is invalid")
+	}
+
+	return nil
+}
+
+func (decoder *vorbisDecoder) readMapping(br *vorbisBitReader) (*vorbisMapping, error) {
+	if br.readBits(16) != 0 {
+		return nil, errors.New("the vorbis mapping type is invalid")
+	}
+
+	result := new(vorbisMapping)
+
+	result.submapCount = 1
+	if br.readFlag() {
+		result.submapCount = int32(br.readBits(4) + 1)
+	}
+
+	if br.readFlag() {
+		steps := br.readBits(8) + 1
+		bits := ilog(decoder.channels - 1)
+		result.magnitudes = make([]int32, steps)
+		result.angles = make([]int32, steps)
+		for i := uint32(0); i < steps; i++ {
+			result.magnitudes[i] = int32(br.readBits(bits))
+			result.angles[i] = int32(br.readBits(bits))
+			if result.magnitudes[i] == result.angles[i] || result.magnitudes[i] >= decoder.channels || result.angles[i] >= decoder.channels {
+				return nil, errors.New("the vorbis channel coupling is invalid")
+			}
+		}
+	}
+
+	if br.readBits(2) != 0 {
+		return nil, errors.New("the vorbis mapping is invalid")
+	}
+
+	result.mux = make([]int32, decoder.channels)
+	if result.submapCount > 1 {
+		for i := int32(0); i < decoder.channels; i++ {
+			result.mux[i] = int32(br.readBits(4))
+			if result.mux[i] >= result.submapCount {
+				return nil, errors.New("the vorbis mapping is invalid")
+			}
+		}
+	}
+
+	result.submapFloors = make([]int32, result.submapCount)
+	result.submapResidues = make([]int32, result.submapCount)
+	for i := int32(0); i < result.submapCount; i++ {
+		br.readBits(8)
+		result.submapFloors[i] = int32(br.readBits(8))
+		result.submapResidues[i] = int32(br.readBits(8))
+		if int(result.submapFloors[i]) >= len(decoder.floors) || int(result.submapResidues[i]) >= len(decoder.residues) {
+			return nil, errors.New("the vorbis mapping is invalid")
+		}
+	}
+
+	return result, nil
+}
+
+// Decodes the audio packet and appends the finished samples of the first channel.
+func (decoder *vorbisDecoder) decodePacket(packet []byte, samples []float32) ([]float32, error) {
+	// An empty packet is allowed and produces no samples.
+	if len(packet) == 0 {
+		return samples, nil
+	}
+
+	br := newVorbisBitReader(packet)
+
+	if br.readFlag() {
+		return nil, errors.New("the vorbis audio packet is invalid")
+	}
+
+	modeNumber := br.readBits(ilog(int32(len(decoder.modes)) - 1))
+	if int(modeNumber) >= len(decoder.modes) {
+		return nil, errors.New("the vorbis audio packet refers to an invalid mode")
+	}
+	mode := decoder.modes[modeNumber]
+	mapping := decoder.mappings[mode.mapping]
+
+	blockType := 0
+	if mode.blockFlag {
+		blockType = 1
+	}
+	n := decoder.blockSizes[blockType]
+	previousSize := n
+	nextSize := n
+	if mode.blockFlag {
+		if !br.readFlag() {
+			previousSize = decoder.blockSizes[0]
+		}
+		if !br.readFlag() {
+			nextSize = decoder.blockSizes[0]
+		}
+	}
+
+	channels := decoder.channels
+	half := n / 2
+
+	floorValues := make([][]int32, channels)
+	unused := make([]bool, channels)
+	for ch := int32(0); ch < channels; ch++ {
+		floor := decoder.floors[mapping.submapFloors[mapping.mux[ch]]]
+		floorValues[ch] = floor.decode(br, decoder.codebooks)
+		unused[ch] = floorValues[ch] == nil
+	}
+
+	// The coupled channels must be decoded together.
+	for i := 0; i < len(mapping.magnitudes); i++ {
+		magnitude := mapping.magnitudes[i]
+		angle := mapping.angles[i]
+		if !unused[magnitude] || !unused[angle] {
+			unused[magnitude] = false
+			unused[angle] = false
+		}
+	}
+
+	vectors := make([][]float32, channels)
+	for ch := int32(0); ch < channels; ch++ {
+		vectors[ch] = make([]float32, half)
+	}
+
+	for submap := int32(0); submap < mapping.submapCount; submap++ {
+		var submapVectors [][]float32
+		var submapUnused []bool
+		for ch := int32(0); ch < channels; ch++ {
+			if mapping.mux[ch] == submap {
+				submapVectors = append(submapVectors, vectors[ch])
+				submapUnused = append(submapUnused, unused[ch])
+			}
+		}
+		if len(submapVectors) > 0 {
+			residue := decoder.residues[mapping.submapResidues[submap]]
+			residue.decode(br, decoder.codebooks, submapVectors, submapUnused)
+		}
+	}
+
+	for i := len(mapping.magnitudes) - 1; i >= 0; i-- {
+		magnitudes := vectors[mapping.magnitudes[i]]
+		angles := vectors[mapping.angles[i]]
+		for j := int32(0); j < half; j++ {
+			m := magnitudes[j]
+			a := angles[j]
+			if m > 0 {
+				if a > 0 {
+					angles[j] = m - a
+				} else {
+					angles[j] = m
+					magnitudes[j] = m + a
+				}
+			} else {
+				if a > 0 {
+					angles[j] = m + a
+				} else {
+					angles[j] = m
+					magnitudes[j] = m - a
+				}
+			}
+		}
+	}
+
+	for ch := int32(0); ch < channels; ch++ {
+		if floorValues[ch] == nil {
+			for j := int32(0); j < half; j++ {
+				vectors[ch][j] = 0
+			}
+		} else {
+			floor := decoder.floors[mapping.submapFloors[mapping.mux[ch]]]
+			floor.apply(floorValues[ch], vectors[ch])
+		}
+	}
+
+	current := make([][]float32, channels)
+	for ch := int32(0); ch < channels; ch++ {
+		current[ch] = make([]float32, n)
+		decoder.mdcts[blockType].inverse(vectors[ch], current[ch])
+		decoder.applyWindow(current[ch], previousSize, nextSize)
+	}
+
+	// The samples between the centers of the previous and the current blocks are finished.
+	if decoder.previous != nil {
+		previous := decoder.previous[0]
+		length := decoder.previousSize/4 + n/4
+		offset := n/4 - decoder.previousSize/4
+		for i := int32(0); i < length; i++ {
+			var value float32
+			if j := decoder.previousSize/2 + i; j < decoder.previousSize {
+				value += previous[j]
+			}
+			if j := offset + i; j >= 0 && j < n {
+				value += current[0][j]
+			}
+			samples = append(samples, value)
+		}
+	}
+
+	decoder.previous = current
+	decoder.previousSize = n
+
+	return samples, nil
+}
+
+func (decoder *vorbisDecoder) applyWindow(block []float32, previousSize int32, nextSize int32) {
+	n := int32(len(block))
+
+	leftSlope := decoder.getWindowSlope(previousSize)
+	leftStart := n/4 - previousSize/4
+	leftEnd := leftStart + previousSize/2
+
+	rightSlope := decoder.getWindowSlope(nextSize)
+	rightStart := 3*n/4 - nextSize/4
+	rightEnd := rightStart + nextSize/2
+
+	for i := int32(0); i < n; i++ {
+		if i < leftStart || i >= rightEnd {
+			block[i] = 0
+		} else if i < leftEnd {
+			block[i] *= leftSlope[i-leftStart]
+		} else if i >= rightStart {
+			block[i] *= rightSlope[rightEnd-1-i]
+		}
+	}
+}
+
+func (decoder *vorbisDecoder) getWindowSlope(size int32) []float32 {
+	if size == decoder.blockSizes[0] {
+		return decoder.windows[0]
+	} else {
+		return decoder.windows[1]
+	}
+}
+
+func createVorbisWindowSlope(length int32) []float32 {
+	slope := make([]float32, length)
+	for i := int32(0); i < length; i++ {
+		x := math.Sin((float64(i) + 0.5) / float64(length) * math.Pi / 2)
+		slope[i] = float32(math.Sin(math.Pi / 2 * x * x))
+	}
+	return slope
+}
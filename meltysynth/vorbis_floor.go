@@ -0,0 +1,309 @@
+package meltysynth
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+type vorbisFloor struct {
+	partitionClasses []int32
+	classDimensions  []int32
+	classSubclasses  []uint
+	classMasterbooks []int32
+	subclassBooks    [][]int32
+	multiplier       int32
+	xList            []int32
+
+	// The indices of the x list sorted by the x values, and the neighbors of each point.
+	sortedOrder   []int32
+	lowNeighbors  []int32
+	highNeighbors []int32
+}
+
+var vorbis_FloorRanges = [4]int32{256, 128, 86, 64}
+
+// The inverse dB table defined in the Vorbis spec is a geometric series from 1.0649863E-07 to 1.
+var vorbis_InverseDbTable = createInverseDbTable()
+
+func createInverseDbTable() []float32 {
+	table := make([]float32, 256)
+	for i := 0; i < len(table); i++ {
+		table[i] = float32(math.Pow(1.0649863e-07, float64(255-i)/255))
+	}
+	return table
+}
+
+func readVorbisFloor(br *vorbisBitReader, codebooks []*vorbisCodebook) (*vorbisFloor, error) {
+	floorType := br.readBits(16)
+	if floorType == 0 {
+		// The floor type 0 is not used by any modern encoder.
+		return nil, errors.New("the vorbis floor type 0 is not supported")
+	}
+	if floorType != 1 {
+		return nil, errors.New("the vorbis floor type is invalid")
+	}
+
+	result := new(vorbisFloor)
+
+	partitions := int32(br.readBits(5))
+	result.partitionClasses = make([]int32, partitions)
+	maximumClass := int32(-1)
+	for i := int32(0); i < partitions; i++ {
+		result.partitionClasses[i] = int32(br.readBits(4))
+		if result.partitionClasses[i] > maximumClass {
+			maximumClass = result.partitionClasses[i]
+		}
+	}
+
+	classCount := maximumClass + 1
+	result.classDimensions = make([]int32, classCount)
+	result.classSubclasses = make([]uint, classCount)
+	result.classMasterbooks = make([]int32, classCount)
+	result.subclassBooks = make([][]int32, classCount)
+	for i := int32(0); i < classCount; i++ {
+		result.classDimensions[i] = int32(br.readBits(3) + 1)
+		result.classSubclasses[i] = uint(br.readBits(2))
+		if result.classSubclasses[i] > 0 {
+			result.classMasterbooks[i] = int32(br.readBits(8))
+			if int(result.classMasterbooks[i]) >= len(codebooks) {
+				return nil, errors.New("the vorbis floor refers to an invalid codebook")
+			}
+		}
+		result.subclassBooks[i] = make([]int32, 1<<result.classSubclasses[i])
+		for j := 0; j < len(result.subclassBooks[i]); j++ {
+			result.subclassBooks[i][j] = int32(br.readBits(8)) - 1
+			if int(result.subclassBooks[i][j]) >= len(codebooks) {
+				return nil, errors.New("the vorbis floor refers to an invalid codebook")
+			}
+		}
+	}
+
+	result.multiplier = int32(br.readBits(2) + 1)
+	rangeBits := uint(br.readBits(4))
+
+	result.xList = []int32{0, 1 << rangeBits}
+	for i := int32(0); i < partitions; i++ {
+		class := result.partitionClasses[i]
+		for j := int32(0); j < result.classDimensions[class]; j++ {
+			result.xList = append(result.xList, int32(br.readBits(rangeBits)))
+		}
+	}
+
+	if br.eop {
+		return nil, errors.New("the vorbis floor is truncated")
+	}
+
+	count := len(result.xList)
+	result.sortedOrder = make([]int32, count)
+	for i := 0; i < count; i++ {
+		result.sortedOrder[i] = int32(i)
+	}
+	sort.SliceStable(result.sortedOrder, func(i, j int) bool {
+		return result.xList[result.sortedOrder[i]] < result.xList[result.sortedOrder[j]]
+	})
+
+	// The x values must be unique, otherwise the floor curve cannot be rendered.
+	for i := 1; i < count; i++ {
+		if result.xList[result.sortedOrder[i-1]] == result.xList[result.sortedOrder[i]] {
+			return nil, errors.New("the vorbis floor has duplicate x values")
+		}
+	}
+
+	result.lowNeighbors = make([]int32, count)
+	result.highNeighbors = make([]int32, count)
+	for i := 2; i < count; i++ {
+		low := int32(0)
+		high := int32(1)
+		lowX := int32(-1)
+		highX := int32(math.MaxInt32)
+		for j := 0; j < i; j++ {
+			x := result.xList[j]
+			if x < result.xList[i] && x > lowX {
+				low = int32(j)
+				lowX = x
+			}
+			if x > result.xList[i] && x < highX {
+				high = int32(j)
+				highX = x
+			}
+		}
+		result.lowNeighbors[i] = low
+		result.highNeighbors[i] = high
+	}
+
+	return result, nil
+}
+
+// Returns the floor Y values, or nil if the channel is unused.
+func (fl *vorbisFloor) decode(br *vorbisBitReader, codebooks []*vorbisCodebook) []int32 {
+	if !br.readFlag() {
+		return nil
+	}
+
+	floorRange := vorbis_FloorRanges[fl.multiplier-1]
+	ys := make([]int32, len(fl.xList))
+	ys[0] = int32(br.readBits(ilog(floorRange - 1)))
+	ys[1] = int32(br.readBits(ilog(floorRange - 1)))
+
+	offset := 2
+	for _, class := range fl.partitionClasses {
+		dimensions := fl.classDimensions[class]
+		subclasses := fl.classSubclasses[class]
+		mask := int32(1)<<subclasses - 1
+		classValue := int32(0)
+		if subclasses > 0 {
+			classValue = codebooks[fl.classMasterbooks[class]].decodeScalar(br)
+		}
+		for j := int32(0); j < dimensions; j++ {
+			book := fl.subclassBooks[class][classValue&mask]
+			classValue >>= subclasses
+			if book >= 0 {
+				ys[offset] = codebooks[book].decodeScalar(br)
+			}
+			offset++
+		}
+	}
+
+	if br.eop {
+		return nil
+	}
+
+	return ys
+}
+
+// Computes the floor curve and multiplies it to the residue vector.
+func (fl *vorbisFloor) apply(ys []int32, vector []float32) {
+	count := len(fl.xList)
+	floorRange := vorbis_FloorRanges[fl.multiplier-1]
+
+	finalYs := make([]int32, count)
+	step2 := make([]bool, count)
+	step2[0] = true
+	step2[1] = true
+	finalYs[0] = ys[0]
+	finalYs[1] = ys[1]
+
+	for i := 2; i < count; i++ {
+		low := fl.lowNeighbors[i]
+		high := fl.highNeighbors[i]
+		predicted := renderVorbisPoint(fl.xList[low], finalYs[low], fl.xList[high], finalYs[high], fl.xList[i])
+
+		value := ys[i]
+		highRoom := floorRange - predicted
+		lowRoom := predicted
+		var room int32
+		if highRoom < lowRoom {
+			room = 2 * highRoom
+		} else {
+			room = 2 * lowRoom
+		}
+
+		if value != 0 {
+			step2[low] = true
+			step2[high] = true
+			step2[i] = true
+			if value >= room {
+				if highRoom > lowRoom {
+					finalYs[i] = value - lowRoom + predicted
+				} else {
+					finalYs[i] = predicted - value + highRoom - 1
+				}
+			} else {
+				if value%2 == 1 {
+					finalYs[i] = predicted - (value+1)/2
+				} else {
+					finalYs[i] = predicted + value/2
+				}
+			}
+		} else {
+			step2[i] = false
+			finalYs[i] = predicted
+		}
+	}
+
+	n := int32(len(vector))
+	hx := int32(0)
+	lx := int32(0)
+	ly := finalYs[fl.sortedOrder[0]] * fl.multiplier
+	hy := ly
+	for i := 1; i < count; i++ {
+		index := fl.sortedOrder[i]
+		if step2[index] {
+			hy = finalYs[index] * fl.multiplier
+			hx = fl.xList[index]
+			renderVorbisLine(lx, ly, hx, hy, vector)
+			lx = hx
+			ly = hy
+		}
+	}
+	if hx < n {
+		renderVorbisLine(hx, hy, n, hy, vector)
+	}
+}
+
+func renderVorbisPoint(x0 int32, y0 int32, x1 int32, y1 int32, x int32) int32 {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	offset := ady * (x - x0) / adx
+	if dy < 0 {
+		return y0 - offset
+	} else {
+		return y0 + offset
+	}
+}
+
+func renderVorbisLine(x0 int32, y0 int32, x1 int32, y1 int32, vector []float32) {
+	n := int32(len(vector))
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	base := dy / adx
+	var sy int32
+	if dy < 0 {
+		sy = base - 1
+	} else {
+		sy = base + 1
+	}
+	absBase := base
+	if absBase < 0 {
+		absBase = -absBase
+	}
+	ady -= absBase * adx
+
+	x := x0
+	y := y0
+	err := int32(0)
+	if x < n {
+		vector[x] *= vorbis_InverseDbTable[clampVorbisFloorY(y)]
+	}
+	for x = x0 + 1; x < x1; x++ {
+		err += ady
+		if err >= adx {
+			err -= adx
+			y += sy
+		} else {
+			y += base
+		}
+		if x < n {
+			vector[x] *= vorbis_InverseDbTable[clampVorbisFloorY(y)]
+		}
+	}
+}
+
+func clampVorbisFloorY(y int32) int32 {
+	if y < 0 {
+		return 0
+	}
+	if y > 255 {
+		return 255
+	}
+	return y
+}
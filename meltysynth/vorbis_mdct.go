@@ -0,0 +1,130 @@
+package meltysynth
+
+import "math"
+
+// The inverse MDCT is computed through the DCT-IV,
+// which is computed by a complex FFT of the quarter size of the block.
+
+type vorbisMdct struct {
+	n int
+
+	preRe      []float64
+	preIm      []float64
+	postRe     []float64
+	postIm     []float64
+	fftRe      []float64
+	fftIm      []float64
+	bitReverse []int
+
+	re  []float64
+	im  []float64
+	dct []float64
+}
+
+func newVorbisMdct(n int) *vorbisMdct {
+	result := new(vorbisMdct)
+	result.n = n
+
+	m := n / 2
+	quarter := n / 4
+
+	result.preRe = make([]float64, quarter)
+	result.preIm = make([]float64, quarter)
+	result.postRe = make([]float64, quarter)
+	result.postIm = make([]float64, quarter)
+	for i := 0; i < quarter; i++ {
+		a := -math.Pi * float64(i) / float64(m)
+		result.preRe[i] = math.Cos(a)
+		result.preIm[i] = math.Sin(a)
+		b := -math.Pi * (float64(i) + 0.25) / float64(m)
+		result.postRe[i] = math.Cos(b)
+		result.postIm[i] = math.Sin(b)
+	}
+
+	result.fftRe = make([]float64, quarter/2)
+	result.fftIm = make([]float64, quarter/2)
+	for i := 0; i < quarter/2; i++ {
+		a := -2 * math.Pi * float64(i) / float64(quarter)
+		result.fftRe[i] = math.Cos(a)
+		result.fftIm[i] = math.Sin(a)
+	}
+
+	bits := ilog(int32(quarter)) - 1
+	result.bitReverse = make([]int, quarter)
+	for i := 0; i < quarter; i++ {
+		var reversed int
+		for j := uint(0); j < bits; j++ {
+			reversed |= ((i >> j) & 1) << (bits - 1 - j)
+		}
+		result.bitReverse[i] = reversed
+	}
+
+	result.re = make([]float64, quarter)
+	result.im = make([]float64, quarter)
+	result.dct = make([]float64, m)
+
+	return result
+}
+
+// Computes the inverse MDCT of the n/2 coefficients into the n samples.
+func (mdct *vorbisMdct) inverse(input []float32, output []float32) {
+	n := mdct.n
+	m := n / 2
+	quarter := n / 4
+
+	// Pre-twiddle.
+	for i := 0; i < quarter; i++ {
+		xr := float64(input[2*i])
+		xi := float64(input[m-1-2*i])
+		tr := mdct.preRe[i]
+		ti := mdct.preIm[i]
+		j := mdct.bitReverse[i]
+		mdct.re[j] = xr*tr - xi*ti
+		mdct.im[j] = xr*ti + xi*tr
+	}
+
+	// Radix-2 FFT.
+	for size := 2; size <= quarter; size <<= 1 {
+		half := size / 2
+		step := quarter / size
+		for start := 0; start < quarter; start += size {
+			for k := 0; k < half; k++ {
+				wr := mdct.fftRe[k*step]
+				wi := mdct.fftIm[k*step]
+				a := start + k
+				b := a + half
+				br := mdct.re[b]*wr - mdct.im[b]*wi
+				bi := mdct.re[b]*wi + mdct.im[b]*wr
+				mdct.re[b] = mdct.re[a] - br
+				mdct.im[b] = mdct.im[a] - bi
+				mdct.re[a] += br
+				mdct.im[a] += bi
+			}
+		}
+	}
+
+	// Post-twiddle.
+	for i := 0; i < quarter; i++ {
+		tr := mdct.postRe[i]
+		ti := mdct.postIm[i]
+		zr := mdct.re[i]*tr - mdct.im[i]*ti
+		zi := mdct.re[i]*ti + mdct.im[i]*tr
+		mdct.dct[2*i] = zr
+		mdct.dct[m-1-2*i] = -zi
+	}
+
+	// Unfold the DCT-IV output into the MDCT output.
+	half := m / 2
+	for i := 0; i < n; i++ {
+		j := i + half
+		var value float64
+		if j < m {
+			value = mdct.dct[j]
+		} else if j < 2*m {
+			value = -mdct.dct[2*m-1-j]
+		} else {
+			value = -mdct.dct[j-2*m]
+		}
+		output[i] = float32(value)
+	}
+}
@@ -0,0 +1,28 @@
+package meltysynth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVorbisMdct(t *testing.T) {
+	for _, n := range []int{64, 256, 2048} {
+		input := make([]float32, n/2)
+		for i := 0; i < len(input); i++ {
+			input[i] = float32(math.Sin(0.37*float64(i*i) + 1))
+		}
+
+		output := make([]float32, n)
+		newVorbisMdct(n).inverse(input, output)
+
+		for i := 0; i < n; i++ {
+			var expected float64
+			for k := 0; k < n/2; k++ {
+				expected += float64(input[k]) * math.Cos(2*math.Pi/float64(n)*(float64(i)+0.5+float64(n)/4)*(float64(k)+0.5))
+			}
+			if math.Abs(expected-float64(output[i])) > 1.0e-4 {
+				t.Fatalf("n = %d, sample %d: expected %f, but got %f", n, i, expected, output[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package meltysynth
+
+import "errors"
+
+type vorbisResidue struct {
+	residueType     uint32
+	begin           int32
+	end             int32
+	partitionSize   int32
+	classifications int32
+	classbook       int32
+	books           [][8]int32
+}
+
+func readVorbisResidue(br *vorbisBitReader, codebooks []*vorbisCodebook) (*vorbisResidue, error) {
+	result := new(vorbisResidue)
+
+	result.residueType = br.readBits(16)
+	if result.residueType > 2 {
+		return nil, errors.New("the vorbis residue type is invalid")
+	}
+
+	result.begin = int32(br.readBits(24))
+	result.end = int32(br.readBits(24))
+	result.partitionSize = int32(br.readBits(24) + 1)
+	result.classifications = int32(br.readBits(6) + 1)
+	result.classbook = int32(br.readBits(8))
+	if result.begin > result.end {
+		return nil, errors.New("the vorbis residue range is invalid")
+	}
+	if int(result.classbook) >= len(codebooks) || codebooks[result.classbook].dimensions == 0 {
+		return nil, errors.New("the vorbis residue refers to an invalid codebook")
+	}
+
+	cascade := make([]uint32, result.classifications)
+	for i := int32(0); i < result.classifications; i++ {
+		lowBits := br.readBits(3)
+		var highBits uint32
+		if br.readFlag() {
+			highBits = br.readBits(5)
+		}
+		cascade[i] = highBits<<3 | lowBits
+	}
+
+	result.books = make([][8]int32, result.classifications)
+	for i := int32(0); i < result.classifications; i++ {
+		for j := 0; j < 8; j++ {
+			if cascade[i]&(1<<j) != 0 {
+				book := int32(br.readBits(8))
+				if int(book) >= len(codebooks) || codebooks[book].vectors == nil || codebooks[book].dimensions == 0 {
+					return nil, errors.New("the vorbis residue refers to an invalid codebook")
+				}
+				result.books[i][j] = book
+			} else {
+				result.books[i][j] = -1
+			}
+		}
+	}
+
+	if br.eop {
+		return nil, errors.New("the vorbis residue is truncated")
+	}
+
+	return result, nil
+}
+
+// Decodes the residue vectors of the channels.
+// The vectors of the channels marked as unused are left as they are.
+func (re *vorbisResidue) decode(br *vorbisBitReader, codebooks []*vorbisCodebook, vectors [][]float32, unused []bool) {
+	n := int32(len(vectors[0]))
+	channels := int32(len(vectors))
+
+	decodeChannels := unused
+	if re.residueType == 2 {
+		// All the channels are interleaved into a single vector.
+		anyUsed := false
+		for _, u := range unused {
+			if !u {
+				anyUsed = true
+			}
+		}
+		if !anyUsed {
+			return
+		}
+		n *= channels
+		decodeChannels = []bool{false}
+	}
+
+	begin := re.begin
+	if begin > n {
+		begin = n
+	}
+	end := re.end
+	if end > n {
+		end = n
+	}
+	partitions := (end - begin) / re.partitionSize
+	if partitions == 0 {
+		return
+	}
+
+	classbook := codebooks[re.classbook]
+	classesPerCodeword := classbook.dimensions
+	classes := make([][]int32, len(decodeChannels))
+	for ch := 0; ch < len(decodeChannels); ch++ {
+		classes[ch] = make([]int32, partitions+classesPerCodeword)
+	}
+
+	for pass := 0; pass < 8; pass++ {
+		partition := int32(0)
+		for partition < partitions {
+			if pass == 0 {
+				for ch := 0; ch < len(decodeChannels); ch++ {
+					if decodeChannels[ch] {
+						continue
+					}
+					value := classbook.decodeScalar(br)
+					if value < 0 {
+						return
+					}
+					for i := classesPerCodeword - 1; i >= 0; i-- {
+						classes[ch][partition+i] = value % re.classifications
+						value /= re.classifications
+					}
+				}
+			}
+
+			for i := int32(0); i < classesPerCodeword && partition < partitions; i++ {
+				for ch := 0; ch < len(decodeChannels); ch++ {
+					if decodeChannels[ch] {
+						continue
+					}
+					book := re.books[classes[ch][partition]][pass]
+					if book < 0 {
+						continue
+					}
+					offset := begin + partition*re.partitionSize
+					if !re.decodePartition(br, codebooks[book], vectors, ch, offset) {
+						return
+					}
+				}
+				partition++
+			}
+		}
+	}
+}
+
+func (re *vorbisResidue) decodePartition(br *vorbisBitReader, codebook *vorbisCodebook, vectors [][]float32, ch int, offset int32) bool {
+	switch re.residueType {
+	case 0:
+		step := re.partitionSize / codebook.dimensions
+		for i := int32(0); i < step; i++ {
+			values := codebook.decodeVector(br)
+			if values == nil {
+				return false
+			}
+			for j, value := range values {
+				vectors[ch][offset+i+int32(j)*step] += value
+			}
+		}
+	case 1:
+		for i := int32(0); i < re.partitionSize; {
+			values := codebook.decodeVector(br)
+			if values == nil {
+				return false
+			}
+			for _, value := range values {
+				if i < re.partitionSize {
+					vectors[ch][offset+i] += value
+				}
+				i++
+			}
+		}
+	case 2:
+		channels := int32(len(vectors))
+		for i := int32(0); i < re.partitionSize; {
+			values := codebook.decodeVector(br)
+			if values == nil {
+				return false
+			}
+			for _, value := range values {
+				if i < re.partitionSize {
+					position := offset + i
+					vectors[position%channels][position/channels] += value
+				}
+				i++
+			}
+		}
+	}
+	return true
+}
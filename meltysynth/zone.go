@@ -6,9 +6,10 @@ import (
 
 type zone struct {
 	generators []generator
+	modulators []Modulator
 }
 
-func createZones(infos []*zoneInfo, generators []generator) ([]*zone, error) {
+func createZones(p *soundFontParser, bag string, infos []*zoneInfo, generators []generator, modulators []Modulator) ([]*zone, error) {
 	if len(infos) <= 1 {
 		return nil, errors.New("no valid zone was found")
 	}
@@ -21,11 +22,29 @@ func createZones(infos []*zoneInfo, generators []generator) ([]*zone, error) {
 		info := infos[i]
 
 		zo := new(zone)
+
+		if info.generatorCount < 0 || int(info.generatorIndex+info.generatorCount) > len(generators) {
+			if !p.lenient {
+				return nil, errors.New("the generator list is invalid")
+			}
+			p.warn(bag, "the generators of the zone %d were removed since the generator list is invalid", i)
+			info.generatorCount = 0
+		}
 		zo.generators = make([]generator, info.generatorCount)
 		for j := int32(0); j < info.generatorCount; j++ {
 			zo.generators[j] = generators[info.generatorIndex+j]
 		}
 
+		// The modulators are optional for the synthesis, so the invalid list is dropped even in the strict mode.
+		if info.modulatorIndex < 0 || info.modulatorCount < 0 || int(info.modulatorIndex+info.modulatorCount) > len(modulators) {
+			p.warn(bag, "the modulators of the zone %d were removed since the modulator list is invalid", i)
+			info.modulatorCount = 0
+		}
+		zo.modulators = make([]Modulator, info.modulatorCount)
+		for j := int32(0); j < info.modulatorCount; j++ {
+			zo.modulators[j] = modulators[info.modulatorIndex+j]
+		}
+
 		zones[i] = zo
 	}
 
@@ -35,5 +54,6 @@ func createZones(infos []*zoneInfo, generators []generator) ([]*zone, error) {
 func createEmptyZone() *zone {
 	result := new(zone)
 	result.generators = make([]generator, 0)
+	result.modulators = make([]Modulator, 0)
 	return result
 }